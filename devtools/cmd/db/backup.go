@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/urvil38/todo-app/internal/backup"
+	"github.com/urvil38/todo-app/internal/database"
+	"github.com/urvil38/todo-app/internal/postgres"
+)
+
+// backupResult is the output of backup, when it writes to a file.
+type backupResult struct {
+	File        string `json:"file"`
+	Tasks       int64  `json:"tasks"`
+	AuditEvents int64  `json:"audit_events"`
+}
+
+func (r backupResult) String() string {
+	return fmt.Sprintf("backed up %d tasks and %d audit events to %s", r.Tasks, r.AuditEvents, r.File)
+}
+
+// backupDB writes an archive of the database to the file named by -o, or to
+// standard output.
+func backupDB(ctx context.Context, args []string, connectionInfo string) (outerErr error) {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	file := fs.String("o", "", "write the archive to this file instead of standard output")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("backup: unexpected arguments %q", fs.Args())
+	}
+
+	ddb, err := database.Open("pgx", connectionInfo)
+	if err != nil {
+		return err
+	}
+	defer ddb.Close()
+
+	var out io.Writer = os.Stdout
+	if *file != "" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := f.Close(); err != nil && outerErr == nil {
+				outerErr = err
+			}
+		}()
+		out = f
+	}
+
+	w, err := backup.NewWriter(out, "postgres")
+	if err != nil {
+		return err
+	}
+	if err := postgres.New(ddb).ExportBackup(ctx, w); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if *file == "" {
+		// Standard output holds the archive.
+		return nil
+	}
+	return output(backupResult{
+		File:        *file,
+		Tasks:       w.Rows(backup.TableTasks),
+		AuditEvents: w.Rows(backup.TableAuditEvents),
+	})
+}
+
+// restoreResult is the output of restore.
+type restoreResult struct {
+	backup.Result
+}
+
+func (r restoreResult) String() string {
+	return fmt.Sprintf("restored %d tasks (%d skipped, %d overwritten) and %d audit events (%d skipped)",
+		r.Tasks, r.Skipped, r.Overwritten, r.AuditEvents, r.SkippedAuditEvents)
+}
+
+// restoreDB restores the archive in the named file, or on standard input.
+func restoreDB(ctx context.Context, args []string, connectionInfo string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	conflict := fs.String("conflict", string(backup.ConflictFail), "what to do with tasks that exist: fail, skip or overwrite")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	policy, err := backup.ParseConflictPolicy(*conflict)
+	if err != nil {
+		return fmt.Errorf("restore: %v", err)
+	}
+
+	var in io.Reader = os.Stdin
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	default:
+		return errors.New("restore takes at most one file")
+	}
+
+	ddb, err := database.Open("pgx", connectionInfo)
+	if err != nil {
+		return err
+	}
+	defer ddb.Close()
+
+	res, err := postgres.New(ddb).ImportBackup(ctx, in, policy)
+	if err != nil {
+		return err
+	}
+	return output(restoreResult{res})
+}
@@ -1,14 +1,22 @@
-// The seeddb command is used to populates a database with an initial set of
-// modules.
+// The db command creates, migrates and seeds the todo-app database.
 package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 
+	migratepkg "github.com/golang-migrate/migrate/v4"
+	migratedb "github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/source"
 	_ "github.com/jackc/pgx/v4/stdlib" // for pgx driver
 	"github.com/urvil38/todo-app/internal/config"
 	"github.com/urvil38/todo-app/internal/database"
@@ -17,22 +25,39 @@ import (
 
 var (
 	log = logpkg.Logger
+
+	jsonOutput = flag.Bool("json", false, "print command output as JSON")
+
+	// stdout is where command output is printed. Tests replace it.
+	stdout io.Writer = os.Stdout
 )
 
+// migrationsDir is where new creates migrations, relative to the repository
+// root.
+const migrationsDir = "migrations"
+
 func main() {
 	flag.Usage = func() {
-		fmt.Fprintf(flag.CommandLine.Output(), "usage: db [cmd]\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: db [-json] [cmd] [args]\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "  create: creates a new database. It does not run migrations\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "  migrate: runs all migrations \n")
 		fmt.Fprintf(flag.CommandLine.Output(), "  drop: drops database\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "  truncate: truncates all tables in database\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "  recreate: drop, create and run migrations\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  status: prints the schema version, whether it is dirty, and pending migrations\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  down N: rolls back the last N migrations\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  goto V: migrates up or down to version V\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  force V: sets the version to V without migrating, to recover from a dirty state\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  new NAME: creates the next numbered up and down migrations in migrations/\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  seed [flags]: populates the database, or a server with -url, with fake tasks. See seed -h\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  backup [-o FILE]: writes an archive of all task data to FILE or standard output\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  restore [-conflict fail|skip|overwrite] [FILE]: restores an archive from FILE or standard input\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "Database name is set using $TODO_DATABASE_NAME. ")
 		flag.PrintDefaults()
 	}
 
 	flag.Parse()
-	if flag.NArg() != 1 {
+	if flag.NArg() < 1 {
 		flag.Usage()
 		os.Exit(1)
 	}
@@ -44,12 +69,21 @@ func main() {
 	}
 
 	dbName := config.GetEnv("TODO_DATABASE_NAME", "todo-db")
-	if err := run(ctx, flag.Args()[0], dbName, cfg.DBConnInfo()); err != nil {
+	if err := run(ctx, flag.Args(), dbName, cfg.DBConnInfo()); err != nil {
 		log.Fatal(ctx, err)
 	}
 }
 
-func run(ctx context.Context, cmd, dbName, connectionInfo string) error {
+func run(ctx context.Context, args []string, dbName, connectionInfo string) error {
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "status", "down", "goto", "force", "new", "seed", "backup", "restore":
+	default:
+		if len(args) > 0 {
+			return fmt.Errorf("%s takes no arguments", cmd)
+		}
+	}
+
 	switch cmd {
 	case "create":
 		return create(ctx, dbName)
@@ -61,6 +95,49 @@ func run(ctx context.Context, cmd, dbName, connectionInfo string) error {
 		return recreate(ctx, dbName)
 	case "truncate":
 		return truncate(ctx, connectionInfo)
+	case "status":
+		if len(args) > 0 {
+			return fmt.Errorf("%s takes no arguments", cmd)
+		}
+		return status(dbName)
+	case "down":
+		n, err := intArg(cmd, args)
+		if err != nil {
+			return err
+		}
+		if n <= 0 {
+			return fmt.Errorf("down: N must be positive, got %d", n)
+		}
+		return down(dbName, n)
+	case "goto":
+		v, err := intArg(cmd, args)
+		if err != nil {
+			return err
+		}
+		if v < 0 {
+			return fmt.Errorf("goto: V must not be negative, got %d", v)
+		}
+		return gotoVersion(dbName, uint(v))
+	case "force":
+		v, err := intArg(cmd, args)
+		if err != nil {
+			return err
+		}
+		if v < migratedb.NilVersion {
+			return fmt.Errorf("force: V must be at least %d, got %d", migratedb.NilVersion, v)
+		}
+		return force(dbName, v)
+	case "seed":
+		return seed(ctx, args, connectionInfo)
+	case "backup":
+		return backupDB(ctx, args, connectionInfo)
+	case "restore":
+		return restoreDB(ctx, args, connectionInfo)
+	case "new":
+		if len(args) != 1 {
+			return errors.New("new takes a migration name")
+		}
+		return newMigration(migrationsDir, args[0])
 	default:
 		return fmt.Errorf("unsupported arg: %q", cmd)
 	}
@@ -118,3 +195,156 @@ func truncate(ctx context.Context, connectionInfo string) error {
 	defer ddb.Close()
 	return database.ResetDB(ctx, ddb)
 }
+
+// intArg parses the single integer argument of cmd.
+func intArg(cmd string, args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("%s takes one integer argument", cmd)
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", cmd, err)
+	}
+	return n, nil
+}
+
+// output prints v, as JSON if -json was given.
+func output(v fmt.Stringer) error {
+	if *jsonOutput {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	_, err := fmt.Fprintln(stdout, v)
+	return err
+}
+
+// migrationStatus is the output of status, down, goto and force.
+type migrationStatus struct {
+	Version uint   `json:"version"`
+	Dirty   bool   `json:"dirty"`
+	Latest  uint   `json:"latest"`
+	Pending []uint `json:"pending"`
+}
+
+func (s migrationStatus) String() string {
+	pending := "none"
+	if len(s.Pending) > 0 {
+		vs := make([]string, len(s.Pending))
+		for k, v := range s.Pending {
+			vs[k] = strconv.FormatUint(uint64(v), 10)
+		}
+		pending = strings.Join(vs, ", ")
+	}
+	return fmt.Sprintf("version: %d\ndirty: %t\nlatest: %d\npending: %s", s.Version, s.Dirty, s.Latest, pending)
+}
+
+// withMigrate calls f with a migrate.Migrate for dbName, then prints the
+// resulting status.
+func withMigrate(dbName string, f func(*migratepkg.Migrate) error) (outerErr error) {
+	m, err := database.NewMigrate(dbName)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if srcErr, dbErr := m.Close(); srcErr != nil || dbErr != nil {
+			outerErr = database.MultiErr{outerErr, srcErr, dbErr}
+		}
+	}()
+	if err := f(m); err != nil && err != migratepkg.ErrNoChange {
+		return err
+	}
+
+	version, dirty, err := m.Version()
+	if err != nil && err != migratepkg.ErrNilVersion {
+		return err
+	}
+	versions, err := database.Migrations()
+	if err != nil {
+		return err
+	}
+	return output(newMigrationStatus(version, dirty, versions))
+}
+
+// newMigrationStatus returns the status of a database at version, given the
+// sorted versions of all migrations.
+func newMigrationStatus(version uint, dirty bool, versions []uint) migrationStatus {
+	s := migrationStatus{Version: version, Dirty: dirty, Pending: []uint{}}
+	if len(versions) > 0 {
+		s.Latest = versions[len(versions)-1]
+	}
+	for _, v := range versions {
+		if v > version {
+			s.Pending = append(s.Pending, v)
+		}
+	}
+	return s
+}
+
+func status(dbName string) error {
+	return withMigrate(dbName, func(*migratepkg.Migrate) error { return nil })
+}
+
+func down(dbName string, n int) error {
+	return withMigrate(dbName, func(m *migratepkg.Migrate) error { return m.Steps(-n) })
+}
+
+func gotoVersion(dbName string, v uint) error {
+	return withMigrate(dbName, func(m *migratepkg.Migrate) error { return m.Migrate(v) })
+}
+
+func force(dbName string, v int) error {
+	return withMigrate(dbName, func(m *migratepkg.Migrate) error { return m.Force(v) })
+}
+
+var migrationNameRegexp = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// newMigrationFiles is the output of new.
+type newMigrationFiles struct {
+	Version uint   `json:"version"`
+	Up      string `json:"up"`
+	Down    string `json:"down"`
+}
+
+func (f newMigrationFiles) String() string {
+	return fmt.Sprintf("created %s\ncreated %s", f.Up, f.Down)
+}
+
+// newMigration creates empty up and down migrations named name in dir,
+// numbered after the newest migration there.
+func newMigration(dir, name string) error {
+	if !migrationNameRegexp.MatchString(name) {
+		return fmt.Errorf("new: migration name %q must consist of lower case letters, digits and underscores", name)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("new: %v (run from the repository root)", err)
+	}
+	var latest uint
+	for _, e := range entries {
+		m, err := source.DefaultParse(e.Name())
+		if err != nil {
+			continue
+		}
+		if m.Version > latest {
+			latest = m.Version
+		}
+	}
+
+	base := fmt.Sprintf("%06d_%s", latest+1, name)
+	f := newMigrationFiles{
+		Version: latest + 1,
+		Up:      filepath.Join(dir, base+".up.sql"),
+		Down:    filepath.Join(dir, base+".down.sql"),
+	}
+	for _, path := range []string{f.Up, f.Down} {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return fmt.Errorf("new: %v", err)
+		}
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("new: %v", err)
+		}
+	}
+	return output(f)
+}
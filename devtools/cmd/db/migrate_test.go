@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// captureOutput redirects command output to a buffer for the rest of the
+// test, with -json set to asJSON.
+func captureOutput(t *testing.T, asJSON bool) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	oldOut, oldJSON := stdout, *jsonOutput
+	stdout, *jsonOutput = &buf, asJSON
+	t.Cleanup(func() { stdout, *jsonOutput = oldOut, oldJSON })
+	return &buf
+}
+
+func TestNewMigration(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		existing []string
+		want     []string // up, then down
+	}{
+		{
+			name: "empty",
+			want: []string{"000001_add_tags.up.sql", "000001_add_tags.down.sql"},
+		},
+		{
+			name: "after newest",
+			existing: []string{
+				"000001_init.down.sql", "000001_init.up.sql",
+				"000009_index.down.sql", "000009_index.up.sql",
+				"000002_audit.up.sql",
+			},
+			want: []string{"000010_add_tags.up.sql", "000010_add_tags.down.sql"},
+		},
+		{
+			name:     "ignores other files",
+			existing: []string{"000003_views.up.sql", "README.md", "999_notes.txt.bak"},
+			want:     []string{"000004_add_tags.up.sql", "000004_add_tags.down.sql"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range test.existing {
+				if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			buf := captureOutput(t, false)
+			if err := newMigration(dir, "add_tags"); err != nil {
+				t.Fatal(err)
+			}
+
+			var created []string
+			for _, want := range test.want {
+				path := filepath.Join(dir, want)
+				info, err := os.Stat(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Size() != 0 {
+					t.Errorf("%s has size %d, want 0", want, info.Size())
+				}
+				created = append(created, "created "+path)
+			}
+			if got, want := buf.String(), strings.Join(created, "\n")+"\n"; got != want {
+				t.Errorf("output = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestNewMigrationJSON(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "000004_seed.up.sql"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	buf := captureOutput(t, true)
+	if err := newMigration(dir, "rename_column"); err != nil {
+		t.Fatal(err)
+	}
+	var got newMigrationFiles
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := newMigrationFiles{
+		Version: 5,
+		Up:      filepath.Join(dir, "000005_rename_column.up.sql"),
+		Down:    filepath.Join(dir, "000005_rename_column.down.sql"),
+	}
+	if got != want {
+		t.Errorf("output = %+v, want %+v", got, want)
+	}
+}
+
+func TestNewMigrationErrors(t *testing.T) {
+	for _, name := range []string{"AddTags", "add-tags", "add tags", "../add_tags", ""} {
+		dir := t.TempDir()
+		buf := captureOutput(t, false)
+		err := newMigration(dir, name)
+		if err == nil || !strings.Contains(err.Error(), "lower case letters") {
+			t.Errorf("newMigration(%q) = %v, want error about the name", name, err)
+		}
+		if buf.Len() > 0 {
+			t.Errorf("newMigration(%q) printed %q", name, buf.String())
+		}
+		if entries, err := os.ReadDir(dir); err != nil || len(entries) > 0 {
+			t.Errorf("newMigration(%q) left %d files, %v", name, len(entries), err)
+		}
+	}
+
+	if err := newMigration(filepath.Join(t.TempDir(), "missing"), "add_tags"); err == nil || !strings.Contains(err.Error(), "repository root") {
+		t.Errorf("newMigration(missing dir) = %v, want error mentioning the repository root", err)
+	}
+}
+
+func TestMigrationStatus(t *testing.T) {
+	versions := []uint{1, 2, 3, 5}
+	for _, test := range []struct {
+		name     string
+		version  uint
+		dirty    bool
+		want     migrationStatus
+		wantText string
+		wantJSON string
+	}{
+		{
+			name:     "nil version",
+			version:  0,
+			want:     migrationStatus{Version: 0, Latest: 5, Pending: []uint{1, 2, 3, 5}},
+			wantText: "version: 0\ndirty: false\nlatest: 5\npending: 1, 2, 3, 5\n",
+			wantJSON: "{\n  \"version\": 0,\n  \"dirty\": false,\n  \"latest\": 5,\n  \"pending\": [\n    1,\n    2,\n    3,\n    5\n  ]\n}\n",
+		},
+		{
+			name:     "dirty",
+			version:  3,
+			dirty:    true,
+			want:     migrationStatus{Version: 3, Dirty: true, Latest: 5, Pending: []uint{5}},
+			wantText: "version: 3\ndirty: true\nlatest: 5\npending: 5\n",
+			wantJSON: "{\n  \"version\": 3,\n  \"dirty\": true,\n  \"latest\": 5,\n  \"pending\": [\n    5\n  ]\n}\n",
+		},
+		{
+			name:     "up to date",
+			version:  5,
+			want:     migrationStatus{Version: 5, Latest: 5, Pending: []uint{}},
+			wantText: "version: 5\ndirty: false\nlatest: 5\npending: none\n",
+			wantJSON: "{\n  \"version\": 5,\n  \"dirty\": false,\n  \"latest\": 5,\n  \"pending\": []\n}\n",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s := newMigrationStatus(test.version, test.dirty, versions)
+			if !reflect.DeepEqual(s, test.want) {
+				t.Fatalf("newMigrationStatus() = %+v, want %+v", s, test.want)
+			}
+
+			buf := captureOutput(t, false)
+			if err := output(s); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != test.wantText {
+				t.Errorf("text output = %q, want %q", got, test.wantText)
+			}
+
+			buf = captureOutput(t, true)
+			if err := output(s); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != test.wantJSON {
+				t.Errorf("JSON output = %q, want %q", got, test.wantJSON)
+			}
+		})
+	}
+}
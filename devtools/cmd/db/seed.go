@@ -0,0 +1,452 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urvil38/todo-app/internal/config"
+	"github.com/urvil38/todo-app/internal/database"
+	"github.com/urvil38/todo-app/internal/postgres"
+	"github.com/urvil38/todo-app/internal/task"
+)
+
+// seedUserAgent is recorded in the audit events of seeded tasks.
+const seedUserAgent = "devtools/cmd/db seed"
+
+// seedOptions are the flags of the seed command.
+type seedOptions struct {
+	count        int
+	seed         int64
+	until        time.Time
+	days         int
+	distribution string
+	projects     []string
+	tags         []string
+	updated      float64
+	deleted      float64
+	batchSize    int
+	idScheme     task.IDScheme
+	url          string
+	concurrency  int
+}
+
+func parseSeedOptions(args []string) (seedOptions, error) {
+	var (
+		o        seedOptions
+		until    string
+		projects string
+		tags     string
+		idScheme string
+	)
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	fs.IntVar(&o.count, "n", 1000, "number of tasks to create")
+	fs.Int64Var(&o.seed, "seed", 1, "seed of the fake data; the same seed and -until give the same tasks")
+	fs.StringVar(&until, "until", "", "RFC 3339 time of the newest task (default: start of the current UTC day)")
+	fs.IntVar(&o.days, "days", 90, "tasks are created over this many days before -until")
+	fs.StringVar(&o.distribution, "dist", "recent", "distribution of creation times: uniform or recent")
+	fs.StringVar(&projects, "projects", "web,api,mobile,infra,docs", "comma-separated projects, from most to least common")
+	fs.StringVar(&tags, "tags", "bug,feature,chore,urgent,blocked", "comma-separated tags, from most to least common")
+	fs.Float64Var(&o.updated, "updated", 0.3, "fraction of tasks updated after creation")
+	fs.Float64Var(&o.deleted, "deleted", 0.05, "fraction of tasks moved to the trash")
+	fs.IntVar(&o.batchSize, "batch", 1000, "tasks inserted per transaction")
+	fs.StringVar(&idScheme, "ids", "ulid", "task ID scheme: ulid or uuidv7")
+	fs.StringVar(&o.url, "url", "", "seed the server at this base URL over HTTP instead of the database")
+	fs.IntVar(&o.concurrency, "concurrency", 4, "concurrent requests with -url")
+	if err := fs.Parse(args); err != nil {
+		return o, err
+	}
+	if fs.NArg() > 0 {
+		return o, fmt.Errorf("seed: unexpected arguments %q", fs.Args())
+	}
+
+	o.until = time.Now().UTC().Truncate(24 * time.Hour)
+	if until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return o, fmt.Errorf("seed: unable to parse -until: %w", err)
+		}
+		o.until = t
+	}
+	o.projects = splitFlag(projects)
+	o.tags = splitFlag(tags)
+	scheme, err := task.ParseIDScheme(idScheme)
+	if err != nil {
+		return o, fmt.Errorf("seed: %v", err)
+	}
+	o.idScheme = scheme
+
+	switch {
+	case o.count < 0:
+		return o, errors.New("seed: -n must not be negative")
+	case o.days <= 0:
+		return o, errors.New("seed: -days must be positive")
+	case o.distribution != "uniform" && o.distribution != "recent":
+		return o, fmt.Errorf("seed: unsupported -dist: %q", o.distribution)
+	case o.updated < 0 || o.updated > 1 || o.deleted < 0 || o.deleted > 1:
+		return o, errors.New("seed: -updated and -deleted must be between 0 and 1")
+	case o.batchSize <= 0 || o.concurrency <= 0:
+		return o, errors.New("seed: -batch and -concurrency must be positive")
+	}
+	return o, nil
+}
+
+func splitFlag(s string) []string {
+	var parts []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+var (
+	taskVerbs = []string{
+		"Fix", "Write", "Review", "Update", "Refactor", "Investigate",
+		"Document", "Deploy", "Test", "Plan", "Clean up", "Benchmark",
+	}
+	taskObjects = []string{
+		"login flow", "billing page", "search index", "release notes",
+		"onboarding email", "API rate limits", "dashboard", "CI pipeline",
+		"database backups", "mobile layout", "error messages", "audit log",
+		"dependency upgrades", "caching layer", "settings page", "alerts",
+	}
+)
+
+// fakeTask is a generated task and whether it was updated after creation.
+type fakeTask struct {
+	task.Task
+	updated bool
+}
+
+// generateTasks returns o.count fake tasks, oldest first. They depend only
+// on o, so the same options always give the same tasks.
+func generateTasks(o seedOptions) []fakeTask {
+	rng := rand.New(rand.NewSource(o.seed))
+	span := time.Duration(o.days) * 24 * time.Hour
+	// Timestamps are truncated to the precision postgres stores.
+	at := func(d time.Duration) time.Time {
+		return o.until.Add(-d).Truncate(time.Microsecond)
+	}
+	between := func(from time.Time) time.Time {
+		return from.Add(time.Duration(rng.Int63n(int64(o.until.Sub(from)) + 1))).Truncate(time.Microsecond)
+	}
+
+	tasks := make([]fakeTask, o.count)
+	for k := range tasks {
+		var age time.Duration
+		switch o.distribution {
+		case "uniform":
+			age = time.Duration(rng.Int63n(int64(span)))
+		case "recent":
+			// Exponential, with about 30% of the tasks in the last
+			// tenth of the span, resampled to stay within it.
+			for age = span; age >= span; {
+				age = time.Duration(rng.ExpFloat64() * float64(span) / 3.5)
+			}
+		}
+		t := &tasks[k]
+		t.Name = fakeName(rng, o.projects, o.tags)
+		t.CreatedAt = at(age)
+		t.UpdatedAt = t.CreatedAt
+		if rng.Float64() < o.updated {
+			t.UpdatedAt = between(t.CreatedAt)
+			t.updated = true
+		}
+		if rng.Float64() < o.deleted {
+			d := between(t.UpdatedAt)
+			t.DeletedAt = &d
+		}
+	}
+
+	sort.SliceStable(tasks, func(i, j int) bool { return tasks[i].CreatedAt.Before(tasks[j].CreatedAt) })
+	ids := task.NewIDGeneratorFrom(o.idScheme, rng)
+	for k := range tasks {
+		tasks[k].Id = ids.NewID(tasks[k].CreatedAt)
+	}
+	return tasks
+}
+
+// fakeName returns a task name like "[api] Fix login flow #bug". Projects
+// and tags earlier in their lists are picked more often.
+func fakeName(rng *rand.Rand, projects, tags []string) string {
+	var b strings.Builder
+	if len(projects) > 0 {
+		fmt.Fprintf(&b, "[%s] ", pickSkewed(rng, projects))
+	}
+	b.WriteString(taskVerbs[rng.Intn(len(taskVerbs))])
+	b.WriteByte(' ')
+	b.WriteString(taskObjects[rng.Intn(len(taskObjects))])
+	if len(tags) > 0 {
+		picked := map[string]bool{}
+		for n := rng.Intn(3); n > 0; n-- {
+			if tag := pickSkewed(rng, tags); !picked[tag] {
+				picked[tag] = true
+				fmt.Fprintf(&b, " #%s", tag)
+			}
+		}
+	}
+	name := []rune(b.String())
+	if len(name) > task.MaxNameLength {
+		name = name[:task.MaxNameLength]
+	}
+	return string(name)
+}
+
+// pickSkewed picks the k-th element of s with weight 1/(k+1).
+func pickSkewed(rng *rand.Rand, s []string) string {
+	var total float64
+	for k := range s {
+		total += 1 / float64(k+1)
+	}
+	x := rng.Float64() * total
+	for k := range s {
+		if x -= 1 / float64(k+1); x < 0 {
+			return s[k]
+		}
+	}
+	return s[len(s)-1]
+}
+
+// seedResult is the output of seed.
+type seedResult struct {
+	Seed    int64  `json:"seed"`
+	Target  string `json:"target"`
+	Tasks   int    `json:"tasks"`
+	Updated int    `json:"updated"`
+	Deleted int    `json:"deleted"`
+}
+
+func (r seedResult) String() string {
+	return fmt.Sprintf("seeded %s with %d tasks (%d updated, %d deleted) from seed %d", r.Target, r.Tasks, r.Updated, r.Deleted, r.Seed)
+}
+
+func seed(ctx context.Context, args []string, connectionInfo string) error {
+	o, err := parseSeedOptions(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	tasks := generateTasks(o)
+
+	r := seedResult{Seed: o.seed, Tasks: len(tasks)}
+	for _, t := range tasks {
+		if t.updated {
+			r.Updated++
+		}
+		if t.DeletedAt != nil {
+			r.Deleted++
+		}
+	}
+	if o.url != "" {
+		r.Target = o.url
+		err = seedHTTP(ctx, o, tasks)
+	} else {
+		r.Target = "database " + config.GetEnv("TODO_DATABASE_NAME", "todo-db")
+		err = seedDB(ctx, o, tasks, connectionInfo)
+	}
+	if err != nil {
+		return err
+	}
+	return output(r)
+}
+
+// seedDB inserts tasks, with the audit events that creating, updating and
+// deleting them would have recorded, in batches of o.batchSize.
+func seedDB(ctx context.Context, o seedOptions, tasks []fakeTask, connectionInfo string) error {
+	db, err := database.Open("pgx", connectionInfo)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	taskColumns := []string{"id", "name", "created_at", "updated_at", "deleted_at"}
+	eventColumns := []string{"task_id", "action", "user_agent", "before", "after", "created_at"}
+	for start := 0; start < len(tasks); start += o.batchSize {
+		end := start + o.batchSize
+		if end > len(tasks) {
+			end = len(tasks)
+		}
+		var taskValues, eventValues []interface{}
+		for _, t := range tasks[start:end] {
+			taskValues = append(taskValues, t.Id, t.Name, t.CreatedAt, t.UpdatedAt, t.DeletedAt)
+
+			created := t.Task
+			created.UpdatedAt, created.DeletedAt = t.CreatedAt, nil
+			events := []seedEvent{{task.ActionCreate, nil, &created, t.CreatedAt}}
+			updated := created
+			if t.updated {
+				updated.UpdatedAt = t.UpdatedAt
+				events = append(events, seedEvent{task.ActionUpdate, &created, &updated, t.UpdatedAt})
+			}
+			if t.DeletedAt != nil {
+				deleted := t.Task
+				events = append(events, seedEvent{task.ActionDelete, &updated, &deleted, *t.DeletedAt})
+			}
+			for _, e := range events {
+				before, err := snapshot(e.before)
+				if err != nil {
+					return err
+				}
+				after, err := snapshot(e.after)
+				if err != nil {
+					return err
+				}
+				eventValues = append(eventValues, t.Id, string(e.action), seedUserAgent, before, after, e.at)
+			}
+		}
+
+		err := db.Transact(ctx, sql.LevelDefault, func(tx *database.DB) error {
+			if err := postgres.PreserveUpdatedAt(ctx, tx); err != nil {
+				return err
+			}
+			if err := tx.BulkInsert(ctx, "tasks", taskColumns, taskValues, ""); err != nil {
+				return err
+			}
+			return tx.BulkInsert(ctx, "audit_events", eventColumns, eventValues, "")
+		})
+		if err != nil {
+			return fmt.Errorf("seed: inserting tasks %d to %d: %v", start, end, err)
+		}
+		log.Infof("seeded %d/%d tasks", end, len(tasks))
+	}
+	return nil
+}
+
+// seedEvent is an audit event of a seeded task.
+type seedEvent struct {
+	action        task.Action
+	before, after *task.Task
+	at            time.Time
+}
+
+func snapshot(t *task.Task) (interface{}, error) {
+	if t == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(t)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot: %v", err)
+	}
+	return string(b), nil
+}
+
+// seedHTTP creates, updates and deletes tasks through the API of the server
+// at o.url. The server assigns IDs and timestamps, so only the names and
+// the mix of updates and deletions follow the seed.
+func seedHTTP(ctx context.Context, o seedOptions, tasks []fakeTask) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		done     int
+	)
+	work := make(chan fakeTask)
+	for k := 0; k < o.concurrency; k++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range work {
+				err := seedOne(ctx, o.url, t)
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				if done++; done%o.batchSize == 0 {
+					log.Infof("seeded %d/%d tasks", done, len(tasks))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, t := range tasks {
+		select {
+		case work <- t:
+		case <-ctx.Done():
+		}
+	}
+	close(work)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+func seedOne(ctx context.Context, baseURL string, t fakeTask) error {
+	body, err := json.Marshal(map[string]string{"name": t.Name})
+	if err != nil {
+		return err
+	}
+	var created task.Task
+	if err := seedRequest(ctx, http.MethodPost, baseURL+"/v1/task", body, &created); err != nil {
+		return err
+	}
+	if t.updated {
+		if err := seedRequest(ctx, http.MethodPost, baseURL+"/v1/task/"+created.Id, body, nil); err != nil {
+			return err
+		}
+	}
+	if t.DeletedAt != nil {
+		if err := seedRequest(ctx, http.MethodDelete, baseURL+"/v1/task/"+created.Id, nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seedRequest sends a request, waiting out rate limiting, and decodes the
+// response into v unless v is nil.
+func seedRequest(ctx context.Context, method, url string, body []byte, v interface{}) error {
+	for {
+		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", seedUserAgent)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			resp.Body.Close()
+			wait := time.Second
+			if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s > 0 {
+				wait = time.Duration(s) * time.Second
+			}
+			select {
+			case <-time.After(wait):
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("seed: %s %s: %s", method, url, resp.Status)
+		}
+		if v == nil {
+			return nil
+		}
+		return json.NewDecoder(resp.Body).Decode(v)
+	}
+}
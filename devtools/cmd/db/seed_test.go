@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGenerateTasksDeterministic(t *testing.T) {
+	parse := func(args ...string) seedOptions {
+		t.Helper()
+		o, err := parseSeedOptions(args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return o
+	}
+	for _, test := range []struct {
+		name string
+		args []string
+	}{
+		{"recent", []string{"-n", "500", "-seed", "42", "-until", "2022-07-01T00:00:00Z"}},
+		{"uniform", []string{"-n", "500", "-seed", "42", "-until", "2022-07-01T00:00:00Z", "-dist", "uniform"}},
+		{"uuidv7", []string{"-n", "500", "-seed", "7", "-until", "2022-07-01T12:30:00+02:00", "-ids", "uuidv7"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			o := parse(test.args...)
+			tasks := generateTasks(o)
+			if again := generateTasks(parse(test.args...)); !reflect.DeepEqual(tasks, again) {
+				t.Fatal("generateTasks() returned different tasks for the same options")
+			}
+
+			if len(tasks) != o.count {
+				t.Fatalf("generateTasks() returned %d tasks, want %d", len(tasks), o.count)
+			}
+			from := o.until.Add(-time.Duration(o.days) * 24 * time.Hour)
+			ids := map[string]bool{}
+			for k, tk := range tasks {
+				if ids[tk.Id] {
+					t.Errorf("task %d has the ID %q of an earlier task", k, tk.Id)
+				}
+				ids[tk.Id] = true
+				if k > 0 && tk.CreatedAt.Before(tasks[k-1].CreatedAt) {
+					t.Errorf("task %d was created before task %d", k, k-1)
+				}
+				if tk.CreatedAt.Before(from) || tk.CreatedAt.After(o.until) {
+					t.Errorf("task %d was created at %v, not between %v and %v", k, tk.CreatedAt, from, o.until)
+				}
+				if tk.UpdatedAt.Before(tk.CreatedAt) || tk.UpdatedAt.After(o.until) {
+					t.Errorf("task %d was updated at %v, not between its creation at %v and %v", k, tk.UpdatedAt, tk.CreatedAt, o.until)
+				}
+				if tk.DeletedAt != nil && (tk.DeletedAt.Before(tk.UpdatedAt) || tk.DeletedAt.After(o.until)) {
+					t.Errorf("task %d was deleted at %v, not between its update at %v and %v", k, *tk.DeletedAt, tk.UpdatedAt, o.until)
+				}
+			}
+		})
+	}
+
+	// Another seed or -until gives other tasks.
+	a := generateTasks(parse("-n", "10", "-seed", "1", "-until", "2022-07-01T00:00:00Z"))
+	for _, args := range [][]string{
+		{"-n", "10", "-seed", "2", "-until", "2022-07-01T00:00:00Z"},
+		{"-n", "10", "-seed", "1", "-until", "2022-07-02T00:00:00Z"},
+	} {
+		if b := generateTasks(parse(args...)); reflect.DeepEqual(a, b) {
+			t.Errorf("generateTasks() with %q returned the same tasks as with seed 1 until 2022-07-01", args)
+		}
+	}
+}
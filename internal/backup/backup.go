@@ -0,0 +1,334 @@
+// Package backup defines a logical archive of all task data, which storage
+// backends export and import without holding it in memory.
+//
+// An archive is a stream of JSON lines. The first line holds a Header, each
+// following line a row of a table, and the last line a Manifest with the
+// row count and SHA-256 checksum of every table. Rows are task.Task values
+// in the tasks table and task.AuditEvent values in the audit_events table.
+package backup
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/urvil38/todo-app/internal/task"
+)
+
+const (
+	// Format identifies archives in their header.
+	Format = "todo-app-backup"
+	// Version is the version of the archive format written by Writer.
+	// Readers accept archives of this version or older.
+	Version = 1
+
+	TableTasks       = "tasks"
+	TableAuditEvents = "audit_events"
+
+	// maxLineSize bounds the size of a single line when reading.
+	maxLineSize = 4 << 20
+)
+
+// Header is the first line of an archive.
+type Header struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	// Source is the storage the archive was exported from.
+	Source string `json:"source,omitempty"`
+}
+
+// Manifest is the last line of an archive. An archive without one was
+// truncated.
+type Manifest struct {
+	Tables map[string]TableSummary `json:"tables"`
+}
+
+// TableSummary describes the rows of a table in an archive. SHA256 is the
+// hex-encoded checksum of the JSON encoding of every row, each followed by
+// a newline, in archive order.
+type TableSummary struct {
+	Rows   int64  `json:"rows"`
+	SHA256 string `json:"sha256"`
+}
+
+// line is a line of an archive. Exactly one of Header, Row and Manifest is
+// set, and Table is set with Row.
+type line struct {
+	Header   *Header         `json:"header,omitempty"`
+	Table    string          `json:"table,omitempty"`
+	Row      json.RawMessage `json:"row,omitempty"`
+	Manifest *Manifest       `json:"manifest,omitempty"`
+}
+
+// table accumulates the summary of a table while it is written or read.
+type table struct {
+	rows int64
+	hash interface {
+		io.Writer
+		Sum([]byte) []byte
+	}
+}
+
+func (t *table) add(row []byte) {
+	t.rows++
+	t.hash.Write(row)
+	t.hash.Write([]byte{'\n'})
+}
+
+func (t *table) summary() TableSummary {
+	return TableSummary{Rows: t.rows, SHA256: hex.EncodeToString(t.hash.Sum(nil))}
+}
+
+func newTables() map[string]*table {
+	return map[string]*table{
+		TableTasks:       {hash: sha256.New()},
+		TableAuditEvents: {hash: sha256.New()},
+	}
+}
+
+// Writer writes an archive.
+type Writer struct {
+	w      *bufio.Writer
+	tables map[string]*table
+	err    error
+}
+
+// NewWriter writes the header of an archive exported from source to w.
+func NewWriter(w io.Writer, source string) (*Writer, error) {
+	bw := &Writer{w: bufio.NewWriter(w), tables: newTables()}
+	h := Header{Format: Format, Version: Version, CreatedAt: time.Now().UTC(), Source: source}
+	if err := bw.writeLine(line{Header: &h}); err != nil {
+		return nil, err
+	}
+	return bw, nil
+}
+
+// WriteTask adds a task to the archive.
+func (w *Writer) WriteTask(t task.Task) error {
+	return w.writeRow(TableTasks, t)
+}
+
+// WriteAuditEvent adds an audit event to the archive.
+func (w *Writer) WriteAuditEvent(e task.AuditEvent) error {
+	return w.writeRow(TableAuditEvents, e)
+}
+
+func (w *Writer) writeRow(name string, v interface{}) error {
+	if w.err != nil {
+		return w.err
+	}
+	row, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("backup: %v", err)
+	}
+	if err := w.writeLine(line{Table: name, Row: row}); err != nil {
+		return err
+	}
+	w.tables[name].add(row)
+	return nil
+}
+
+func (w *Writer) writeLine(l line) error {
+	b, err := json.Marshal(l)
+	if err == nil {
+		b = append(b, '\n')
+		_, err = w.w.Write(b)
+	}
+	if err != nil {
+		w.err = fmt.Errorf("backup: %v", err)
+	}
+	return w.err
+}
+
+// Rows returns the number of rows of the named table written so far.
+func (w *Writer) Rows(name string) int64 {
+	if t, ok := w.tables[name]; ok {
+		return t.rows
+	}
+	return 0
+}
+
+// Close writes the manifest and flushes the archive. It does not close the
+// underlying io.Writer.
+func (w *Writer) Close() error {
+	m := Manifest{Tables: map[string]TableSummary{}}
+	for name, t := range w.tables {
+		m.Tables[name] = t.summary()
+	}
+	if err := w.writeLine(line{Manifest: &m}); err != nil {
+		return err
+	}
+	if err := w.w.Flush(); err != nil {
+		return fmt.Errorf("backup: %v", err)
+	}
+	return nil
+}
+
+var (
+	// ErrCorrupt is returned when an archive does not match its manifest,
+	// or is not a valid archive.
+	ErrCorrupt = errors.New("backup: corrupt archive")
+	// ErrTruncated is returned when an archive ends before its manifest.
+	ErrTruncated = errors.New("backup: truncated archive")
+)
+
+// Handler receives the rows of an archive. Nil fields skip their table.
+type Handler struct {
+	Task       func(task.Task) error
+	AuditEvent func(task.AuditEvent) error
+}
+
+// Read reads the archive in r, calling h for every row. Since the manifest
+// comes last, the rows are only known to be intact once Read returns nil:
+// callers must be able to discard what they did with them on error.
+func Read(r io.Reader, h Handler) (Header, error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, maxLineSize)
+	next := func() (line, bool, error) {
+		if !s.Scan() {
+			if err := s.Err(); err != nil {
+				return line{}, false, fmt.Errorf("backup: %v", err)
+			}
+			return line{}, false, nil
+		}
+		var l line
+		if err := json.Unmarshal(s.Bytes(), &l); err != nil {
+			return line{}, false, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		return l, true, nil
+	}
+
+	l, ok, err := next()
+	if err != nil {
+		return Header{}, err
+	}
+	if !ok {
+		return Header{}, ErrTruncated
+	}
+	if l.Header == nil || l.Header.Format != Format {
+		return Header{}, fmt.Errorf("%w: missing header", ErrCorrupt)
+	}
+	header := *l.Header
+	if header.Version > Version {
+		return header, fmt.Errorf("backup: archive version %d is newer than %d, the latest supported", header.Version, Version)
+	}
+
+	tables := newTables()
+	for {
+		l, ok, err := next()
+		if err != nil {
+			return header, err
+		}
+		if !ok {
+			return header, ErrTruncated
+		}
+		if l.Manifest != nil {
+			if s.Scan() {
+				return header, fmt.Errorf("%w: data after manifest", ErrCorrupt)
+			}
+			return header, verify(tables, *l.Manifest)
+		}
+		t, ok := tables[l.Table]
+		if !ok {
+			return header, fmt.Errorf("%w: unknown table %q", ErrCorrupt, l.Table)
+		}
+		t.add(l.Row)
+		if err := handleRow(l.Table, l.Row, h); err != nil {
+			return header, err
+		}
+	}
+}
+
+func handleRow(name string, row json.RawMessage, h Handler) error {
+	switch name {
+	case TableTasks:
+		if h.Task == nil {
+			return nil
+		}
+		var t task.Task
+		if err := json.Unmarshal(row, &t); err != nil {
+			return fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		return h.Task(t)
+	case TableAuditEvents:
+		if h.AuditEvent == nil {
+			return nil
+		}
+		var e task.AuditEvent
+		if err := json.Unmarshal(row, &e); err != nil {
+			return fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		return h.AuditEvent(e)
+	}
+	return nil
+}
+
+func verify(tables map[string]*table, m Manifest) error {
+	for name, t := range tables {
+		want, ok := m.Tables[name]
+		if !ok {
+			want = TableSummary{Rows: 0, SHA256: hex.EncodeToString(sha256.New().Sum(nil))}
+		}
+		if got := t.summary(); got != want {
+			return fmt.Errorf("%w: table %s has %d rows with checksum %s, manifest says %d rows with checksum %s",
+				ErrCorrupt, name, got.Rows, got.SHA256, want.Rows, want.SHA256)
+		}
+	}
+	return nil
+}
+
+// ConflictPolicy says what restoring does with a task whose ID already
+// exists.
+type ConflictPolicy string
+
+const (
+	// ConflictFail aborts the restore, changing nothing.
+	ConflictFail ConflictPolicy = "fail"
+	// ConflictSkip keeps the existing task.
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictOverwrite replaces the existing task.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+)
+
+// ParseConflictPolicy validates s as a ConflictPolicy.
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(s); p {
+	case ConflictFail, ConflictSkip, ConflictOverwrite:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unsupported conflict policy: %q", s)
+	}
+}
+
+// ErrConflict is returned by restores with ConflictFail when a task already
+// exists.
+var ErrConflict = errors.New("backup: task already exists")
+
+// Result counts what a restore did.
+type Result struct {
+	Tasks       int `json:"tasks"`
+	Skipped     int `json:"skipped"`
+	Overwritten int `json:"overwritten"`
+	AuditEvents int `json:"audit_events"`
+	// SkippedAuditEvents counts the audit events that were already present,
+	// because the archive was restored before.
+	SkippedAuditEvents int `json:"skipped_audit_events"`
+}
+
+// Exporter is implemented by storages that can export all their task data.
+type Exporter interface {
+	ExportBackup(ctx context.Context, w *Writer) error
+}
+
+// Importer is implemented by storages that can restore an archive. An
+// import either applies the whole archive or, on error, nothing.
+type Importer interface {
+	ImportBackup(ctx context.Context, r io.Reader, policy ConflictPolicy) (Result, error)
+}
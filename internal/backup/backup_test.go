@@ -0,0 +1,93 @@
+package backup
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urvil38/todo-app/internal/task"
+)
+
+func writeArchive(t *testing.T, tasks []task.Task, events []task.AuditEvent) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tk := range tasks {
+		if err := w.WriteTask(tk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, e := range events {
+		if err := w.WriteAuditEvent(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	tasks := []task.Task{
+		{Id: "a", Name: "first <b>", CreatedAt: now, UpdatedAt: now},
+		{Id: "b", Name: "second", CreatedAt: now, UpdatedAt: now, DeletedAt: &now, LegacyId: "2"},
+	}
+	events := []task.AuditEvent{{Id: "1", TaskId: "a", Action: task.ActionCreate, After: &tasks[0], CreatedAt: now}}
+
+	var gotTasks []task.Task
+	var gotEvents []task.AuditEvent
+	h, err := Read(bytes.NewReader(writeArchive(t, tasks, events)), Handler{
+		Task:       func(tk task.Task) error { gotTasks = append(gotTasks, tk); return nil },
+		AuditEvent: func(e task.AuditEvent) error { gotEvents = append(gotEvents, e); return nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Format != Format || h.Version != Version || h.Source != "test" {
+		t.Errorf("header = %+v", h)
+	}
+	if len(gotTasks) != 2 || gotTasks[0].Name != "first <b>" || gotTasks[1].DeletedAt == nil || gotTasks[1].LegacyId != "2" {
+		t.Errorf("tasks = %+v", gotTasks)
+	}
+	if len(gotEvents) != 1 || gotEvents[0].After == nil || gotEvents[0].After.Id != "a" {
+		t.Errorf("events = %+v", gotEvents)
+	}
+}
+
+func TestReadDamaged(t *testing.T) {
+	archive := string(writeArchive(t, []task.Task{{Id: "a", Name: "first"}, {Id: "b", Name: "second"}}, nil))
+	lines := strings.SplitAfter(archive, "\n")
+
+	for _, test := range []struct {
+		name    string
+		archive string
+		want    error
+	}{
+		{"empty", "", ErrTruncated},
+		{"no manifest", strings.Join(lines[:3], ""), ErrTruncated},
+		{"missing row", lines[0] + lines[1] + lines[3], ErrCorrupt},
+		{"changed row", strings.Replace(archive, "second", "secund", 1), ErrCorrupt},
+		{"not an archive", "{}\n", ErrCorrupt},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Read(strings.NewReader(test.archive), Handler{})
+			if !errors.Is(err, test.want) {
+				t.Errorf("Read() = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestReadNewerVersion(t *testing.T) {
+	archive := `{"header":{"format":"todo-app-backup","version":99}}` + "\n"
+	if _, err := Read(strings.NewReader(archive), Handler{}); err == nil || errors.Is(err, ErrTruncated) {
+		t.Errorf("Read() = %v, want a version error", err)
+	}
+}
@@ -0,0 +1,112 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/urvil38/todo-app/internal/task"
+	"go.etcd.io/bbolt"
+	"go.opencensus.io/trace"
+)
+
+// insertAuditEvent records a task mutation in the same transaction as the
+// mutation itself.
+func insertAuditEvent(ctx context.Context, tx *bbolt.Tx, action task.Action, taskID string, before, after *task.Task) error {
+	b := tx.Bucket(auditBucket)
+	n, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	e := task.NewAuditEvent(ctx, action, taskID, before, after)
+	e.Id = strconv.FormatUint(n, 10)
+	v, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := b.Put(seqKey(n), v); err != nil {
+		return err
+	}
+	return tx.Bucket(auditTaskBucket).Put(auditTaskKey(taskID, n), nil)
+}
+
+// auditTaskKey returns the key of the per-task audit index, which sorts by
+// task ID and then by event sequence.
+func auditTaskKey(taskID string, n uint64) []byte {
+	return append(append([]byte(taskID), 0), seqKey(n)...)
+}
+
+func getAuditEvent(tx *bbolt.Tx, key []byte) (e task.AuditEvent, err error) {
+	err = json.Unmarshal(tx.Bucket(auditBucket).Get(key), &e)
+	return e, err
+}
+
+func (tm *TaskManager) TaskHistory(ctx context.Context, id string) ([]task.AuditEvent, error) {
+	ctx, span := trace.StartSpan(ctx, "bolt.TaskHistory")
+	defer span.End()
+
+	var events []task.AuditEvent
+	err := tm.db.View(func(tx *bbolt.Tx) error {
+		prefix := append([]byte(id), 0)
+		c := tx.Bucket(auditTaskBucket).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && len(k) == len(prefix)+8 && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			e, err := getAuditEvent(tx, k[len(prefix):])
+			if err != nil {
+				return err
+			}
+			events = append(events, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (tm *TaskManager) ListAuditEvents(ctx context.Context, f task.AuditFilter) ([]task.AuditEvent, error) {
+	ctx, span := trace.StartSpan(ctx, "bolt.ListAuditEvents")
+	defer span.End()
+
+	if f.TaskId != "" {
+		history, err := tm.TaskHistory(ctx, f.TaskId)
+		if err != nil {
+			return nil, err
+		}
+		var events []task.AuditEvent
+		for _, e := range history {
+			if f.Match(e) && (f.Limit == 0 || len(events) < f.Limit) {
+				events = append(events, e)
+			}
+		}
+		return events, nil
+	}
+
+	var events []task.AuditEvent
+	err := tm.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(auditBucket).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var e task.AuditEvent
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			// Events are stored in the order they were created.
+			if !f.Until.IsZero() && !e.CreatedAt.Before(f.Until) {
+				return nil
+			}
+			if !f.Match(e) {
+				continue
+			}
+			events = append(events, e)
+			if f.Limit > 0 && len(events) == f.Limit {
+				return nil
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,174 @@
+// Package bolt stores tasks in an embedded bbolt key-value file, giving a
+// single binary with durable storage and no external database.
+//
+// Tasks are stored as JSON in the tasks bucket, keyed by ID. Secondary
+// index buckets map the creation time of the tasks outside the trash, the
+// update time of every task and the deletion time of the tasks in the trash
+// to IDs, so that ordered listing, pagination and range queries do not scan
+// every task.
+package bolt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/urvil38/todo-app/internal/config"
+	"github.com/urvil38/todo-app/internal/log"
+	"github.com/urvil38/todo-app/internal/task"
+	"go.etcd.io/bbolt"
+)
+
+var (
+	tasksBucket      = []byte("tasks")
+	createdIdxBucket = []byte("idx_created")
+	updatedIdxBucket = []byte("idx_updated")
+	deletedIdxBucket = []byte("idx_deleted")
+	auditBucket      = []byte("audit")
+	auditTaskBucket  = []byte("idx_audit_task")
+)
+
+type TaskManager struct {
+	db  *bbolt.DB
+	ids task.IDGenerator
+}
+
+func NewTaskManager(cfg config.Config) *TaskManager {
+	tm, err := Open(cfg.BoltPath, task.NewIDGenerator(task.IDScheme(cfg.IDScheme)))
+	if err != nil {
+		log.Logger.Fatal(err)
+	}
+	return tm
+}
+
+// Open opens the bbolt file at path, creating it and its buckets if needed.
+// New tasks are given IDs from ids.
+func Open(path string, ids task.IDGenerator) (*TaskManager, error) {
+	log.Logger.Infof("opening bolt database %s", path)
+	db, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("bbolt.Open(%q): %w", path, err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, b := range [][]byte{tasksBucket, createdIdxBucket, updatedIdxBucket, deletedIdxBucket, auditBucket, auditTaskBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &TaskManager{db: db, ids: ids}, nil
+}
+
+// Close closes the database file.
+func (tm *TaskManager) Close() error {
+	return tm.db.Close()
+}
+
+// timeKey returns an index key that sorts by t, then by id.
+func timeKey(t time.Time, id string) []byte {
+	k := make([]byte, 8, 8+len(id))
+	binary.BigEndian.PutUint64(k, uint64(t.UnixNano()))
+	return append(k, id...)
+}
+
+// timePrefix returns the smallest index key for t.
+func timePrefix(t time.Time) []byte {
+	return timeKey(t, "")
+}
+
+// seqKey encodes a sequence number so that keys sort numerically.
+func seqKey(n uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, n)
+	return k
+}
+
+// getTask reads the task with the given ID.
+func getTask(tx *bbolt.Tx, id string) (t task.Task, ok bool, err error) {
+	v := tx.Bucket(tasksBucket).Get([]byte(id))
+	if v == nil {
+		return t, false, nil
+	}
+	if err := json.Unmarshal(v, &t); err != nil {
+		return t, false, fmt.Errorf("unable to decode task %s: %w", id, err)
+	}
+	return t, true, nil
+}
+
+// putTask stores t and keeps the indexes in sync with old, the previous
+// state of the task, which is nil for new tasks.
+func putTask(tx *bbolt.Tx, old *task.Task, t task.Task) error {
+	v, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(tasksBucket).Put([]byte(t.Id), v); err != nil {
+		return err
+	}
+	if old != nil {
+		if err := removeIndexes(tx, *old); err != nil {
+			return err
+		}
+	}
+	if err := tx.Bucket(updatedIdxBucket).Put(timeKey(t.UpdatedAt, t.Id), []byte(t.Id)); err != nil {
+		return err
+	}
+	if t.DeletedAt != nil {
+		return tx.Bucket(deletedIdxBucket).Put(timeKey(*t.DeletedAt, t.Id), []byte(t.Id))
+	}
+	return tx.Bucket(createdIdxBucket).Put(timeKey(t.CreatedAt, t.Id), []byte(t.Id))
+}
+
+// deleteTask permanently removes t and its index entries.
+func deleteTask(tx *bbolt.Tx, t task.Task) error {
+	if err := tx.Bucket(tasksBucket).Delete([]byte(t.Id)); err != nil {
+		return err
+	}
+	return removeIndexes(tx, t)
+}
+
+func removeIndexes(tx *bbolt.Tx, t task.Task) error {
+	if err := tx.Bucket(updatedIdxBucket).Delete(timeKey(t.UpdatedAt, t.Id)); err != nil {
+		return err
+	}
+	if t.DeletedAt != nil {
+		return tx.Bucket(deletedIdxBucket).Delete(timeKey(*t.DeletedAt, t.Id))
+	}
+	return tx.Bucket(createdIdxBucket).Delete(timeKey(t.CreatedAt, t.Id))
+}
+
+// scanIndex calls f for the tasks referenced by the index bucket idx, in
+// index order, starting at the key from (or the beginning if nil) and
+// stopping before the key to (or the end if nil), or when f returns false.
+func scanIndex(tx *bbolt.Tx, idx, from, to []byte, f func(task.Task) bool) error {
+	c := tx.Bucket(idx).Cursor()
+	var k, v []byte
+	if from == nil {
+		k, v = c.First()
+	} else {
+		k, v = c.Seek(from)
+	}
+	for ; k != nil; k, v = c.Next() {
+		if to != nil && bytes.Compare(k, to) >= 0 {
+			return nil
+		}
+		t, ok, err := getTask(tx, string(v))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("index %s references missing task %s", idx, v)
+		}
+		if !f(t) {
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package bolt
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urvil38/todo-app/internal/task"
+	"github.com/urvil38/todo-app/internal/task/tasktest"
+	"go.etcd.io/bbolt"
+)
+
+func TestTaskManager(t *testing.T) {
+	tasktest.RunManagerTests(t, func(t *testing.T) task.Manager {
+		tm, err := Open(filepath.Join(t.TempDir(), "todo.bolt"), task.NewIDGenerator(task.IDSchemeULID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { tm.Close() })
+		return tm
+	})
+}
+
+func openTest(t *testing.T) *TaskManager {
+	t.Helper()
+	tm, err := Open(filepath.Join(t.TempDir(), "todo.bolt"), task.NewIDGenerator(task.IDSchemeULID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tm.Close() })
+	return tm
+}
+
+func TestListTasksPage(t *testing.T) {
+	ctx := context.Background()
+	tm := openTest(t)
+	var want []string
+	for k := 0; k < 7; k++ {
+		tk, err := tm.CreateTask(ctx, fmt.Sprintf("task %d", k))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k == 2 || k == 5 {
+			if err := tm.DeleteTask(ctx, tk.Id); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want = append(want, tk.Id)
+	}
+
+	// Tasks in the trash are not in the index listed.
+	tm.db.View(func(tx *bbolt.Tx) error {
+		if n := tx.Bucket(createdIdxBucket).Stats().KeyN; n != len(want) {
+			t.Errorf("%s holds %d tasks, want %d", createdIdxBucket, n, len(want))
+		}
+		return nil
+	})
+
+	for _, limit := range []int{0, 1, 2, 5, 6} {
+		var (
+			got    []string
+			cursor []byte
+			pages  int
+		)
+		for {
+			tasks, next, err := tm.ListTasksPage(ctx, cursor, limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if limit > 0 && len(tasks) > limit {
+				t.Fatalf("limit %d: got a page of %d tasks", limit, len(tasks))
+			}
+			for _, tk := range tasks {
+				got = append(got, tk.Id)
+			}
+			pages++
+			if next == nil {
+				break
+			}
+			cursor = next
+		}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("limit %d: got %v, want %v", limit, got, want)
+		}
+		wantPages := 1
+		if limit > 0 && limit < len(want) {
+			wantPages = (len(want) + limit - 1) / limit
+		}
+		if pages != wantPages {
+			t.Errorf("limit %d: got %d pages, want %d", limit, pages, wantPages)
+		}
+	}
+}
+
+func TestListTasksUpdatedSince(t *testing.T) {
+	ctx := context.Background()
+	tm := openTest(t)
+	a, _ := tm.CreateTask(ctx, "a")
+	b, _ := tm.CreateTask(ctx, "b")
+	c, _ := tm.CreateTask(ctx, "c")
+	since := c.UpdatedAt.Add(time.Nanosecond)
+
+	if _, err := tm.UpdateTask(ctx, b.Id, "b2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tm.DeleteTask(ctx, a.Id); err != nil {
+		t.Fatal(err)
+	}
+	got, err := tm.ListTasksUpdatedSince(ctx, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Id != b.Id || got[0].Name != "b2" || got[1].Id != a.Id || got[1].DeletedAt == nil {
+		t.Errorf("ListTasksUpdatedSince() = %+v, want b2, then a in the trash", got)
+	}
+
+	all, err := tm.ListTasksUpdatedSince(ctx, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 || all[0].Id != c.Id || all[1].Id != b.Id || all[2].Id != a.Id {
+		t.Errorf("ListTasksUpdatedSince(zero) = %+v, want c, b, a", all)
+	}
+}
@@ -0,0 +1,174 @@
+package bolt
+
+import (
+	"context"
+	"time"
+
+	"github.com/urvil38/todo-app/internal/task"
+	"go.etcd.io/bbolt"
+	"go.opencensus.io/trace"
+)
+
+func (tm *TaskManager) CreateTask(ctx context.Context, name string) (t task.Task, err error) {
+	ctx, span := trace.StartSpan(ctx, "bolt.CreateTask")
+	defer span.End()
+
+	if err := task.ValidateName(name); err != nil {
+		return task.Task{}, err
+	}
+
+	err = tm.db.Update(func(tx *bbolt.Tx) error {
+		now := time.Now()
+		t = task.Task{
+			Id:        tm.ids.NewID(now),
+			Name:      name,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if err := putTask(tx, nil, t); err != nil {
+			return err
+		}
+		return insertAuditEvent(ctx, tx, task.ActionCreate, t.Id, nil, &t)
+	})
+	if err != nil {
+		return task.Task{}, err
+	}
+	task.RecordTaskCreate(ctx)
+	return t, nil
+}
+
+func (tm *TaskManager) UpdateTask(ctx context.Context, id, name string) (t task.Task, err error) {
+	ctx, span := trace.StartSpan(ctx, "bolt.UpdateTask")
+	defer span.End()
+
+	if err := task.ValidateName(name); err != nil {
+		return task.Task{}, err
+	}
+
+	err = tm.db.Update(func(tx *bbolt.Tx) error {
+		before, ok, err := getTask(tx, id)
+		if err != nil {
+			return err
+		}
+		if !ok || before.DeletedAt != nil {
+			return task.ErrTaskNotFound
+		}
+		t = before
+		t.Name = name
+		t.UpdatedAt = time.Now()
+		if err := putTask(tx, &before, t); err != nil {
+			return err
+		}
+		return insertAuditEvent(ctx, tx, task.ActionUpdate, t.Id, &before, &t)
+	})
+	if err != nil {
+		return task.Task{}, err
+	}
+	task.RecordTaskUpdate(ctx)
+	return t, nil
+}
+
+func (tm *TaskManager) DeleteTask(ctx context.Context, id string) error {
+	ctx, span := trace.StartSpan(ctx, "bolt.DeleteTask")
+	defer span.End()
+
+	err := tm.db.Update(func(tx *bbolt.Tx) error {
+		before, ok, err := getTask(tx, id)
+		if err != nil {
+			return err
+		}
+		if !ok || before.DeletedAt != nil {
+			return task.ErrTaskNotFound
+		}
+		t := before
+		now := time.Now()
+		t.DeletedAt, t.UpdatedAt = &now, now
+		if err := putTask(tx, &before, t); err != nil {
+			return err
+		}
+		return insertAuditEvent(ctx, tx, task.ActionDelete, t.Id, &before, &t)
+	})
+	if err != nil {
+		return err
+	}
+	task.RecordTaskDelete(ctx)
+	return nil
+}
+
+func (tm *TaskManager) GetTask(ctx context.Context, id string) (t task.Task, err error) {
+	ctx, span := trace.StartSpan(ctx, "bolt.GetTask")
+	defer span.End()
+
+	err = tm.db.View(func(tx *bbolt.Tx) error {
+		var ok bool
+		t, ok, err = getTask(tx, id)
+		if err != nil {
+			return err
+		}
+		if !ok || t.DeletedAt != nil {
+			return task.ErrTaskNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return task.Task{}, err
+	}
+	return t, nil
+}
+
+// ListTasks returns the tasks that are not in the trash, oldest first.
+func (tm *TaskManager) ListTasks(ctx context.Context) ([]task.Task, error) {
+	ctx, span := trace.StartSpan(ctx, "bolt.ListTasks")
+	defer span.End()
+
+	tasks, _, err := tm.ListTasksPage(ctx, nil, 0)
+	return tasks, err
+}
+
+// ListTasksPage returns up to limit tasks that are not in the trash, oldest
+// first, starting at the given cursor. It also returns the cursor of the
+// next page, which is nil when there are no more tasks. A nil cursor starts
+// at the beginning and a limit of zero returns all remaining tasks.
+func (tm *TaskManager) ListTasksPage(ctx context.Context, cursor []byte, limit int) (tasks []task.Task, next []byte, err error) {
+	ctx, span := trace.StartSpan(ctx, "bolt.ListTasksPage")
+	defer span.End()
+
+	err = tm.db.View(func(tx *bbolt.Tx) error {
+		return scanIndex(tx, createdIdxBucket, cursor, nil, func(t task.Task) bool {
+			if limit > 0 && len(tasks) == limit {
+				next = timeKey(t.CreatedAt, t.Id)
+				return false
+			}
+			tasks = append(tasks, t)
+			return true
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return tasks, next, nil
+}
+
+// ListTasksUpdatedSince returns the tasks, including trashed ones, that were
+// changed at or after since, or every task if since is zero, in the order
+// they were changed.
+func (tm *TaskManager) ListTasksUpdatedSince(ctx context.Context, since time.Time) ([]task.Task, error) {
+	ctx, span := trace.StartSpan(ctx, "bolt.ListTasksUpdatedSince")
+	defer span.End()
+
+	var from []byte
+	if !since.IsZero() {
+		from = timePrefix(since)
+	}
+	var tasks []task.Task
+	err := tm.db.View(func(tx *bbolt.Tx) error {
+		return scanIndex(tx, updatedIdxBucket, from, nil, func(t task.Task) bool {
+			tasks = append(tasks, t)
+			return true
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
@@ -0,0 +1,105 @@
+package bolt
+
+import (
+	"context"
+	"time"
+
+	"github.com/urvil38/todo-app/internal/task"
+	"go.etcd.io/bbolt"
+	"go.opencensus.io/trace"
+)
+
+// ListTrash returns the tasks in the trash in the order they were deleted.
+func (tm *TaskManager) ListTrash(ctx context.Context) ([]task.Task, error) {
+	ctx, span := trace.StartSpan(ctx, "bolt.ListTrash")
+	defer span.End()
+
+	var tasks []task.Task
+	err := tm.db.View(func(tx *bbolt.Tx) error {
+		return scanIndex(tx, deletedIdxBucket, nil, nil, func(t task.Task) bool {
+			tasks = append(tasks, t)
+			return true
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+func (tm *TaskManager) RestoreTask(ctx context.Context, id string) (t task.Task, err error) {
+	ctx, span := trace.StartSpan(ctx, "bolt.RestoreTask")
+	defer span.End()
+
+	err = tm.db.Update(func(tx *bbolt.Tx) error {
+		before, ok, err := getTask(tx, id)
+		if err != nil {
+			return err
+		}
+		if !ok || before.DeletedAt == nil {
+			return task.ErrTaskNotFound
+		}
+		t = before
+		t.DeletedAt = nil
+		t.UpdatedAt = time.Now()
+		if err := putTask(tx, &before, t); err != nil {
+			return err
+		}
+		return insertAuditEvent(ctx, tx, task.ActionRestore, t.Id, &before, &t)
+	})
+	if err != nil {
+		return task.Task{}, err
+	}
+	return t, nil
+}
+
+func (tm *TaskManager) PurgeTask(ctx context.Context, id string) error {
+	ctx, span := trace.StartSpan(ctx, "bolt.PurgeTask")
+	defer span.End()
+
+	return tm.db.Update(func(tx *bbolt.Tx) error {
+		t, ok, err := getTask(tx, id)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return task.ErrTaskNotFound
+		}
+		if err := deleteTask(tx, t); err != nil {
+			return err
+		}
+		return insertAuditEvent(ctx, tx, task.ActionPurge, t.Id, &t, nil)
+	})
+}
+
+func (tm *TaskManager) PurgeTrash(ctx context.Context, before time.Time) (n int, err error) {
+	ctx, span := trace.StartSpan(ctx, "bolt.PurgeTrash")
+	defer span.End()
+
+	err = tm.db.Update(func(tx *bbolt.Tx) error {
+		n = 0
+		var purged []task.Task
+		err := scanIndex(tx, deletedIdxBucket, nil, timePrefix(before), func(t task.Task) bool {
+			purged = append(purged, t)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		// Delete after scanning, since deleting moves the cursor.
+		for k := range purged {
+			if err := deleteTask(tx, purged[k]); err != nil {
+				return err
+			}
+			if err := insertAuditEvent(ctx, tx, task.ActionPurge, purged[k].Id, &purged[k], nil); err != nil {
+				return err
+			}
+		}
+		n = len(purged)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
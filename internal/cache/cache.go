@@ -0,0 +1,358 @@
+// Package cache serves repeated task lookups from memory, in front of any
+// task.Manager.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/urvil38/todo-app/internal/task"
+	"go.opencensus.io/trace"
+	"golang.org/x/sync/singleflight"
+)
+
+// Config configures a TaskManager.
+type Config struct {
+	// Size is the maximum number of lookups cached. When the cache is
+	// full, the least recently used one is evicted.
+	Size int
+	// TTL is how long a task is cached. Zero means until it is evicted or
+	// invalidated.
+	TTL time.Duration
+	// NegativeTTL is how long the absence of a task is cached. Zero
+	// disables negative caching.
+	NegativeTTL time.Duration
+}
+
+// TaskManager is a task.Manager that caches the results of GetTask of the
+// Manager it wraps, including task.ErrTaskNotFound. Concurrent lookups of
+// the same task that miss the cache share a single call to GetTask, which
+// reads the primary database.
+//
+// The writes made through the TaskManager invalidate the tasks they change.
+// Writes made by others, such as other servers sharing a database, are only
+// seen once the cached lookups expire, unless they are reported with
+// Invalidate or Purge.
+//
+// Within a unit of work started with Transact, lookups bypass the cache,
+// and the tasks written are invalidated again when the work ends, since
+// others may have cached them as they were until it was committed.
+type TaskManager struct {
+	m   task.Manager
+	cfg Config
+	now func() time.Time
+
+	flights singleflight.Group
+
+	mu      sync.Mutex
+	lru     list.List // of *entry, the most recently used first
+	entries map[string]*list.Element
+	// keys maps the IDs and legacy IDs of the cached tasks to the keys
+	// they were looked up with.
+	keys map[string]map[string]bool
+	// gen counts invalidations. A lookup is only cached if none happened
+	// while it ran, since it may have read what was invalidated.
+	gen uint64
+}
+
+type entry struct {
+	key     string
+	task    task.Task
+	err     error // task.ErrTaskNotFound, possibly wrapped, or nil
+	expires time.Time
+}
+
+// New returns a TaskManager that caches the lookups of m.
+func New(m task.Manager, cfg Config) *TaskManager {
+	return &TaskManager{
+		m:       m,
+		cfg:     cfg,
+		now:     time.Now,
+		entries: make(map[string]*list.Element),
+		keys:    make(map[string]map[string]bool),
+	}
+}
+
+// Unwrap returns the task.Manager wrapped by c.
+func (c *TaskManager) Unwrap() task.Manager {
+	return c.m
+}
+
+// Close closes the wrapped task.Manager, if it is an io.Closer.
+func (c *TaskManager) Close() error {
+	if cl, ok := c.m.(io.Closer); ok {
+		return cl.Close()
+	}
+	return nil
+}
+
+func (c *TaskManager) GetTask(ctx context.Context, id string) (task.Task, error) {
+	if c.workFor(ctx) != nil {
+		return c.m.GetTask(ctx, id)
+	}
+	ctx, span := trace.StartSpan(ctx, "cache.GetTask")
+	defer span.End()
+
+	// Fresh reads skip the cache, but refresh it.
+	if task.FreshReadsRequested(ctx) {
+		span.AddAttributes(trace.BoolAttribute("cache.hit", false))
+		task.RecordTaskCacheMiss(ctx)
+		return c.load(ctx, id, c.generation())
+	}
+	t, err, gen, ok := c.lookup(id)
+	span.AddAttributes(trace.BoolAttribute("cache.hit", ok))
+	if ok {
+		task.RecordTaskCacheHit(ctx)
+		return t, err
+	}
+	task.RecordTaskCacheMiss(ctx)
+
+	// Lookups that start after an invalidation do not share the calls
+	// started before it, which may return what was invalidated.
+	key := strconv.FormatUint(gen, 10) + ":" + id
+	v, err, shared := c.flights.Do(key, func() (interface{}, error) {
+		return c.load(ctx, id, gen)
+	})
+	// A shared call fails if the context of the caller that made it is
+	// done, in which case this caller retries without sharing.
+	if shared && isContextErr(err) && ctx.Err() == nil {
+		return c.load(ctx, id, gen)
+	}
+	return v.(task.Task), err
+}
+
+// load calls GetTask of the wrapped Manager, and caches the result unless
+// an invalidation happened since gen was read. It asks for a fresh read, so
+// that what replicas have yet to apply is not cached, and served for a whole
+// TTL.
+func (c *TaskManager) load(ctx context.Context, id string, gen uint64) (task.Task, error) {
+	t, err := c.m.GetTask(task.WithFreshReads(ctx), id)
+	switch {
+	case err == nil:
+		c.store(ctx, &entry{key: id, task: t}, gen)
+	case errors.Is(err, task.ErrTaskNotFound):
+		c.store(ctx, &entry{key: id, err: err}, gen)
+	}
+	return t, err
+}
+
+// lookup returns the cached result of looking up id, if any, along with the
+// generation of the cache.
+func (c *TaskManager) lookup(id string) (_ task.Task, _ error, gen uint64, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[id]
+	if !ok {
+		return task.Task{}, nil, c.gen, false
+	}
+	e := el.Value.(*entry)
+	if !e.expires.IsZero() && !c.now().Before(e.expires) {
+		c.remove(el)
+		return task.Task{}, nil, c.gen, false
+	}
+	c.lru.MoveToFront(el)
+	return e.task, e.err, c.gen, true
+}
+
+func (c *TaskManager) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// store caches e, evicting the least recently used entries if the cache is
+// full, unless an invalidation happened since gen was read.
+func (c *TaskManager) store(ctx context.Context, e *entry, gen uint64) {
+	ttl := c.cfg.TTL
+	if e.err != nil {
+		ttl = c.cfg.NegativeTTL
+		if ttl <= 0 {
+			return
+		}
+	}
+	if c.cfg.Size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		return
+	}
+	if ttl > 0 {
+		e.expires = c.now().Add(ttl)
+	}
+	if el, ok := c.entries[e.key]; ok {
+		c.remove(el)
+	}
+	c.entries[e.key] = c.lru.PushFront(e)
+	if e.err == nil {
+		for _, id := range []string{e.task.Id, e.task.LegacyId} {
+			if id == "" {
+				continue
+			}
+			if c.keys[id] == nil {
+				c.keys[id] = make(map[string]bool)
+			}
+			c.keys[id][e.key] = true
+		}
+	}
+	for c.lru.Len() > c.cfg.Size {
+		c.remove(c.lru.Back())
+		task.RecordTaskCacheEviction(ctx)
+	}
+}
+
+// remove drops the entry of el. c.mu must be held.
+func (c *TaskManager) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*entry)
+	delete(c.entries, e.key)
+	if e.err != nil {
+		return
+	}
+	for _, id := range []string{e.task.Id, e.task.LegacyId} {
+		if keys := c.keys[id]; keys != nil {
+			delete(keys, e.key)
+			if len(keys) == 0 {
+				delete(c.keys, id)
+			}
+		}
+	}
+}
+
+// Invalidate drops the cached lookups of the tasks with the given IDs or
+// legacy IDs, whichever they were looked up with, so that the next lookups
+// read the wrapped Manager.
+func (c *TaskManager) Invalidate(ids ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		if el, ok := c.entries[id]; ok {
+			c.remove(el)
+		}
+		for key := range c.keys[id] {
+			c.remove(c.entries[key])
+		}
+	}
+}
+
+// Purge drops every cached lookup.
+func (c *TaskManager) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	c.lru.Init()
+	c.entries = make(map[string]*list.Element)
+	c.keys = make(map[string]map[string]bool)
+}
+
+// invalidate calls Invalidate, and records the IDs in the unit of work
+// carried by ctx, if any, to invalidate them again when it ends.
+func (c *TaskManager) invalidate(ctx context.Context, ids ...string) {
+	c.Invalidate(ids...)
+	if w := c.workFor(ctx); w != nil {
+		w.mu.Lock()
+		w.ids = append(w.ids, ids...)
+		w.mu.Unlock()
+	}
+}
+
+func (c *TaskManager) ListTasks(ctx context.Context) ([]task.Task, error) {
+	return c.m.ListTasks(ctx)
+}
+
+func (c *TaskManager) CreateTask(ctx context.Context, name string) (task.Task, error) {
+	t, err := c.m.CreateTask(ctx, name)
+	if err == nil {
+		// The task may have been cached as missing.
+		c.invalidate(ctx, t.Id, t.LegacyId)
+	}
+	return t, err
+}
+
+func (c *TaskManager) UpdateTask(ctx context.Context, id, name string) (task.Task, error) {
+	t, err := c.m.UpdateTask(ctx, id, name)
+	c.invalidate(ctx, id, t.Id, t.LegacyId)
+	return t, err
+}
+
+func (c *TaskManager) DeleteTask(ctx context.Context, id string) error {
+	err := c.m.DeleteTask(ctx, id)
+	c.invalidate(ctx, id)
+	return err
+}
+
+func (c *TaskManager) ListTrash(ctx context.Context) ([]task.Task, error) {
+	return c.m.ListTrash(ctx)
+}
+
+func (c *TaskManager) RestoreTask(ctx context.Context, id string) (task.Task, error) {
+	t, err := c.m.RestoreTask(ctx, id)
+	c.invalidate(ctx, id, t.Id, t.LegacyId)
+	return t, err
+}
+
+func (c *TaskManager) PurgeTask(ctx context.Context, id string) error {
+	err := c.m.PurgeTask(ctx, id)
+	c.invalidate(ctx, id)
+	return err
+}
+
+// PurgeTrash invalidates nothing: the tasks in the trash are not returned
+// by GetTask, and were invalidated when they were deleted.
+func (c *TaskManager) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	return c.m.PurgeTrash(ctx, before)
+}
+
+type workKey struct{}
+
+// work records the tasks written in a unit of work started by Transact.
+type work struct {
+	c   *TaskManager
+	mu  sync.Mutex
+	ids []string
+}
+
+// workFor returns the unit of work of c carried by ctx, if any.
+func (c *TaskManager) workFor(ctx context.Context) *work {
+	if w, ok := ctx.Value(workKey{}).(*work); ok && w.c == c {
+		return w
+	}
+	return nil
+}
+
+// Transact calls Transact of the wrapped Manager, or returns
+// task.ErrTransactUnsupported if it is not a task.Transactor.
+func (c *TaskManager) Transact(ctx context.Context, f func(ctx context.Context) error) error {
+	tr, ok := c.m.(task.Transactor)
+	if !ok {
+		return task.ErrTransactUnsupported
+	}
+	if c.workFor(ctx) != nil {
+		// The enclosing unit of work invalidates the writes of this one.
+		return tr.Transact(ctx, f)
+	}
+	w := &work{c: c}
+	defer func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		c.Invalidate(w.ids...)
+	}()
+	return tr.Transact(context.WithValue(ctx, workKey{}, w), f)
+}
+
+func isContextErr(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,208 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/urvil38/todo-app/internal/memory"
+	"github.com/urvil38/todo-app/internal/task"
+	"github.com/urvil38/todo-app/internal/task/tasktest"
+)
+
+func TestTaskManager(t *testing.T) {
+	tasktest.RunManagerTests(t, func(t *testing.T) task.Manager {
+		tm, err := memory.NewTaskManager(memory.Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return New(tm, Config{Size: 100, TTL: time.Minute, NegativeTTL: time.Minute})
+	})
+}
+
+// stubManager serves GetTask from tasks, by ID or legacy ID, and counts the
+// calls, and those that did not ask for fresh reads. If started is set,
+// calls are reported on it, then wait for release.
+type stubManager struct {
+	task.Manager
+
+	mu         sync.Mutex
+	tasks      []task.Task
+	calls      int
+	staleCalls int
+	started    chan struct{}
+	release    chan struct{}
+}
+
+func (m *stubManager) GetTask(ctx context.Context, id string) (task.Task, error) {
+	m.mu.Lock()
+	m.calls++
+	if !task.FreshReadsRequested(ctx) {
+		m.staleCalls++
+	}
+	tasks := m.tasks
+	m.mu.Unlock()
+	if m.started != nil {
+		m.started <- struct{}{}
+		<-m.release
+	}
+	for _, t := range tasks {
+		if t.Id == id || (t.LegacyId != "" && t.LegacyId == id) {
+			return t, nil
+		}
+	}
+	return task.Task{}, task.ErrTaskNotFound
+}
+
+func (m *stubManager) set(tasks ...task.Task) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tasks = tasks
+}
+
+func (m *stubManager) callCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls
+}
+
+// get calls c.GetTask, and checks that the stub was called wantCalls times
+// so far.
+func get(t *testing.T, c *TaskManager, m *stubManager, id string, wantCalls int) (task.Task, error) {
+	t.Helper()
+	got, err := c.GetTask(context.Background(), id)
+	if n := m.callCount(); n != wantCalls {
+		t.Errorf("after GetTask(%q), the wrapped Manager was called %d times, want %d", id, n, wantCalls)
+	}
+	return got, err
+}
+
+func TestCacheHitsAndExpiry(t *testing.T) {
+	m := &stubManager{tasks: []task.Task{{Id: "a", Name: "A"}}}
+	c := New(m, Config{Size: 10, TTL: time.Minute, NegativeTTL: time.Second})
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	if got, err := get(t, c, m, "a", 1); err != nil || got.Name != "A" {
+		t.Errorf("GetTask(a) = %+v, %v", got, err)
+	}
+	get(t, c, m, "a", 1)
+	if _, err := get(t, c, m, "missing", 2); !errors.Is(err, task.ErrTaskNotFound) {
+		t.Errorf("GetTask(missing) = %v, want ErrTaskNotFound", err)
+	}
+	if _, err := get(t, c, m, "missing", 2); !errors.Is(err, task.ErrTaskNotFound) {
+		t.Errorf("cached GetTask(missing) = %v, want ErrTaskNotFound", err)
+	}
+
+	// The missing task expires first.
+	now = now.Add(time.Second)
+	get(t, c, m, "a", 2)
+	get(t, c, m, "missing", 3)
+	now = now.Add(time.Minute)
+	get(t, c, m, "a", 4)
+
+	// Fresh reads skip the cache and refresh it.
+	m.set(task.Task{Id: "a", Name: "A2"})
+	if got, _ := c.GetTask(task.WithFreshReads(context.Background()), "a"); got.Name != "A2" {
+		t.Errorf("fresh GetTask(a) = %+v, want A2", got)
+	}
+	if got, _ := get(t, c, m, "a", 5); got.Name != "A2" {
+		t.Errorf("GetTask(a) after a fresh read = %+v, want A2", got)
+	}
+
+	// The cache is only filled from the primary.
+	if m.staleCalls != 0 {
+		t.Errorf("%d lookups of the wrapped Manager did not ask for fresh reads", m.staleCalls)
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	m := &stubManager{tasks: []task.Task{{Id: "a"}, {Id: "b"}, {Id: "c"}}}
+	c := New(m, Config{Size: 2})
+
+	get(t, c, m, "a", 1)
+	get(t, c, m, "b", 2)
+	get(t, c, m, "a", 2)
+	get(t, c, m, "c", 3) // evicts b, the least recently used
+	get(t, c, m, "a", 3)
+	get(t, c, m, "b", 4)
+}
+
+func TestCacheInvalidate(t *testing.T) {
+	m := &stubManager{tasks: []task.Task{{Id: "a", LegacyId: "7"}, {Id: "b"}}}
+	c := New(m, Config{Size: 10, NegativeTTL: time.Minute})
+
+	get(t, c, m, "7", 1)
+	get(t, c, m, "b", 2)
+	get(t, c, m, "missing", 3)
+
+	// Invalidating a task by ID drops it under its legacy ID too.
+	c.Invalidate("a")
+	get(t, c, m, "7", 4)
+	get(t, c, m, "b", 4)
+
+	c.Invalidate("missing")
+	get(t, c, m, "missing", 5)
+
+	c.Purge()
+	get(t, c, m, "7", 6)
+	get(t, c, m, "b", 7)
+}
+
+func TestCacheSharesMisses(t *testing.T) {
+	m := &stubManager{
+		tasks:   []task.Task{{Id: "a"}},
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	c := New(m, Config{Size: 10})
+
+	var wg sync.WaitGroup
+	for k := 0; k < 10; k++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.GetTask(context.Background(), "a"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	<-m.started
+	// Give the other lookups time to join the call.
+	time.Sleep(50 * time.Millisecond)
+	close(m.release)
+	wg.Wait()
+	if n := m.callCount(); n != 1 {
+		t.Errorf("the wrapped Manager was called %d times, want 1", n)
+	}
+}
+
+func TestCacheInvalidateDuringLoad(t *testing.T) {
+	m := &stubManager{
+		tasks:   []task.Task{{Id: "a", Name: "A"}},
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	c := New(m, Config{Size: 10})
+
+	done := make(chan task.Task)
+	go func() {
+		t, _ := c.GetTask(context.Background(), "a")
+		done <- t
+	}()
+	<-m.started
+	m.set(task.Task{Id: "a", Name: "A2"})
+	c.Invalidate("a")
+	close(m.release)
+	if got := <-done; got.Name != "A" {
+		t.Errorf("GetTask(a) started before the change = %+v, want A", got)
+	}
+
+	// What the lookup read before the invalidation was not cached.
+	m.started = nil
+	if got, _ := get(t, c, m, "a", 2); got.Name != "A2" {
+		t.Errorf("GetTask(a) = %+v, want A2", got)
+	}
+}
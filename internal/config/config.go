@@ -3,9 +3,12 @@ package config
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/urvil38/todo-app/internal/log"
@@ -35,9 +38,137 @@ type Config struct {
 	DBUser, DBHost, DBPort, DBName string
 	DBPassword                     string `json:"-"`
 
-	// Whether to use postgres to store tasks or not.
-	// Default value is false, in that case tasks will be store in memory.
-	UseDB bool
+	// DBReadHosts are read replicas of DBHost. If set, task reads are
+	// served by the healthy replicas, and by DBHost when none is healthy.
+	DBReadHosts []string
+
+	// DBMaxOpenConns and DBMaxIdleConns bound the connections each postgres
+	// pool keeps to DBHost and to each of DBReadHosts. Zero means unlimited
+	// open connections.
+	DBMaxOpenConns, DBMaxIdleConns int
+
+	// DBConnMaxLifetime and DBConnMaxIdleTime close pooled connections once
+	// they are that old, or have been idle that long. Zero means never.
+	DBConnMaxLifetime, DBConnMaxIdleTime time.Duration
+
+	// AutoMigrate applies the embedded postgres migrations at startup.
+	AutoMigrate bool
+
+	// DBStatsInterval is how often connection pool stats are recorded.
+	DBStatsInterval time.Duration
+
+	// DBSlowQueryThreshold is the duration from which queries are logged
+	// as slow. Zero disables the slow query log.
+	DBSlowQueryThreshold time.Duration
+
+	// DBRetryMaxAttempts, DBRetryBaseDelay and DBRetryMaxDelay are the
+	// retry policy of transactions.
+	DBRetryMaxAttempts                int
+	DBRetryBaseDelay, DBRetryMaxDelay time.Duration
+
+	// ReadYourWritesWindow is how long after a write a client's reads are
+	// served by DBHost, so that replication lag does not hide its writes.
+	ReadYourWritesWindow time.Duration
+
+	// TaskCacheSize is the number of task lookups cached in memory. Zero
+	// disables the cache.
+	TaskCacheSize int
+
+	// TaskCacheTTL and TaskCacheNegativeTTL are how long a task, and the
+	// absence of a task, are cached.
+	TaskCacheTTL, TaskCacheNegativeTTL time.Duration
+
+	// TaskCacheNotifications invalidates the cached tasks changed by other
+	// servers, as notified by postgres. It requires postgres storage.
+	TaskCacheNotifications bool
+
+	// Storage can be [memory, postgres, sqlite, bolt].
+	// Default is memory, or postgres if the deprecated TODO_USE_DB is true.
+	Storage string
+
+	// IDScheme can be [ulid, uuidv7]. It selects the format of new task IDs.
+	// Default is ulid.
+	IDScheme string
+
+	// SQLitePath is the database file used by the sqlite storage.
+	SQLitePath string
+
+	// BoltPath is the database file used by the bolt storage.
+	BoltPath string
+
+	// MemoryDataDir is the directory where the memory storage persists
+	// tasks. If empty, tasks are lost on restart.
+	MemoryDataDir string
+
+	// MemorySync can be [always, interval, never]. It controls when the
+	// memory storage flushes its write-ahead log to disk.
+	// Default is always.
+	MemorySync string
+
+	// MemorySnapshotEvery is the number of logged mutations after which the
+	// memory storage compacts its write-ahead log into a snapshot.
+	MemorySnapshotEvery int
+
+	// TrashRetention is how long deleted tasks are kept in the trash before
+	// they are permanently removed.
+	TrashRetention time.Duration
+
+	// TrashPurgeInterval is how often the trash is checked for tasks older
+	// than TrashRetention.
+	TrashPurgeInterval time.Duration
+
+	// RateLimitReads and RateLimitWrites are the number of read (GET, HEAD,
+	// OPTIONS) and write requests a client may make per minute.
+	// Zero disables the limit.
+	RateLimitReads, RateLimitWrites int
+
+	// RateLimitRoutes are limits of their own, in requests per minute, for
+	// the requests they match, written as "[METHOD ]/prefix=N".
+	RateLimitRoutes []string
+
+	// RateLimitStore can be [memory, postgres]. The postgres store shares
+	// limits between server replicas and requires postgres storage.
+	// Default is memory.
+	RateLimitStore string
+
+	// TrustedProxies lists the IP addresses and CIDR ranges of the proxies
+	// whose forwarding headers, such as X-Forwarded-For, are trusted to
+	// identify clients. When empty, clients are identified by their peer
+	// address.
+	TrustedProxies []string
+
+	// CORSAllowedOrigins lists the origins allowed to make cross-origin
+	// requests. Entries may be "*" or use a wildcard subdomain such as
+	// "https://*.example.com". CORS is disabled when the list is empty.
+	CORSAllowedOrigins []string
+	CORSAllowedMethods []string
+	CORSAllowedHeaders []string
+	CORSExposedHeaders []string
+	// CORSAllowCredentials allows cross-origin requests with credentials.
+	CORSAllowCredentials bool
+	// CORSMaxAge is how long browsers may cache preflight responses.
+	CORSMaxAge time.Duration
+
+	// TLSCertFile and TLSKeyFile are the paths of the certificate and key
+	// served by the API and debug servers. TLS is enabled when both are set.
+	// The files are reloaded when they change on disk.
+	TLSCertFile, TLSKeyFile string
+
+	// TLSMinVersion can be [1.0, 1.1, 1.2, 1.3].
+	// Default is 1.2.
+	TLSMinVersion string
+
+	// DebugTLSClientCAFile is the path of a CA certificate. If set, clients of
+	// the debug server must present a certificate signed by it.
+	DebugTLSClientCAFile string
+
+	// AdminToken is the bearer token required by the backup and restore
+	// endpoints, which are not served when it is empty.
+	AdminToken string `json:"-"`
+
+	// TLSRedirectPort is the TCP port of an optional plain HTTP listener that
+	// redirects every request to HTTPS.
+	TLSRedirectPort string
 }
 
 // StatementTimeout is the value of the Postgres statement_timeout parameter.
@@ -55,12 +186,43 @@ func GetEnv(key, fallback string) string {
 	return fallback
 }
 
+// TLSEnabled reports whether the servers should serve HTTPS.
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+// defaultStorage honours the deprecated TODO_USE_DB variable, which
+// TODO_STORAGE replaces.
+func defaultStorage() string {
+	if os.Getenv("TODO_USE_DB") == "true" {
+		return "postgres"
+	}
+	return "memory"
+}
+
+// splitList splits a comma separated list, dropping empty entries.
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
 // DBConnInfo returns a PostgreSQL connection string constructed from
 // environment variables, using the primary database host.
 func (c *Config) DBConnInfo() string {
 	return c.dbConnInfo(c.DBHost)
 }
 
+// DBReadConnInfo returns a PostgreSQL connection string for the read replica
+// on host, one of DBReadHosts.
+func (c *Config) DBReadConnInfo(host string) string {
+	return c.dbConnInfo(host)
+}
+
 // dbConnInfo returns a PostgresSQL connection string for the given host.
 func (c *Config) dbConnInfo(host string) string {
 	// For the connection string syntax, see
@@ -77,18 +239,163 @@ func (c *Config) dbConnInfo(host string) string {
 // Note: Call Init at the beginning of main function
 func Init(ctx context.Context) (cfg *Config, err error) {
 	cfg = &Config{
-		Env:        GetEnv("TODO_ENV", "dev"),
-		Addr:       GetEnv("TODO_ADDRESS", "localhost"),
-		Port:       GetEnv("TODO_PORT", "8080"),
-		DebugPort:  GetEnv("TODO_DEBUG_PORT", "8081"),
-		LogLevel:   GetEnv("TODO_LOG_LEVEL", "info"),
-		LogFormat:  GetEnv("TODO_LOG_FORMAT", "text"),
-		DBHost:     GetEnv("TODO_DATABASE_HOST", "localhost"),
-		DBUser:     GetEnv("TODO_DATABASE_USER", "postgres"),
-		DBPassword: os.Getenv("TODO_DATABASE_PASSWORD"),
-		DBPort:     GetEnv("TODO_DATABASE_PORT", "5432"),
-		DBName:     GetEnv("TODO_DATABASE_NAME", "todo-db"),
-		UseDB:      os.Getenv("TODO_USE_DB") == "true",
+		Env:         GetEnv("TODO_ENV", "dev"),
+		Addr:        GetEnv("TODO_ADDRESS", "localhost"),
+		Port:        GetEnv("TODO_PORT", "8080"),
+		DebugPort:   GetEnv("TODO_DEBUG_PORT", "8081"),
+		LogLevel:    GetEnv("TODO_LOG_LEVEL", "info"),
+		LogFormat:   GetEnv("TODO_LOG_FORMAT", "text"),
+		DBHost:      GetEnv("TODO_DATABASE_HOST", "localhost"),
+		DBUser:      GetEnv("TODO_DATABASE_USER", "postgres"),
+		DBPassword:  os.Getenv("TODO_DATABASE_PASSWORD"),
+		DBPort:      GetEnv("TODO_DATABASE_PORT", "5432"),
+		DBName:      GetEnv("TODO_DATABASE_NAME", "todo-db"),
+		DBReadHosts: splitList(os.Getenv("TODO_DATABASE_READ_HOSTS")),
+		AutoMigrate: os.Getenv("TODO_AUTO_MIGRATE") == "true",
+		Storage:     GetEnv("TODO_STORAGE", defaultStorage()),
+		IDScheme:    GetEnv("TODO_ID_SCHEME", "ulid"),
+		SQLitePath:  GetEnv("TODO_SQLITE_PATH", "todo.db"),
+		BoltPath:    GetEnv("TODO_BOLT_PATH", "todo.bolt"),
+
+		MemoryDataDir: os.Getenv("TODO_MEMORY_DATA_DIR"),
+		MemorySync:    GetEnv("TODO_MEMORY_SYNC", "always"),
+
+		RateLimitStore:  GetEnv("TODO_RATE_LIMIT_STORE", "memory"),
+		RateLimitRoutes: splitList(os.Getenv("TODO_RATE_LIMIT_ROUTES")),
+		TrustedProxies:  splitList(os.Getenv("TODO_TRUSTED_PROXIES")),
+
+		TaskCacheNotifications: os.Getenv("TODO_TASK_CACHE_NOTIFICATIONS") == "true",
+
+		CORSAllowedOrigins:   splitList(os.Getenv("TODO_CORS_ALLOWED_ORIGINS")),
+		CORSAllowedMethods:   splitList(GetEnv("TODO_CORS_ALLOWED_METHODS", "GET, POST, DELETE")),
+		CORSAllowedHeaders:   splitList(GetEnv("TODO_CORS_ALLOWED_HEADERS", "Content-Type, Authorization, X-Request-Id, X-Read-Your-Writes")),
+		CORSExposedHeaders:   splitList(GetEnv("TODO_CORS_EXPOSED_HEADERS", "RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, Retry-After")),
+		CORSAllowCredentials: os.Getenv("TODO_CORS_ALLOW_CREDENTIALS") == "true",
+
+		TLSCertFile:          os.Getenv("TODO_TLS_CERT_FILE"),
+		TLSKeyFile:           os.Getenv("TODO_TLS_KEY_FILE"),
+		TLSMinVersion:        GetEnv("TODO_TLS_MIN_VERSION", "1.2"),
+		DebugTLSClientCAFile: os.Getenv("TODO_DEBUG_TLS_CLIENT_CA_FILE"),
+		TLSRedirectPort:      os.Getenv("TODO_TLS_REDIRECT_PORT"),
+		AdminToken:           os.Getenv("TODO_ADMIN_TOKEN"),
+	}
+
+	cfg.RateLimitReads, err = strconv.Atoi(GetEnv("TODO_RATE_LIMIT_READS", "600"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse TODO_RATE_LIMIT_READS: %w", err)
+	}
+	cfg.RateLimitWrites, err = strconv.Atoi(GetEnv("TODO_RATE_LIMIT_WRITES", "120"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse TODO_RATE_LIMIT_WRITES: %w", err)
+	}
+	cfg.DBMaxOpenConns, err = strconv.Atoi(GetEnv("TODO_DATABASE_MAX_OPEN_CONNS", "20"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse TODO_DATABASE_MAX_OPEN_CONNS: %w", err)
+	}
+	cfg.DBMaxIdleConns, err = strconv.Atoi(GetEnv("TODO_DATABASE_MAX_IDLE_CONNS", "10"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse TODO_DATABASE_MAX_IDLE_CONNS: %w", err)
+	}
+	cfg.MemorySnapshotEvery, err = strconv.Atoi(GetEnv("TODO_MEMORY_SNAPSHOT_EVERY", "10000"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse TODO_MEMORY_SNAPSHOT_EVERY: %w", err)
+	}
+	cfg.TaskCacheSize, err = strconv.Atoi(GetEnv("TODO_TASK_CACHE_SIZE", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse TODO_TASK_CACHE_SIZE: %w", err)
+	}
+
+	switch cfg.Storage {
+	case "memory", "postgres", "sqlite", "bolt":
+	default:
+		return nil, fmt.Errorf("unsupported TODO_STORAGE: %q", cfg.Storage)
+	}
+
+	switch cfg.IDScheme {
+	case "ulid", "uuidv7":
+	default:
+		return nil, fmt.Errorf("unsupported TODO_ID_SCHEME: %q", cfg.IDScheme)
+	}
+
+	switch cfg.RateLimitStore {
+	case "memory":
+	case "postgres":
+		if cfg.Storage != "postgres" {
+			return nil, errors.New("TODO_RATE_LIMIT_STORE=postgres requires TODO_STORAGE=postgres")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported TODO_RATE_LIMIT_STORE: %q", cfg.RateLimitStore)
+	}
+
+	if cfg.TaskCacheNotifications && cfg.Storage != "postgres" {
+		return nil, errors.New("TODO_TASK_CACHE_NOTIFICATIONS=true requires TODO_STORAGE=postgres")
+	}
+
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return nil, errors.New("TODO_TLS_CERT_FILE and TODO_TLS_KEY_FILE must be set together")
+	}
+	if !cfg.TLSEnabled() && (cfg.DebugTLSClientCAFile != "" || cfg.TLSRedirectPort != "") {
+		return nil, errors.New("TODO_DEBUG_TLS_CLIENT_CA_FILE and TODO_TLS_REDIRECT_PORT require TLS to be enabled")
+	}
+	if cfg.TLSRedirectPort != "" && (cfg.TLSRedirectPort == cfg.Port || cfg.TLSRedirectPort == cfg.DebugPort) {
+		return nil, fmt.Errorf("redirect port should be different from the server and debug ports. Listening on port \"%v\"!", cfg.TLSRedirectPort)
+	}
+
+	cfg.CORSMaxAge, err = time.ParseDuration(GetEnv("TODO_CORS_MAX_AGE", "10m"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse TODO_CORS_MAX_AGE: %w", err)
+	}
+
+	cfg.ReadYourWritesWindow, err = time.ParseDuration(GetEnv("TODO_READ_YOUR_WRITES_WINDOW", "5s"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse TODO_READ_YOUR_WRITES_WINDOW: %w", err)
+	}
+
+	cfg.TaskCacheTTL, err = time.ParseDuration(GetEnv("TODO_TASK_CACHE_TTL", "1m"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse TODO_TASK_CACHE_TTL: %w", err)
+	}
+	cfg.TaskCacheNegativeTTL, err = time.ParseDuration(GetEnv("TODO_TASK_CACHE_NEGATIVE_TTL", "5s"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse TODO_TASK_CACHE_NEGATIVE_TTL: %w", err)
+	}
+
+	cfg.DBConnMaxLifetime, err = time.ParseDuration(GetEnv("TODO_DATABASE_CONN_MAX_LIFETIME", "30m"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse TODO_DATABASE_CONN_MAX_LIFETIME: %w", err)
+	}
+	cfg.DBConnMaxIdleTime, err = time.ParseDuration(GetEnv("TODO_DATABASE_CONN_MAX_IDLE_TIME", "5m"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse TODO_DATABASE_CONN_MAX_IDLE_TIME: %w", err)
+	}
+	cfg.DBStatsInterval, err = time.ParseDuration(GetEnv("TODO_DATABASE_STATS_INTERVAL", "10s"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse TODO_DATABASE_STATS_INTERVAL: %w", err)
+	}
+	cfg.DBSlowQueryThreshold, err = time.ParseDuration(GetEnv("TODO_DATABASE_SLOW_QUERY_THRESHOLD", "500ms"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse TODO_DATABASE_SLOW_QUERY_THRESHOLD: %w", err)
+	}
+	cfg.DBRetryMaxAttempts, err = strconv.Atoi(GetEnv("TODO_DATABASE_RETRY_MAX_ATTEMPTS", "11"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse TODO_DATABASE_RETRY_MAX_ATTEMPTS: %w", err)
+	}
+	cfg.DBRetryBaseDelay, err = time.ParseDuration(GetEnv("TODO_DATABASE_RETRY_BASE_DELAY", "125ms"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse TODO_DATABASE_RETRY_BASE_DELAY: %w", err)
+	}
+	cfg.DBRetryMaxDelay, err = time.ParseDuration(GetEnv("TODO_DATABASE_RETRY_MAX_DELAY", "5s"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse TODO_DATABASE_RETRY_MAX_DELAY: %w", err)
+	}
+
+	cfg.TrashRetention, err = time.ParseDuration(GetEnv("TODO_TRASH_RETENTION", "720h"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse TODO_TRASH_RETENTION: %w", err)
+	}
+	cfg.TrashPurgeInterval, err = time.ParseDuration(GetEnv("TODO_TRASH_PURGE_INTERVAL", "1h"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse TODO_TRASH_PURGE_INTERVAL: %w", err)
 	}
 
 	if cfg.Port == cfg.DebugPort {
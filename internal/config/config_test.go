@@ -0,0 +1,47 @@
+package config
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInitPool(t *testing.T) {
+	ctx := context.Background()
+	cfg, err := Init(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Connections are limited by default.
+	if cfg.DBMaxOpenConns != 20 || cfg.DBMaxIdleConns != 10 || cfg.DBConnMaxLifetime != 30*time.Minute || cfg.DBConnMaxIdleTime != 5*time.Minute {
+		t.Errorf("default pool = %d open, %d idle, lifetime %s, idle time %s; want 20, 10, 30m, 5m",
+			cfg.DBMaxOpenConns, cfg.DBMaxIdleConns, cfg.DBConnMaxLifetime, cfg.DBConnMaxIdleTime)
+	}
+
+	t.Setenv("TODO_DATABASE_MAX_OPEN_CONNS", "0")
+	t.Setenv("TODO_DATABASE_MAX_IDLE_CONNS", "5")
+	t.Setenv("TODO_DATABASE_CONN_MAX_LIFETIME", "1h")
+	t.Setenv("TODO_DATABASE_CONN_MAX_IDLE_TIME", "0")
+	if cfg, err = Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DBMaxOpenConns != 0 || cfg.DBMaxIdleConns != 5 || cfg.DBConnMaxLifetime != time.Hour || cfg.DBConnMaxIdleTime != 0 {
+		t.Errorf("pool = %d open, %d idle, lifetime %s, idle time %s; want 0, 5, 1h, 0s",
+			cfg.DBMaxOpenConns, cfg.DBMaxIdleConns, cfg.DBConnMaxLifetime, cfg.DBConnMaxIdleTime)
+	}
+
+	for _, name := range []string{
+		"TODO_DATABASE_MAX_OPEN_CONNS",
+		"TODO_DATABASE_MAX_IDLE_CONNS",
+		"TODO_DATABASE_CONN_MAX_LIFETIME",
+		"TODO_DATABASE_CONN_MAX_IDLE_TIME",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, "lots")
+			if _, err := Init(ctx); err == nil || !strings.Contains(err.Error(), name) {
+				t.Errorf("Init with %s=lots: got %v, want an error naming it", name, err)
+			}
+		})
+	}
+}
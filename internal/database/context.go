@@ -0,0 +1,21 @@
+package database
+
+import "context"
+
+type txKey struct{}
+
+// WithTx returns a copy of ctx that carries tx, a DB in a transaction, so
+// that code given ctx can take part in the transaction without being passed
+// tx. See ForContext.
+func WithTx(ctx context.Context, tx *DB) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+// ForContext returns the transaction carried by ctx, if there is one and it
+// was started on db, or else db.
+func (db *DB) ForContext(ctx context.Context) *DB {
+	if tx, ok := ctx.Value(txKey{}).(*DB); ok && tx.db == db.db && tx.InTransaction() {
+		return tx
+	}
+	return db
+}
@@ -12,9 +12,9 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/jackc/pgconn"
 	"github.com/lib/pq"
 	logpkg "github.com/urvil38/todo-app/internal/log"
 )
@@ -30,13 +30,16 @@ var (
 // A DB may represent a transaction. If so, its execution and query methods
 // operate within the transaction.
 type DB struct {
-	db         *sql.DB
-	instanceID string
-	tx         *sql.Tx
-	conn       *sql.Conn     // the Conn of the Tx, when tx != nil
-	opts       sql.TxOptions // valid when tx != nil
-	mu         sync.Mutex
-	maxRetries int // max times a single transaction was retried
+	db          *sql.DB
+	instanceID  string
+	tx          *sql.Tx
+	conn        *sql.Conn     // the Conn of the Tx, when tx != nil
+	opts        sql.TxOptions // valid when tx != nil
+	savepoint   string        // the innermost savepoint, when Transact is nested
+	depth       int           // the number of enclosing savepoints
+	mu          sync.Mutex
+	maxRetries  int          // max times a single transaction was retried
+	retryPolicy *RetryPolicy // nil for DefaultRetryPolicy
 }
 
 // Open creates a new DB  for the given connection string.
@@ -69,7 +72,7 @@ func (db *DB) InTransaction() bool {
 }
 
 func (db *DB) IsRetryable() bool {
-	return db.tx != nil && isRetryable(db.opts.Isolation)
+	return db.tx != nil
 }
 
 var passwordRegexp = regexp.MustCompile(`password=\S+`)
@@ -80,6 +83,7 @@ func redactPassword(dbinfo string) string {
 
 // Close closes the database connection.
 func (db *DB) Close() error {
+	unregisterPool(db)
 	return db.db.Close()
 }
 
@@ -114,9 +118,11 @@ func (db *DB) Query(ctx context.Context, query string, args ...interface{}) (_ *
 	return db.db.QueryContext(ctx, query, args...)
 }
 
-// QueryRow runs the query and returns a single row.
-func (db *DB) QueryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
-	defer logQuery(ctx, query, args, db.instanceID, db.IsRetryable())(nil)
+// QueryRow runs the query and returns a single row. The query is logged
+// and counted in the query statistics once the row is scanned, since its
+// error is only known then.
+func (db *DB) QueryRow(ctx context.Context, query string, args ...interface{}) *Row {
+	end := logQuery(ctx, query, args, db.instanceID, db.IsRetryable())
 	start := time.Now()
 	defer func() {
 		if ctx.Err() != nil {
@@ -126,9 +132,40 @@ func (db *DB) QueryRow(ctx context.Context, query string, args ...interface{}) *
 		}
 	}()
 	if db.tx != nil {
-		return db.tx.QueryRowContext(ctx, query, args...)
+		return &Row{row: db.tx.QueryRowContext(ctx, query, args...), end: end}
 	}
-	return db.db.QueryRowContext(ctx, query, args...)
+	return &Row{row: db.db.QueryRowContext(ctx, query, args...), end: end}
+}
+
+// Row is the result of QueryRow. Like a sql.Row, it must be scanned.
+type Row struct {
+	row  *sql.Row
+	end  func(*error)
+	once sync.Once
+}
+
+// Scan is like sql.Row.Scan.
+func (r *Row) Scan(dest ...interface{}) (err error) {
+	defer r.done(&err)
+	return r.row.Scan(dest...)
+}
+
+// Err is like sql.Row.Err.
+func (r *Row) Err() (err error) {
+	defer r.done(&err)
+	return r.row.Err()
+}
+
+// done ends the query with the error of the row, the first time it is
+// called. A query that found no row did not fail.
+func (r *Row) done(errp *error) {
+	r.once.Do(func() {
+		err := *errp
+		if errors.Is(err, sql.ErrNoRows) {
+			err = nil
+		}
+		r.end(&err)
+	})
 }
 
 func (db *DB) Prepare(ctx context.Context, query string) (*sql.Stmt, error) {
@@ -164,32 +201,52 @@ func processRows(rows *sql.Rows, f func(*sql.Rows) error) (int, error) {
 
 // RunQueryIncrementally executes query, then calls f on each row. It fetches
 // rows in groups of size batchSize. It stops when there are no more rows, or
-// when f returns io.EOF.
+// when f returns io.EOF. If db is a transaction, the query runs in it, so
+// that several queries can read the same snapshot.
 func (db *DB) RunQueryIncrementally(ctx context.Context, query string, batchSize int, f func(*sql.Rows) error, params ...interface{}) (err error) {
+	if db.InTransaction() {
+		return db.runQueryIncrementally(ctx, query, batchSize, f, params...)
+	}
 	// Run in a transaction, because cursors require one.
 	return db.Transact(ctx, sql.LevelDefault, func(tx *DB) error {
-		// Declare a cursor and associate it with the query.
-		// It will be closed when the transaction commits.
-		_, err = tx.Exec(ctx, fmt.Sprintf(`DECLARE c CURSOR FOR %s`, query), params...)
+		return tx.runQueryIncrementally(ctx, query, batchSize, f, params...)
+	})
+}
+
+// cursorCounter numbers the cursors declared by runQueryIncrementally, so
+// that a query run while processing the rows of another gets its own.
+var cursorCounter int64 // atomic
+
+func (db *DB) runQueryIncrementally(ctx context.Context, query string, batchSize int, f func(*sql.Rows) error, params ...interface{}) (err error) {
+	// Declare a cursor and associate it with the query.
+	cursor := fmt.Sprintf("c_%d", atomic.AddInt64(&cursorCounter, 1))
+	_, err = db.Exec(ctx, fmt.Sprintf(`DECLARE %s CURSOR FOR %s`, cursor, query), params...)
+	if err != nil {
+		return err
+	}
+	// Close the cursor however the query ends, so that it does not hold on
+	// to its resources until the end of the transaction. If the query
+	// failed, closing is likely to fail too, and that error is dropped.
+	defer func() {
+		if _, cerr := db.Exec(ctx, "CLOSE "+cursor); err == nil {
+			err = cerr
+		}
+	}()
+	for {
+		// Fetch batchSize rows and process them.
+		rows, err := db.Query(ctx, fmt.Sprintf(`FETCH %d FROM %s`, batchSize, cursor))
 		if err != nil {
 			return err
 		}
-		for {
-			// Fetch batchSize rows and process them.
-			rows, err := tx.Query(ctx, fmt.Sprintf(`FETCH %d FROM c`, batchSize))
-			if err != nil {
-				return err
-			}
-			n, err := processRows(rows, f)
-			// Stop if there were no rows, or the processing function returned io.EOF.
-			if n == 0 || err == io.EOF {
-				return nil
-			}
-			if err != nil {
-				return err
-			}
+		n, err := processRows(rows, f)
+		// Stop if there were no rows, or the processing function returned io.EOF.
+		if n == 0 || err == io.EOF {
+			return nil
 		}
-	})
+		if err != nil {
+			return err
+		}
+	}
 }
 
 // Transact executes the given function in the context of a SQL transaction at
@@ -200,18 +257,28 @@ func (db *DB) RunQueryIncrementally(ctx context.Context, query string, batchSize
 // The DB should be used only inside the function; if it is used to access the
 // database after the function returns, the calls will return errors.
 //
-// If the isolation level requires it, Transact will retry the transaction upon
-// serialization failure, so txFunc may be called more than once.
+// Transact retries the transaction upon deadlock or connection reset and, if
+// the isolation level requires it, upon serialization failure, as allowed by
+// the RetryPolicy of db or the one set with WithRetryPolicy, so txFunc may be
+// called more than once.
+//
+// If db is already a transaction, Transact runs txFunc within a savepoint
+// instead, so that functions needing a transaction can be composed. If txFunc
+// panics or returns an error, only the changes it made are rolled back, and
+// the enclosing transaction can carry on. A nested Transact is never retried,
+// because a serialization failure aborts the whole transaction: it is retried
+// by the outermost Transact. It cannot ask for a stricter isolation level
+// than that of the enclosing transaction.
 func (db *DB) Transact(ctx context.Context, iso sql.IsolationLevel, txFunc func(*DB) error) (err error) {
-	// For the levels which require retry, see
-	// https://www.postgresql.org/docs/11/transaction-iso.html.
-	opts := &sql.TxOptions{Isolation: iso}
-	if isRetryable(iso) {
-		return db.transactWithRetry(ctx, opts, txFunc)
+	if db.InTransaction() {
+		return db.transactSavepoint(ctx, iso, txFunc)
 	}
-	return db.transact(ctx, opts, txFunc)
+	return db.transactWithRetry(ctx, &sql.TxOptions{Isolation: iso}, txFunc)
 }
 
+// isRetryable reports whether transactions at iso can fail with a
+// serialization failure, and must then be retried. See
+// https://www.postgresql.org/docs/11/transaction-iso.html.
 func isRetryable(iso sql.IsolationLevel) bool {
 	return iso == sql.LevelRepeatableRead || iso == sql.LevelSerializable
 }
@@ -222,55 +289,46 @@ func isRetryable(iso sql.IsolationLevel) bool {
 const serializationFailureCode = "40001"
 
 func (db *DB) transactWithRetry(ctx context.Context, opts *sql.TxOptions, txFunc func(*DB) error) (err error) {
-	// Retry on serialization failure, up to some max.
 	// See https://www.postgresql.org/docs/11/transaction-iso.html.
-	const maxRetries = 10
-	sleepDur := 125 * time.Millisecond
-	for i := 0; i <= maxRetries; i++ {
+	policy := db.retryPolicyFor(ctx)
+	for attempt := 1; ; attempt++ {
 		err = db.transact(ctx, opts, txFunc)
-		if isSerializationFailure(err) {
-			db.mu.Lock()
-			if i > db.maxRetries {
-				db.maxRetries = i
-			}
-			db.mu.Unlock()
-			log.Debugf("serialization failure; retrying after %s", sleepDur)
-			time.Sleep(sleepDur)
-			sleepDur *= 2
-			continue
+		reason := retryReason(err)
+		if reason == retrySerializationFailure && !isRetryable(opts.Isolation) {
+			return err
 		}
-		if err != nil {
-			log.Debugf("transactWithRetry: error type %T: %[1]v", err)
-			if strings.Contains(err.Error(), serializationFailureCode) {
-				return fmt.Errorf("error text has %q but not recognized as serialization failure: type %T, err %v",
-					serializationFailureCode, err, err)
+		if reason == "" {
+			if err != nil {
+				log.Debugf("transactWithRetry: error type %T: %[1]v", err)
+				if strings.Contains(err.Error(), serializationFailureCode) {
+					return fmt.Errorf("error text has %q but not recognized as serialization failure: type %T, err %v",
+						serializationFailureCode, err, err)
+				}
+			}
+			if attempt > 1 {
+				log.Debugf("retried transaction %d time(s)", attempt-1)
 			}
+			return err
 		}
-		if i > 0 {
-			log.Debugf("retried serializable transaction %d time(s)", i)
+		if attempt >= policy.MaxAttempts {
+			recordRetry(ctx, transactionRetriesExhausted, reason)
+			return fmt.Errorf("reached max number of tries (%d): %w", attempt, err)
+		}
+		db.mu.Lock()
+		if attempt > db.maxRetries {
+			db.maxRetries = attempt
+		}
+		db.mu.Unlock()
+		recordRetry(ctx, transactionRetries, reason)
+		d := policy.delay(attempt)
+		log.Debugf("%s; retrying after %s", reason, d)
+		if err := sleep(ctx, d); err != nil {
+			return err
 		}
-		return err
-	}
-	return fmt.Errorf("reached max number of tries due to serialization failure (%d)", maxRetries)
-}
-
-func isSerializationFailure(err error) bool {
-	// The underlying error type depends on the driver. Try both pq and pgx types.
-	var perr *pq.Error
-	if errors.As(err, &perr) && perr.Code == serializationFailureCode {
-		return true
-	}
-	var gerr *pgconn.PgError
-	if errors.As(err, &gerr) && gerr.Code == serializationFailureCode {
-		return true
 	}
-	return false
 }
 
 func (db *DB) transact(ctx context.Context, opts *sql.TxOptions, txFunc func(*DB) error) (err error) {
-	if db.InTransaction() {
-		return errors.New("a DB Transact function was called on a DB already in a transaction")
-	}
 	conn, err := db.db.Conn(ctx)
 	if err != nil {
 		return err
@@ -289,7 +347,7 @@ func (db *DB) transact(ctx context.Context, opts *sql.TxOptions, txFunc func(*DB
 			tx.Rollback()
 		} else {
 			if txErr := tx.Commit(); txErr != nil {
-				err = fmt.Errorf("tx.Commit(): %w", txErr)
+				err = &commitError{txErr}
 			}
 		}
 	}()
@@ -305,6 +363,63 @@ func (db *DB) transact(ctx context.Context, opts *sql.TxOptions, txFunc func(*DB
 	return nil
 }
 
+func (db *DB) transactSavepoint(ctx context.Context, iso sql.IsolationLevel, txFunc func(*DB) error) (err error) {
+	if effectiveIsolation(iso) > effectiveIsolation(db.opts.Isolation) {
+		return fmt.Errorf("a nested transaction cannot raise the isolation level from %s to %s",
+			effectiveIsolation(db.opts.Isolation), iso)
+	}
+	dbsp := New(db.db)
+	dbsp.instanceID = db.instanceID
+	dbsp.tx = db.tx
+	dbsp.conn = db.conn
+	dbsp.opts = db.opts
+	dbsp.depth = db.depth + 1
+	// Savepoints are numbered by depth. A sibling reuses the name of one that
+	// was released or rolled back, which is fine since each is released.
+	dbsp.savepoint = fmt.Sprintf("sp_%d", dbsp.depth)
+
+	if _, err := db.Exec(ctx, "SAVEPOINT "+dbsp.savepoint); err != nil {
+		return err
+	}
+	rollback := func() error {
+		if _, err := db.Exec(ctx, "ROLLBACK TO SAVEPOINT "+dbsp.savepoint); err != nil {
+			return err
+		}
+		_, err := db.Exec(ctx, "RELEASE SAVEPOINT "+dbsp.savepoint)
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			if rerr := rollback(); rerr != nil {
+				log.Errorf("rolling back savepoint %s after panic: %v", dbsp.savepoint, rerr)
+			}
+			panic(p)
+		} else if err != nil {
+			if rerr := rollback(); rerr != nil {
+				err = fmt.Errorf("%w (rolling back savepoint: %v)", err, rerr)
+			}
+		} else {
+			if _, rerr := db.Exec(ctx, "RELEASE SAVEPOINT "+dbsp.savepoint); rerr != nil {
+				err = fmt.Errorf("releasing savepoint: %w", rerr)
+			}
+		}
+	}()
+
+	defer dbsp.logTransaction(ctx)(&err)
+	if err := txFunc(dbsp); err != nil {
+		return fmt.Errorf("txFunc(savepoint): %w", err)
+	}
+	return nil
+}
+
+// effectiveIsolation returns the isolation level that Postgres uses for iso.
+func effectiveIsolation(iso sql.IsolationLevel) sql.IsolationLevel {
+	if iso == sql.LevelDefault {
+		return sql.LevelReadCommitted
+	}
+	return iso
+}
+
 // MaxRetries returns the maximum number of times thata  serializable transaction was retried.
 func (db *DB) MaxRetries() int {
 	db.mu.Lock()
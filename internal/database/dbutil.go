@@ -9,16 +9,16 @@ import (
 	"database/sql"
 	"fmt"
 	"net/url"
-	"path/filepath"
 	"strings"
 
 	// imported to register the postgres migration driver
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
 	"github.com/urvil38/todo-app/internal/config"
+	"github.com/urvil38/todo-app/migrations"
 
-	// imported to register the file source migration driver
-	_ "github.com/golang-migrate/migrate/v4/source/file"
 	// imported to register the postgres database driver
 	_ "github.com/lib/pq"
 )
@@ -136,11 +136,9 @@ func checkIfDBExists(dbName string) (bool, error) {
 // migration. If this operation fails in the migration step, it returns
 // isMigrationError=true to signal that the database should be recreated.
 func TryToMigrate(dbName string) (isMigrationError bool, outerErr error) {
-	dbURI := DBConnURI(dbName)
-	source := migrationsSource()
-	m, err := migrate.New(source, dbURI)
+	m, err := NewMigrate(dbName)
 	if err != nil {
-		return false, fmt.Errorf("migrate.New(): %v", err)
+		return false, err
 	}
 	defer func() {
 		if srcErr, dbErr := m.Close(); srcErr != nil || dbErr != nil {
@@ -148,15 +146,33 @@ func TryToMigrate(dbName string) (isMigrationError bool, outerErr error) {
 		}
 	}()
 	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
-		return true, fmt.Errorf("m.Up() %q: %v", source, err)
+		return true, fmt.Errorf("m.Up(): %v", err)
 	}
 	return false, nil
 }
 
-// migrationsSource returns a uri pointing to the migrations directory.  It
-// returns an error if unable to determine this path.
-func migrationsSource() string {
-	return "file://" + filepath.ToSlash("./migrations")
+// NewMigrate returns a migrate.Migrate that applies the embedded migrations
+// to the database named dbName. The caller must close it.
+func NewMigrate(dbName string) (*migrate.Migrate, error) {
+	source, err := migrationsSource()
+	if err != nil {
+		return nil, err
+	}
+	m, err := migrate.NewWithSourceInstance("iofs", source, DBConnURI(dbName))
+	if err != nil {
+		return nil, fmt.Errorf("migrate.NewWithSourceInstance(): %v", err)
+	}
+	return m, nil
+}
+
+// migrationsSource returns a migration source reading the migrations
+// embedded in the binary.
+func migrationsSource() (source.Driver, error) {
+	src, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		return nil, fmt.Errorf("iofs.New(): %v", err)
+	}
+	return src, nil
 }
 
 // ResetDB truncates all data from the given test DB.  It should be called
@@ -164,7 +180,7 @@ func migrationsSource() string {
 func ResetDB(ctx context.Context, db *DB) error {
 	if err := db.Transact(ctx, sql.LevelDefault, func(tx *DB) error {
 		if _, err := tx.Exec(ctx, `
-			TRUNCATE tasks CASCADE;`); err != nil {
+			TRUNCATE tasks, audit_events CASCADE;`); err != nil {
 			return err
 		}
 		return nil
@@ -25,8 +25,15 @@ type queryEndLogEntry struct {
 }
 
 func logQuery(ctx context.Context, query string, args []interface{}, instanceID string, retryable bool) func(*error) {
+	return logNamedQuery(ctx, query, nil, args, instanceID, retryable)
+}
+
+// logNamedQuery is like logQuery, but if names is not nil, names[i] is the
+// name of args[i], and is logged with it.
+func logNamedQuery(ctx context.Context, query string, names []string, args []interface{}, instanceID string, retryable bool) func(*error) {
+	raw, start := query, time.Now()
 	if QueryLoggingDisabled {
-		return func(*error) {}
+		return func(errp *error) { endQuery(raw, "", time.Since(start), errp) }
 	}
 	const maxlen = 300 // maximum length of displayed query
 
@@ -59,6 +66,9 @@ func logQuery(ctx context.Context, query string, args []interface{}, instanceID
 		if len(s) > maxArgLen {
 			s = s[:maxArgLen] + "..."
 		}
+		if names != nil {
+			s = ":" + names[i] + "=" + s
+		}
 		argStrings = append(argStrings, s)
 	}
 	if len(args) > maxArgs {
@@ -67,9 +77,9 @@ func logQuery(ctx context.Context, query string, args []interface{}, instanceID
 	argString := strings.Join(argStrings, ", ")
 
 	log.Debugf("%s %s args=%s", uid, query, argString)
-	start := time.Now()
 	return func(errp *error) {
 		dur := time.Since(start)
+		endQuery(raw, uid, dur, errp)
 		if errp == nil { // happens with queryRow
 			log.Debugf("%s done", uid)
 		} else {
@@ -88,7 +98,7 @@ func logQuery(ctx context.Context, query string, args []interface{}, instanceID
 					strings.Contains(entry.Error, "pq: canceling statement due to user request") {
 					logf = log.Debugf
 				}
-				if retryable && isSerializationFailure(*errp) {
+				if retryable && retryReason(*errp) != "" {
 					logf = log.Debugf
 				}
 				logf("%+v", entry)
@@ -97,16 +107,30 @@ func logQuery(ctx context.Context, query string, args []interface{}, instanceID
 	}
 }
 
+// endQuery adds a query that took d to the query statistics, and logs it if
+// it was slow. errp is nil if the outcome of the query is unknown.
+func endQuery(query, uid string, d time.Duration, errp *error) {
+	normalized := normalizeQuery(query)
+	recordQuery(normalized, d, errp != nil && *errp != nil)
+	if t := time.Duration(atomic.LoadInt64(&slowQueryThreshold)); t > 0 && d >= t && !QueryLoggingDisabled {
+		log.Warnf("%s slow query took %s: %s", uid, d, normalized)
+	}
+}
+
 func (db *DB) logTransaction(ctx context.Context) func(*error) {
 	if QueryLoggingDisabled {
 		return func(*error) {}
 	}
 	uid := generateLoggingID(db.instanceID)
-	log.Debugf("%s transaction (isolation %s) started", uid, db.opts.Isolation)
+	what := fmt.Sprintf("transaction (isolation %s)", db.opts.Isolation)
+	if db.savepoint != "" {
+		what = fmt.Sprintf("savepoint %s (depth %d)", db.savepoint, db.depth)
+	}
+	log.Debugf("%s %s started", uid, what)
 	start := time.Now()
 	return func(errp *error) {
-		log.Debugf("%s transaction (isolation %s) finished in %s with error %v",
-			uid, db.opts.Isolation, time.Since(start), *errp)
+		log.Debugf("%s %s finished in %s with error %v",
+			uid, what, time.Since(start), *errp)
 	}
 }
 
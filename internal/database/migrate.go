@@ -0,0 +1,170 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/golang-migrate/migrate/v4"
+	migratepostgres "github.com/golang-migrate/migrate/v4/database/postgres"
+)
+
+// migrationLockID is the key of the advisory lock held by Migrate, so that
+// servers starting together do not race to apply the same migrations.
+const migrationLockID = 7_467_806_485_372_917
+
+// Migrations returns the versions of the migrations embedded in the binary,
+// in order.
+func Migrations() ([]uint, error) {
+	src, err := migrationsSource()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	v, err := src.First()
+	if err != nil {
+		return nil, fmt.Errorf("src.First(): %v", err)
+	}
+	versions := []uint{v}
+	for {
+		next, err := src.Next(v)
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, fs.ErrNotExist) {
+			return versions, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("src.Next(%d): %v", v, err)
+		}
+		versions = append(versions, next)
+		v = next
+	}
+}
+
+// LatestMigration returns the version of the newest migration embedded in
+// the binary.
+func LatestMigration() (uint, error) {
+	versions, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	return versions[len(versions)-1], nil
+}
+
+// SchemaVersion returns the migration version of the postgres database db,
+// and whether the last migration failed part way. A database that was never
+// migrated has version 0.
+func SchemaVersion(ctx context.Context, db *DB) (version uint, dirty bool, err error) {
+	var exists bool
+	if err := db.QueryRow(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists); err != nil {
+		return 0, false, err
+	}
+	if !exists {
+		return 0, false, nil
+	}
+	var v int64
+	err = db.QueryRow(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&v, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return uint(v), dirty, nil
+}
+
+// CheckSchemaVersion returns an error if the schema of db is newer than the
+// newest migration embedded in the binary, whose queries may then no longer
+// match it. An older schema is only logged, since it can be migrated.
+func CheckSchemaVersion(ctx context.Context, db *DB) error {
+	version, dirty, err := SchemaVersion(ctx, db)
+	if err != nil {
+		return fmt.Errorf("reading schema version: %v", err)
+	}
+	return checkSchemaVersion(version, dirty)
+}
+
+func checkSchemaVersion(version uint, dirty bool) error {
+	latest, err := LatestMigration()
+	if err != nil {
+		return err
+	}
+	switch {
+	case version > latest:
+		return fmt.Errorf("database schema version %d is newer than %d, the latest migration known to this binary", version, latest)
+	case dirty:
+		log.Warnf("database schema version %d is dirty: a migration failed part way", version)
+	case version < latest:
+		log.Warnf("database schema version %d is older than %d, the latest migration known to this binary", version, latest)
+	}
+	return nil
+}
+
+// Migrate migrates the postgres database db to the newest migration embedded
+// in the binary. It holds an advisory lock meanwhile, so that concurrent
+// callers apply each migration once, and fails without migrating if the
+// schema is newer than the binary.
+func Migrate(ctx context.Context, db *DB) (outerErr error) {
+	conn, err := db.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		conn.Close()
+		return fmt.Errorf("acquiring migration lock: %v", err)
+	}
+
+	driver, err := migratepostgres.WithConnection(ctx, conn, &migratepostgres.Config{})
+	if err != nil {
+		unlockMigrations(conn)
+		conn.Close()
+		return fmt.Errorf("postgres.WithConnection(): %v", err)
+	}
+	source, err := migrationsSource()
+	if err != nil {
+		unlockMigrations(conn)
+		driver.Close()
+		return err
+	}
+	m, err := migrate.NewWithInstance("iofs", source, "postgres", driver)
+	if err != nil {
+		unlockMigrations(conn)
+		driver.Close()
+		return fmt.Errorf("migrate.NewWithInstance(): %v", err)
+	}
+	defer func() {
+		if srcErr, dbErr := m.Close(); srcErr != nil || dbErr != nil {
+			outerErr = MultiErr{outerErr, srcErr, dbErr}
+		}
+	}()
+	// Closing m also closes conn, which returns it to the pool with its
+	// session, and so the lock, intact. Unlock first.
+	defer unlockMigrations(conn)
+
+	// Checked under the lock, so that another server cannot migrate past
+	// the binary in between.
+	version, dirty, err := m.Version()
+	if err != nil && err != migrate.ErrNilVersion {
+		return fmt.Errorf("m.Version(): %v", err)
+	}
+	if err := checkSchemaVersion(version, dirty); err != nil {
+		return err
+	}
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		return fmt.Errorf("m.Up(): %v", err)
+	}
+	version, _, err = m.Version()
+	if err != nil {
+		return fmt.Errorf("m.Version(): %v", err)
+	}
+	log.Infof("database schema is at version %d", version)
+	return nil
+}
+
+func unlockMigrations(conn *sql.Conn) {
+	// The lock must be released even if the caller's context is done.
+	if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID); err != nil {
+		log.Errorf("releasing migration lock: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestMigrations checks that every migration in the migrations directory is
+// embedded, with both an up and a down file.
+func TestMigrations(t *testing.T) {
+	files, err := os.ReadDir(filepath.Join("..", "..", "migrations"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := map[uint][]string{}
+	for _, f := range files {
+		if filepath.Ext(f.Name()) != ".sql" {
+			continue
+		}
+		prefix := strings.SplitN(f.Name(), "_", 2)[0]
+		v, err := strconv.ParseUint(prefix, 10, 32)
+		if err != nil {
+			t.Fatalf("migration %s has no version: %v", f.Name(), err)
+		}
+		name := strings.TrimSuffix(f.Name(), ".sql")
+		kinds[uint(v)] = append(kinds[uint(v)], filepath.Ext(name))
+	}
+	var want []uint
+	for v, k := range kinds {
+		sort.Strings(k)
+		if !reflect.DeepEqual(k, []string{".down", ".up"}) {
+			t.Errorf("migration %d has files %v, want one .up.sql and one .down.sql", v, k)
+		}
+		want = append(want, v)
+	}
+	sort.Slice(want, func(i, j int) bool { return want[i] < want[j] })
+
+	got, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Migrations() = %v, want %v", got, want)
+	}
+	if latest, err := LatestMigration(); err != nil || latest != want[len(want)-1] {
+		t.Errorf("LatestMigration() = %d, %v; want %d", latest, err, want[len(want)-1])
+	}
+}
+
+func TestCheckSchemaVersion(t *testing.T) {
+	latest, err := LatestMigration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		version uint
+		dirty   bool
+		wantErr bool
+	}{
+		{0, false, false},
+		{latest - 1, false, false},
+		{latest, false, false},
+		{latest, true, false},
+		{latest + 1, false, true},
+		{latest + 1, true, true},
+	} {
+		err := checkSchemaVersion(test.version, test.dirty)
+		if (err != nil) != test.wantErr {
+			t.Errorf("checkSchemaVersion(%d, %t) = %v, want error: %t", test.version, test.dirty, err, test.wantErr)
+		}
+	}
+}
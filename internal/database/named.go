@@ -0,0 +1,240 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// namedQuery is a query with :name parameters rewritten to positional ones.
+type namedQuery struct {
+	query string   // the query with $1, $2, ... in place of names
+	names []string // names[i] is the name of parameter $i+1
+}
+
+// namedQueries caches the queries parsed by parseNamed, up to
+// maxNamedQueries of them, in case queries are built from varying values.
+var namedQueries = struct {
+	sync.Mutex
+	m map[string]*namedQuery
+}{m: map[string]*namedQuery{}}
+
+const maxNamedQueries = 1000
+
+// parseNamed rewrites the :name parameters of query to $1, $2, ... in order of
+// first appearance, so that a name used several times is bound once. Since
+// SQLite numbers $NNN parameters the same way, the result works with it too.
+//
+// Parameters are not recognized inside string literals, quoted identifiers,
+// dollar-quoted strings and comments, and :: casts are left alone.
+func parseNamed(query string) (*namedQuery, error) {
+	namedQueries.Lock()
+	nq, ok := namedQueries.m[query]
+	namedQueries.Unlock()
+	if ok {
+		return nq, nil
+	}
+	var (
+		b       strings.Builder
+		names   []string
+		indexes = map[string]int{}
+	)
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(query[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated %c in query", c)
+			}
+			// A doubled quote inside a literal is an escaped quote, which
+			// this treats as the end of one literal and the start of the
+			// next.
+			b.WriteString(query[i : i+end+2])
+			i += end + 2
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+			b.WriteString(query[i : i+end])
+			i += end
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment in query")
+			}
+			b.WriteString(query[i : i+end+4])
+			i += end + 4
+		case c == '$':
+			n := dollarQuoteTag(query[i:])
+			if n == 0 {
+				b.WriteByte(c)
+				i++
+				break
+			}
+			tag := query[i : i+n]
+			end := strings.Index(query[i+n:], tag)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated %s in query", tag)
+			}
+			b.WriteString(query[i : i+n+end+n])
+			i += n + end + n
+		case c == ':' && strings.HasPrefix(query[i:], "::"):
+			b.WriteString("::")
+			i += 2
+		case c == ':' && i+1 < len(query) && isNameStart(query[i+1]):
+			j := i + 1
+			for j < len(query) && isNamePart(query[j]) {
+				j++
+			}
+			name := query[i+1 : j]
+			k, ok := indexes[name]
+			if !ok {
+				names = append(names, name)
+				k = len(names)
+				indexes[name] = k
+			}
+			b.WriteString("$" + strconv.Itoa(k))
+			i = j
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	nq = &namedQuery{query: b.String(), names: names}
+	namedQueries.Lock()
+	if len(namedQueries.m) < maxNamedQueries {
+		namedQueries.m[query] = nq
+	}
+	namedQueries.Unlock()
+	return nq, nil
+}
+
+// dollarQuoteTag returns the length of the $tag$ that s starts with, or 0 if
+// it does not start with one. Positional parameters like $1 are not tags.
+func dollarQuoteTag(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '$':
+			return i + 1
+		case !isNamePart(c) || i == 1 && !isNameStart(c):
+			return 0
+		}
+	}
+	return 0
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isNamePart(c byte) bool {
+	return isNameStart(c) || '0' <= c && c <= '9'
+}
+
+// bindNamed parses query and returns the arguments for its parameters, taken
+// from arg. arg is either a map with string keys, or a struct or pointer to
+// struct whose fields are matched to names as StructScannerForColumns
+// matches them to columns. It is an error for a parameter to have no value.
+func bindNamed(query string, arg interface{}) (*namedQuery, []interface{}, error) {
+	nq, err := parseNamed(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	v := reflect.ValueOf(arg)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	var lookup func(name string) (interface{}, bool)
+	switch {
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		lookup = func(name string) (interface{}, bool) {
+			e := v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+			if !e.IsValid() {
+				return nil, false
+			}
+			return e.Interface(), true
+		}
+	case v.Kind() == reflect.Struct:
+		byName := map[string][]int{}
+		for _, f := range structFields(v.Type(), nil) {
+			if g, ok := byName[f.column]; !ok || len(f.index) < len(g) {
+				byName[f.column] = f.index
+			}
+		}
+		lookup = func(name string) (interface{}, bool) {
+			index, ok := byName[name]
+			if !ok {
+				return nil, false
+			}
+			return v.FieldByIndex(index).Interface(), true
+		}
+	case len(nq.names) == 0:
+		return nq, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("cannot bind query parameters from %T", arg)
+	}
+	args := make([]interface{}, len(nq.names))
+	for k, name := range nq.names {
+		a, ok := lookup(name)
+		if !ok {
+			return nil, nil, fmt.Errorf("missing value for query parameter :%s", name)
+		}
+		args[k] = a
+	}
+	return nq, args, nil
+}
+
+// NamedExec is like Exec, but query has :name parameters, which are bound
+// from arg: either a map with string keys, or a struct whose fields are
+// matched by their `db` tag or snake-cased name, as for ScanStruct. Values
+// are only looked up for the names in query, so arg may hold more.
+//
+// Example:
+//
+//	n, err := db.NamedExec(ctx, "UPDATE players SET score = :score WHERE name = :name",
+//	    map[string]interface{}{"name": "ann", "score": 3})
+func (db *DB) NamedExec(ctx context.Context, query string, arg interface{}) (_ int64, err error) {
+	nq, args, err := bindNamed(query, arg)
+	if err != nil {
+		return 0, err
+	}
+	defer logNamedQuery(ctx, query, nq.names, args, db.instanceID, db.IsRetryable())(&err)
+	res, err := db.execResult(ctx, nq.query, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("RowsAffected: %v", err)
+	}
+	return n, nil
+}
+
+// NamedQuery is like Query, with parameters bound as by NamedExec.
+func (db *DB) NamedQuery(ctx context.Context, query string, arg interface{}) (_ *sql.Rows, err error) {
+	nq, args, err := bindNamed(query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer logNamedQuery(ctx, query, nq.names, args, db.instanceID, db.IsRetryable())(&err)
+	if db.tx != nil {
+		return db.tx.QueryContext(ctx, nq.query, args...)
+	}
+	return db.db.QueryContext(ctx, nq.query, args...)
+}
+
+// NamedRunQuery is like RunQuery, with parameters bound as by NamedExec.
+func (db *DB) NamedRunQuery(ctx context.Context, query string, arg interface{}, f func(*sql.Rows) error) error {
+	rows, err := db.NamedQuery(ctx, query, arg)
+	if err != nil {
+		return err
+	}
+	_, err = processRows(rows, f)
+	return err
+}
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParseNamed(t *testing.T) {
+	for _, test := range []struct {
+		in, want string
+		names    []string
+	}{
+		{"SELECT 1", "SELECT 1", nil},
+		{"SELECT * FROM t WHERE a = :a AND b = :b OR a = :a", "SELECT * FROM t WHERE a = $1 AND b = $2 OR a = $1", []string{"a", "b"}},
+		{"SELECT :x::text, ':y', \":z\"", "SELECT $1::text, ':y', \":z\"", []string{"x"}},
+		{"SELECT 'it''s :no', :yes", "SELECT 'it''s :no', $1", []string{"yes"}},
+		{"SELECT $tag$ :no $tag$, $$ :no $$, :yes -- :no\n/* :no */", "SELECT $tag$ :no $tag$, $$ :no $$, $1 -- :no\n/* :no */", []string{"yes"}},
+		{"UPDATE t SET created_at = :created_at_2", "UPDATE t SET created_at = $1", []string{"created_at_2"}},
+	} {
+		got, err := parseNamed(test.in)
+		if err != nil {
+			t.Errorf("parseNamed(%q): %v", test.in, err)
+			continue
+		}
+		if got.query != test.want || !reflect.DeepEqual(got.names, test.names) {
+			t.Errorf("parseNamed(%q) = %q %q, want %q %q", test.in, got.query, got.names, test.want, test.names)
+		}
+	}
+
+	for _, in := range []string{"SELECT ':a", "SELECT /* :a", "SELECT $q$ :a"} {
+		if _, err := parseNamed(in); err == nil {
+			t.Errorf("parseNamed(%q): got nil error", in)
+		}
+	}
+}
+
+func TestBindNamed(t *testing.T) {
+	type params struct {
+		ID       int64
+		Name     string `db:"title"`
+		Ignored  string `db:"-"`
+		Unneeded bool
+	}
+	const query = "SELECT :id, :title, :id"
+	want := []interface{}{int64(7), "x"}
+
+	for _, arg := range []interface{}{
+		map[string]interface{}{"id": int64(7), "title": "x", "other": 1},
+		params{ID: 7, Name: "x"},
+		&params{ID: 7, Name: "x"},
+	} {
+		_, args, err := bindNamed(query, arg)
+		if err != nil {
+			t.Fatalf("%T: %v", arg, err)
+		}
+		if !reflect.DeepEqual(args, want) {
+			t.Errorf("%T: got %v, want %v", arg, args, want)
+		}
+	}
+
+	for _, arg := range []interface{}{
+		map[string]interface{}{"id": 7},
+		struct {
+			Ignored string `db:"-"`
+		}{},
+		42,
+		nil,
+	} {
+		if _, _, err := bindNamed("SELECT :id, :ignored", arg); err == nil {
+			t.Errorf("%T: got nil error", arg)
+		}
+	}
+}
+
+func TestNamedRunQuery(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	n, err := db.NamedExec(ctx, "UPDATE rows SET note = :note WHERE id = :id", map[string]interface{}{"id": 1, "note": "y"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("NamedExec affected %d rows, want 1", n)
+	}
+
+	var names []string
+	err = db.NamedRunQuery(ctx, "SELECT name FROM rows WHERE note = :note OR id = :id ORDER BY id", struct {
+		ID   int
+		Note string
+	}{2, "y"}, func(rows *sql.Rows) error {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return err
+		}
+		names = append(names, s)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"a", "b"}) {
+		t.Errorf("got %q, want [a b]", names)
+	}
+}
+
+func TestParseNamedCacheBounded(t *testing.T) {
+	for i := 0; i < maxNamedQueries+10; i++ {
+		if _, err := parseNamed(fmt.Sprintf("SELECT :a LIMIT %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	namedQueries.Lock()
+	n := len(namedQueries.m)
+	namedQueries.Unlock()
+	if n > maxNamedQueries {
+		t.Errorf("%d queries cached, want at most %d", n, maxNamedQueries)
+	}
+}
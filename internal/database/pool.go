@@ -0,0 +1,166 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// PoolConfig bounds the connections of a DB. It mirrors the Set methods of
+// sql.DB, whose zero values mean no limit.
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// ConfigurePool applies cfg to the connection pool of db.
+func (db *DB) ConfigurePool(cfg PoolConfig) {
+	db.db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+}
+
+// Stats returns the connection pool statistics of db.
+func (db *DB) Stats() sql.DBStats {
+	return db.db.Stats()
+}
+
+// pools are the DBs whose stats are recorded and reported, by name.
+var pools = struct {
+	mu sync.Mutex
+	m  map[string]*DB
+}{m: map[string]*DB{}}
+
+// RegisterPool makes the connection pool of db visible, under name, to
+// RecordPoolStats and Pools. Closing db unregisters it.
+func RegisterPool(name string, db *DB) {
+	pools.mu.Lock()
+	defer pools.mu.Unlock()
+	pools.m[name] = db
+}
+
+func unregisterPool(db *DB) {
+	pools.mu.Lock()
+	defer pools.mu.Unlock()
+	for name, p := range pools.m {
+		if p.db == db.db {
+			delete(pools.m, name)
+		}
+	}
+}
+
+// PoolStats are the statistics of a registered connection pool.
+type PoolStats struct {
+	Name string
+	sql.DBStats
+}
+
+// Pools returns the current statistics of the registered connection pools,
+// sorted by name.
+func Pools() []PoolStats {
+	pools.mu.Lock()
+	defer pools.mu.Unlock()
+	ps := make([]PoolStats, 0, len(pools.m))
+	for name, db := range pools.m {
+		ps = append(ps, PoolStats{Name: name, DBStats: db.Stats()})
+	}
+	sort.Slice(ps, func(i, j int) bool { return ps[i].Name < ps[j].Name })
+	return ps
+}
+
+var (
+	// PoolName tags pool measurements with the name the pool was
+	// registered under.
+	PoolName = tag.MustNewKey("todo_app.db_pool")
+
+	poolOpen = stats.Int64(
+		"todo_app/db/pool/open",
+		"Number of open connections",
+		stats.UnitDimensionless,
+	)
+	poolInUse = stats.Int64(
+		"todo_app/db/pool/in_use",
+		"Number of connections in use",
+		stats.UnitDimensionless,
+	)
+	poolIdle = stats.Int64(
+		"todo_app/db/pool/idle",
+		"Number of idle connections",
+		stats.UnitDimensionless,
+	)
+	poolWaitCount = stats.Int64(
+		"todo_app/db/pool/wait_count",
+		"Total number of connections waited for",
+		stats.UnitDimensionless,
+	)
+	poolWaitDuration = stats.Float64(
+		"todo_app/db/pool/wait_duration",
+		"Total time spent waiting for connections",
+		stats.UnitMilliseconds,
+	)
+
+	// PoolViews report the latest stats of each registered pool.
+	PoolViews = []*view.View{
+		poolView(poolOpen),
+		poolView(poolInUse),
+		poolView(poolIdle),
+		poolView(poolWaitCount),
+		poolView(poolWaitDuration),
+	}
+)
+
+func poolView(m stats.Measure) *view.View {
+	return &view.View{
+		Name:        m.Name(),
+		Description: m.Description(),
+		TagKeys:     []tag.Key{PoolName},
+		Measure:     m,
+		Aggregation: view.LastValue(),
+	}
+}
+
+// RecordPoolStats records the stats of the registered pools every interval,
+// until the returned function is called.
+func RecordPoolStats(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				recordPoolStats()
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+func recordPoolStats() {
+	for _, p := range Pools() {
+		ctx, err := tag.New(context.Background(), tag.Upsert(PoolName, p.Name))
+		if err != nil {
+			log.Errorf("recordPoolStats(%q): %v", p.Name, err)
+			continue
+		}
+		stats.Record(ctx,
+			poolOpen.M(int64(p.OpenConnections)),
+			poolInUse.M(int64(p.InUse)),
+			poolIdle.M(int64(p.Idle)),
+			poolWaitCount.M(p.WaitCount),
+			poolWaitDuration.M(float64(p.WaitDuration)/float64(time.Millisecond)),
+		)
+	}
+}
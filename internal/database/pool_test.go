@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"go.opencensus.io/stats/view"
+)
+
+func TestRecordPoolStats(t *testing.T) {
+	if err := view.Register(PoolViews...); err != nil {
+		t.Fatal(err)
+	}
+	defer view.Unregister(PoolViews...)
+
+	db := openTestDB(t)
+	RegisterPool("pool_test", db)
+
+	// Hold a connection, so that the pool has one in use.
+	conn, err := db.db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordPoolStats()
+	conn.Close()
+
+	for name, want := range map[string]float64{poolOpen.Name(): 1, poolInUse.Name(): 1, poolIdle.Name(): 0} {
+		rows, err := view.RetrieveData(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := 0.0, false
+		for _, row := range rows {
+			if len(row.Tags) == 1 && row.Tags[0].Key == PoolName && row.Tags[0].Value == "pool_test" {
+				got, ok = row.Data.(*view.LastValueData).Value, true
+			}
+		}
+		if !ok || got != want {
+			t.Errorf("%s = %v (recorded: %t), want %v", name, got, ok, want)
+		}
+	}
+
+	found := false
+	for _, p := range Pools() {
+		found = found || p.Name == "pool_test"
+	}
+	if !found {
+		t.Error("Pools() does not list the registered pool")
+	}
+	db.Close()
+	for _, p := range Pools() {
+		if p.Name == "pool_test" {
+			t.Error("Pools() lists a closed pool")
+		}
+	}
+}
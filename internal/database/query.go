@@ -0,0 +1,114 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// NotFoundError is returned by QueryOne when its query returns no rows. It
+// matches sql.ErrNoRows with errors.Is.
+type NotFoundError struct {
+	// Type is the type that QueryOne was asked to scan.
+	Type reflect.Type
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("no %s found", e.Type)
+}
+
+func (e *NotFoundError) Is(target error) bool {
+	return target == sql.ErrNoRows
+}
+
+// QueryAll runs query and returns its rows scanned into values of type T.
+//
+// If T is a struct, columns are matched to its fields as ScanStruct does.
+// Otherwise, including when *T implements sql.Scanner or T is time.Time, the
+// query must return a single column, which is scanned into T.
+//
+// Example:
+//
+//	players, err := database.QueryAll[Player](ctx, db, "SELECT name, score FROM players")
+func QueryAll[T any](ctx context.Context, db *DB, query string, args ...interface{}) ([]T, error) {
+	scan := scannerFor[T]()
+	var ts []T
+	err := db.RunQuery(ctx, query, func(rows *sql.Rows) error {
+		var t T
+		if err := scan(rows, &t); err != nil {
+			return err
+		}
+		ts = append(ts, t)
+		return nil
+	}, args...)
+	if err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+// QueryOne runs query and returns its first row scanned into a T, as QueryAll
+// does. If there are no rows, it returns a *NotFoundError.
+func QueryOne[T any](ctx context.Context, db *DB, query string, args ...interface{}) (T, error) {
+	scan := scannerFor[T]()
+	var t T
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return t, err
+	}
+	defer rows.Close()
+	// The rows after the first are not read.
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return t, err
+		}
+		return t, &NotFoundError{Type: reflect.TypeOf(t)}
+	}
+	if err := scan(rows, &t); err != nil {
+		return t, err
+	}
+	return t, rows.Close()
+}
+
+// QueryIter runs query with RunQueryIncrementally, calling f on each row
+// scanned into a T, as QueryAll does. Like RunQueryIncrementally, it stops
+// when there are no more rows, or when f returns io.EOF.
+func QueryIter[T any](ctx context.Context, db *DB, query string, batchSize int, f func(T) error, args ...interface{}) error {
+	scan := scannerFor[T]()
+	return db.RunQueryIncrementally(ctx, query, batchSize, func(rows *sql.Rows) error {
+		var t T
+		if err := scan(rows, &t); err != nil {
+			return err
+		}
+		return f(t)
+	}, args...)
+}
+
+// typeScanners caches the functions returned by scannerFor.
+var typeScanners sync.Map // reflect.Type -> func(*sql.Rows, *T) error
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+)
+
+// scannerFor returns a function that scans the current row into a T. The
+// decision of how to scan a T is made once per type; the mapping of columns
+// to the fields of a struct is cached by ScanStruct.
+func scannerFor[T any]() func(*sql.Rows, *T) error {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if f, ok := typeScanners.Load(t); ok {
+		return f.(func(*sql.Rows, *T) error)
+	}
+	var f func(*sql.Rows, *T) error
+	if t.Kind() == reflect.Struct && !isScalar(t) {
+		f = func(rows *sql.Rows, p *T) error { return ScanStruct(rows, p) }
+	} else {
+		f = func(rows *sql.Rows, p *T) error { return rows.Scan(p) }
+	}
+	g, _ := typeScanners.LoadOrStore(t, f)
+	return g.(func(*sql.Rows, *T) error)
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+type row struct {
+	ID   int64
+	Name string
+	Note *string
+}
+
+func openTestDB(t *testing.T) *DB {
+	t.Helper()
+	sdb, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sdb.SetMaxOpenConns(1)
+	db := New(sdb)
+	t.Cleanup(func() { db.Close() })
+	ctx := context.Background()
+	if _, err := db.Exec(ctx, "CREATE TABLE rows (id INTEGER PRIMARY KEY, name TEXT NOT NULL, note TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(ctx, "INSERT INTO rows VALUES (1, 'a', NULL), (2, 'b', 'x')"); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestQueryAll(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	for i := 0; i < 2; i++ { // the second time, with cached scanners
+		rows, err := QueryAll[row](ctx, db, "SELECT note, name, id FROM rows ORDER BY id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 2 || rows[0].ID != 1 || rows[0].Name != "a" || rows[0].Note != nil || rows[1].Note == nil || *rows[1].Note != "x" {
+			t.Errorf("got %+v", rows)
+		}
+	}
+
+	if _, ok := typeScanners.Load(reflect.TypeOf(row{})); !ok {
+		t.Error("scanner for row was not cached")
+	}
+
+	names, err := QueryAll[string](ctx, db, "SELECT name FROM rows ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Errorf("got %q, want [a b]", names)
+	}
+
+	if _, err := QueryAll[row](ctx, db, "SELECT id, name AS title FROM rows"); err == nil {
+		t.Error("got nil error for a column without a field")
+	}
+}
+
+func TestQueryOne(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	r, err := QueryOne[row](ctx, db, "SELECT id, name FROM rows WHERE id = ?", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ID != 2 || r.Name != "b" {
+		t.Errorf("got %+v", r)
+	}
+
+	r, err = QueryOne[row](ctx, db, "SELECT id, name FROM rows ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ID != 1 || r.Name != "a" {
+		t.Errorf("QueryOne of several rows = %+v, want the first", r)
+	}
+
+	_, err = QueryOne[row](ctx, db, "SELECT id FROM rows WHERE id = ?", 3)
+	var nf *NotFoundError
+	if !errors.As(err, &nf) || !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("got %v, want a *NotFoundError", err)
+	}
+	if got, want := nf.Error(), "no database.row found"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
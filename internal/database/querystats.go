@@ -0,0 +1,178 @@
+package database
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+const (
+	// maxQueryStats bounds the number of normalized queries with their own
+	// statistics. Later queries are counted under otherQueries.
+	maxQueryStats = 1000
+	// querySamples is the number of latest durations per query that the
+	// percentiles are computed from.
+	querySamples = 1024
+	// maxNormalizedLen is the maximum length of a normalized query.
+	maxNormalizedLen = 2000
+
+	otherQueries = "(other queries)"
+)
+
+// slowQueryThreshold is the duration, in nanoseconds, from which queries are
+// logged as slow. Zero disables the slow query log.
+var slowQueryThreshold int64 // atomic
+
+// SetSlowQueryThreshold makes queries that take d or longer be logged as
+// warnings, with their normalized text. Zero disables the slow query log.
+func SetSlowQueryThreshold(d time.Duration) {
+	atomic.StoreInt64(&slowQueryThreshold, int64(d))
+}
+
+var (
+	// stringLiteral matches SQL string literals, including escaped quotes.
+	stringLiteral = regexp.MustCompile(`'(?:[^']|'')*'`)
+	// numberOrParam matches numeric literals and positional parameters that
+	// are not part of an identifier.
+	numberOrParam = regexp.MustCompile(`(?:\$|\b)\d+(?:\.\d+)?\b`)
+	// valueList matches lists of two or more values, such as the arguments
+	// of IN.
+	valueList = regexp.MustCompile(`\?(?:, ?\?)+`)
+	// rowList matches lists of two or more rows, such as those of a
+	// multi-row INSERT.
+	rowList = regexp.MustCompile(`(\(\?(?:, \.\.\.)?\))(?:, ?\(\?(?:, \.\.\.)?\))+`)
+)
+
+// normalizedQueries caches normalizeQuery, for queries up to this many.
+var normalizedQueries = struct {
+	sync.Mutex
+	m map[string]string
+}{m: map[string]string{}}
+
+const maxNormalizedQueries = 10000
+
+// normalizeQuery returns query with its whitespace collapsed and its literal
+// values and parameters replaced by ?, so that queries that differ only in
+// their values, or in the number of values in a list, look the same.
+func normalizeQuery(query string) string {
+	normalizedQueries.Lock()
+	n, ok := normalizedQueries.m[query]
+	normalizedQueries.Unlock()
+	if ok {
+		return n
+	}
+
+	n = strings.Join(strings.FieldsFunc(query, unicode.IsSpace), " ")
+	n = stringLiteral.ReplaceAllString(n, "?")
+	n = numberOrParam.ReplaceAllString(n, "?")
+	n = valueList.ReplaceAllString(n, "?, ...")
+	n = rowList.ReplaceAllString(n, "$1, ...")
+	if len(n) > maxNormalizedLen {
+		n = n[:maxNormalizedLen] + "..."
+	}
+
+	normalizedQueries.Lock()
+	if len(normalizedQueries.m) < maxNormalizedQueries {
+		normalizedQueries.m[query] = n
+	}
+	normalizedQueries.Unlock()
+	return n
+}
+
+// queryStat accumulates the executions of a normalized query.
+type queryStat struct {
+	count, errors int64
+	total, max    time.Duration
+	samples       []time.Duration // ring of the latest durations
+	next          int
+}
+
+var queryStats = struct {
+	sync.Mutex
+	m map[string]*queryStat
+}{m: map[string]*queryStat{}}
+
+// recordQuery adds an execution of the normalized query to its statistics.
+func recordQuery(normalized string, d time.Duration, failed bool) {
+	queryStats.Lock()
+	defer queryStats.Unlock()
+
+	s, ok := queryStats.m[normalized]
+	if !ok {
+		if len(queryStats.m) >= maxQueryStats {
+			normalized = otherQueries
+			s = queryStats.m[normalized]
+		}
+		if s == nil {
+			s = &queryStat{}
+			queryStats.m[normalized] = s
+		}
+	}
+	s.count++
+	if failed {
+		s.errors++
+	}
+	s.total += d
+	if d > s.max {
+		s.max = d
+	}
+	if len(s.samples) < querySamples {
+		s.samples = append(s.samples, d)
+	} else {
+		s.samples[s.next] = d
+		s.next = (s.next + 1) % querySamples
+	}
+}
+
+// QueryStat holds the statistics of a normalized query. The percentiles are
+// those of its latest executions.
+type QueryStat struct {
+	Query         string
+	Count, Errors int64
+	Total, Max    time.Duration
+	P50, P95, P99 time.Duration
+}
+
+// QueryStats returns the statistics of the queries run since the process
+// started, sorted by decreasing total time.
+func QueryStats() []QueryStat {
+	queryStats.Lock()
+	stats := make([]QueryStat, 0, len(queryStats.m))
+	samples := make([][]time.Duration, 0, len(queryStats.m))
+	for q, s := range queryStats.m {
+		stats = append(stats, QueryStat{Query: q, Count: s.count, Errors: s.errors, Total: s.total, Max: s.max})
+		samples = append(samples, append([]time.Duration(nil), s.samples...))
+	}
+	queryStats.Unlock()
+
+	for k, ds := range samples {
+		sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+		stats[k].P50 = percentile(ds, 50)
+		stats[k].P95 = percentile(ds, 95)
+		stats[k].P99 = percentile(ds, 99)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Total != stats[j].Total {
+			return stats[i].Total > stats[j].Total
+		}
+		return stats[i].Query < stats[j].Query
+	})
+	return stats
+}
+
+// percentile returns the p-th percentile of the sorted durations ds, using
+// the nearest rank.
+func percentile(ds []time.Duration, p int) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	rank := (p*len(ds) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return ds[rank-1]
+}
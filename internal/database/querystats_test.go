@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNormalizeQuery(t *testing.T) {
+	for _, test := range []struct {
+		in, want string
+	}{
+		{"SELECT id\n\t FROM tasks   WHERE id = $1", "SELECT id FROM tasks WHERE id = ?"},
+		{"SELECT * FROM t WHERE name = 'it''s' AND n > 3.5 LIMIT 10", "SELECT * FROM t WHERE name = ? AND n > ? LIMIT ?"},
+		{"SELECT * FROM t1 WHERE id IN ($1, $2, $3)", "SELECT * FROM t1 WHERE id IN (?, ...)"},
+		{"INSERT INTO t (a, b) VALUES ($1, $2), ($3, $4), ($5, $6)", "INSERT INTO t (a, b) VALUES (?, ...), ..."},
+		{"INSERT INTO t (a) VALUES ($1), ($2)", "INSERT INTO t (a) VALUES (?), ..."},
+		{"SAVEPOINT sp_1", "SAVEPOINT sp_1"},
+		{"FETCH 5000 FROM c", "FETCH ? FROM c"},
+	} {
+		if got := normalizeQuery(test.in); got != test.want {
+			t.Errorf("normalizeQuery(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestQueryStats(t *testing.T) {
+	const query = "SELECT querystats_test"
+	for k := 1; k <= 100; k++ {
+		recordQuery(query, time.Duration(k)*time.Millisecond, k%10 == 0)
+	}
+	for _, s := range QueryStats() {
+		if s.Query != query {
+			continue
+		}
+		want := QueryStat{
+			Query:  query,
+			Count:  100,
+			Errors: 10,
+			Total:  5050 * time.Millisecond,
+			Max:    100 * time.Millisecond,
+			P50:    50 * time.Millisecond,
+			P95:    95 * time.Millisecond,
+			P99:    99 * time.Millisecond,
+		}
+		if s != want {
+			t.Errorf("got %+v, want %+v", s, want)
+		}
+		return
+	}
+	t.Errorf("no statistics for %q", query)
+}
+
+func TestQueryRowStats(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	stat := func(query string) QueryStat {
+		t.Helper()
+		for _, s := range QueryStats() {
+			if s.Query == normalizeQuery(query) {
+				return s
+			}
+		}
+		t.Fatalf("no statistics for %q", query)
+		return QueryStat{}
+	}
+
+	const missing = "SELECT name FROM querystats_missing WHERE id = 1"
+	var name string
+	if err := db.QueryRow(ctx, missing).Scan(&name); err == nil {
+		t.Fatal("QueryRow on a missing table succeeded")
+	}
+	if s := stat(missing); s.Count != 1 || s.Errors != 1 {
+		t.Errorf("failed query: got %+v, want 1 execution with 1 error", s)
+	}
+
+	// A query that finds no row did not fail.
+	const none = "SELECT name FROM rows WHERE id = 1 AND id <> 1"
+	if err := db.QueryRow(ctx, none).Scan(&name); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("got %v, want sql.ErrNoRows", err)
+	}
+	row := db.QueryRow(ctx, none)
+	row.Err()
+	row.Scan(&name)
+	if s := stat(none); s.Count != 2 || s.Errors != 0 {
+		t.Errorf("query without rows: got %+v, want 2 executions without errors", s)
+	}
+}
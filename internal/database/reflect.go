@@ -7,6 +7,8 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strings"
+	"sync"
 	"unicode"
 	"unicode/utf8"
 
@@ -17,6 +19,9 @@ import (
 // struct pointer of that type, returns a slice of arguments suitable for
 // Row.Scan or Rows.Scan. The call to either Scan will populate the exported
 // fields of the struct in the order they appear in the type definition.
+// Fields tagged `db:"-"` are skipped, and the fields of embedded structs are
+// scanned in place of the embedded struct, unless it is scanned as a single
+// value, like time.Time or a type implementing sql.Scanner.
 //
 // StructScanner panics if p is not a struct or a pointer to a struct.
 // The function it returns will panic if its argument is not a pointer
@@ -34,6 +39,8 @@ import (
 //	    // use p
 //	    return nil
 //	})
+//
+// To match columns by name instead, use ScanStruct or StructScannerForColumns.
 func StructScanner(s interface{}) func(p interface{}) []interface{} {
 	v := reflect.ValueOf(s)
 	if v.Kind() == reflect.Ptr {
@@ -42,30 +49,153 @@ func StructScanner(s interface{}) func(p interface{}) []interface{} {
 	return structScannerForType(v.Type())
 }
 
+// StructScannerForColumns is like StructScanner, but the returned function
+// returns arguments for the given columns, in order. A field is matched by
+// its `db:"column"` tag or, if it has none, by its name in snake case, so
+// that CreatedAt matches created_at. If several fields match a column, the
+// least deeply embedded one wins, and then the first declared. It is an
+// error for a column to match no field.
+func StructScannerForColumns(s interface{}, columns []string) (func(p interface{}) []interface{}, error) {
+	v := reflect.ValueOf(s)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	return structScannerForColumns(v.Type(), columns)
+}
+
+// ScanStruct scans the current row of rows into the struct p points to,
+// matching columns to fields as StructScannerForColumns does. The mapping is
+// computed once per struct type and list of columns.
+//
+// Example:
+//
+//	err := db.RunQuery(ctx, "SELECT score, name FROM players", func(rows *sql.Rows) error {
+//	    var p Player
+//	    if err := database.ScanStruct(rows, &p); err != nil {
+//	        return err
+//	    }
+//	    // use p
+//	    return nil
+//	})
+func ScanStruct(rows *sql.Rows, p interface{}) error {
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	v := reflect.ValueOf(p)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("ScanStruct: %T is not a pointer to a struct", p)
+	}
+	key := columnScannerKey{v.Elem().Type(), strings.Join(columns, ",")}
+	scanner, ok := columnScanners.Load(key)
+	if !ok {
+		f, err := structScannerForColumns(key.t, columns)
+		if err != nil {
+			return err
+		}
+		scanner, _ = columnScanners.LoadOrStore(key, f)
+	}
+	return rows.Scan(scanner.(func(p interface{}) []interface{})(p)...)
+}
+
+type columnScannerKey struct {
+	t       reflect.Type
+	columns string
+}
+
+// columnScanners caches the functions built by ScanStruct.
+var columnScanners sync.Map // columnScannerKey -> func(p interface{}) []interface{}
+
 type fieldInfo struct {
-	num  int // to pass to v.Field
-	kind reflect.Kind
+	index  []int // to pass to v.FieldByIndex
+	kind   reflect.Kind
+	column string
+}
+
+// structFields returns the fields of t that columns are scanned into, in the
+// order they appear in the type definition, with embedded structs flattened.
+// Embedded structs that are scanned as a single value, like time.Time and
+// sql.NullString, are not flattened.
+func structFields(t reflect.Type, index []int) []fieldInfo {
+	var fields []fieldInfo
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		r, _ := utf8.DecodeRuneInString(f.Name)
+		tag := f.Tag.Get("db")
+		if !unicode.IsUpper(r) || tag == "-" {
+			continue
+		}
+		fi := append(append([]int(nil), index...), i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && tag == "" && !isScalar(f.Type) {
+			fields = append(fields, structFields(f.Type, fi)...)
+			continue
+		}
+		if tag == "" {
+			tag = snakeCase(f.Name)
+		}
+		fields = append(fields, fieldInfo{fi, f.Type.Kind(), tag})
+	}
+	return fields
+}
+
+// isScalar reports whether a column is scanned into a struct of type t as a
+// whole, rather than into its fields.
+func isScalar(t reflect.Type) bool {
+	return t == timeType || reflect.PtrTo(t).Implements(scannerType)
+}
+
+// snakeCase converts a Go field name like CreatedAt or UserID to created_at
+// or user_id.
+func snakeCase(name string) string {
+	rs := []rune(name)
+	var b strings.Builder
+	for k, r := range rs {
+		if unicode.IsUpper(r) {
+			if k > 0 && (!unicode.IsUpper(rs[k-1]) || k+1 < len(rs) && unicode.IsLower(rs[k+1])) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
 }
 
 func structScannerForType(t reflect.Type) func(p interface{}) []interface{} {
 	if t.Kind() != reflect.Struct {
 		panic(fmt.Sprintf("%s is not a struct", t))
 	}
+	return scanArgs(structFields(t, nil))
+}
 
-	// Collect the numbers of the exported fields.
-	var fieldInfos []fieldInfo
-	for i := 0; i < t.NumField(); i++ {
-		r, _ := utf8.DecodeRuneInString(t.Field(i).Name)
-		if unicode.IsUpper(r) {
-			fieldInfos = append(fieldInfos, fieldInfo{i, t.Field(i).Type.Kind()})
+func structScannerForColumns(t reflect.Type, columns []string) (func(p interface{}) []interface{}, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s is not a struct", t)
+	}
+	byColumn := map[string]fieldInfo{}
+	for _, f := range structFields(t, nil) {
+		if g, ok := byColumn[f.column]; !ok || len(f.index) < len(g.index) {
+			byColumn[f.column] = f
+		}
+	}
+	fields := make([]fieldInfo, len(columns))
+	for k, c := range columns {
+		f, ok := byColumn[c]
+		if !ok {
+			return nil, fmt.Errorf("column %q has no destination in %s", c, t)
 		}
+		fields[k] = f
 	}
-	// Return a function that gets pointers to the exported fields.
+	return scanArgs(fields), nil
+}
+
+// scanArgs returns a function that gets pointers to the given fields.
+func scanArgs(fields []fieldInfo) func(p interface{}) []interface{} {
 	return func(p interface{}) []interface{} {
 		v := reflect.ValueOf(p).Elem()
-		var ps []interface{}
-		for _, info := range fieldInfos {
-			p := v.Field(info.num).Addr().Interface()
+		ps := make([]interface{}, 0, len(fields))
+		for _, info := range fields {
+			p := v.FieldByIndex(info.index).Addr().Interface()
 			switch info.kind {
 			case reflect.Slice:
 				if _, ok := p.(*[]byte); !ok {
@@ -120,7 +250,8 @@ func (n nullPtr) Value() (driver.Value, error) {
 }
 
 // CollectStructs scans the the rows from the query into structs and appends
-// them to pslice, which must be a pointer to a slice of structs.
+// them to pslice, which must be a pointer to a slice of structs. QueryAll
+// does the same with static types, matching columns by name.
 // Example:
 //
 //	type Player struct { Name string; Score int }
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type Base struct {
+	ID      int64
+	Name    string
+	Comment string
+}
+
+type player struct {
+	Base
+	Name    string `db:"display_name"`
+	Score   int
+	Ignored string `db:"-"`
+	Comment string
+	secret  string
+}
+
+func TestStructScannerPositional(t *testing.T) {
+	var p player
+	args := StructScanner(player{})(&p)
+	want := []interface{}{&p.ID, &p.Base.Name, &p.Base.Comment, &p.Name, &p.Score, &p.Comment}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("got %d args, want %d in declaration order", len(args), len(want))
+	}
+}
+
+func TestStructScannerForColumns(t *testing.T) {
+	var p player
+	scan, err := StructScannerForColumns(player{}, []string{"score", "display_name", "name", "comment", "id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// comment is both in Base and player: the shallower field wins.
+	want := []interface{}{&p.Score, &p.Name, &p.Base.Name, &p.Comment, &p.ID}
+	if got := scan(&p); !reflect.DeepEqual(got, want) {
+		t.Error("columns were not matched to the expected fields")
+	}
+
+	for _, c := range []string{"ignored", "secret", "base", "nope"} {
+		_, err := StructScannerForColumns(player{}, []string{"id", c})
+		if err == nil || !strings.Contains(err.Error(), c) {
+			t.Errorf("column %q: got error %v, want one naming the column", c, err)
+		}
+	}
+}
+
+type stamped struct {
+	time.Time
+	ID int64
+}
+
+type annotated struct {
+	sql.NullString
+	ID int64
+}
+
+func TestStructScannerEmbeddedScalars(t *testing.T) {
+	// An embedded time.Time is scanned as a whole, as the column "time".
+	var s stamped
+	if got, want := StructScanner(stamped{})(&s), []interface{}{&s.Time, &s.ID}; !reflect.DeepEqual(got, want) {
+		t.Errorf("time.Time: got %d args, want %d", len(got), len(want))
+	}
+	scan, err := StructScannerForColumns(stamped{}, []string{"id", "time"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := scan(&s), []interface{}{&s.ID, &s.Time}; !reflect.DeepEqual(got, want) {
+		t.Error("time.Time: columns were not matched to the expected fields")
+	}
+
+	// So is an embedded type whose pointer is a sql.Scanner.
+	var a annotated
+	if got, want := StructScanner(annotated{})(&a), []interface{}{&a.NullString, &a.ID}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sql.NullString: got %d args, want %d", len(got), len(want))
+	}
+	if _, err := StructScannerForColumns(annotated{}, []string{"string"}); err == nil {
+		t.Error("sql.NullString: the String field was flattened")
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	for in, want := range map[string]string{
+		"Id":        "id",
+		"CreatedAt": "created_at",
+		"UserID":    "user_id",
+		"HTTPPort":  "http_port",
+		"LegacyId":  "legacy_id",
+	} {
+		if got := snakeCase(in); got != want {
+			t.Errorf("snakeCase(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
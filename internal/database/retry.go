@@ -0,0 +1,192 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"math/rand"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/lib/pq"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// RetryPolicy says how Transact retries transactions when they fail with a
+// deadlock, a reset connection or, at the repeatable read and serializable
+// isolation levels, a serialization failure.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a transaction is tried, including
+	// the first. Values below 1 mean 1.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry. It doubles with every
+	// retry, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Jitter picks every delay uniformly between zero and its value ("full
+	// jitter"), so that conflicting transactions do not retry in lockstep.
+	Jitter bool
+}
+
+// DefaultRetryPolicy is the RetryPolicy of a new DB.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 11,
+	BaseDelay:   125 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+	Jitter:      true,
+}
+
+// delay returns the delay before the given retry, counting from 1.
+func (p RetryPolicy) delay(retry int) time.Duration {
+	d := p.BaseDelay
+	for k := 1; k < retry && d < p.MaxDelay; k++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if p.Jitter && d > 0 {
+		jitter.mu.Lock()
+		d = time.Duration(jitter.r.Int63n(int64(d) + 1))
+		jitter.mu.Unlock()
+	}
+	return d
+}
+
+var jitter = struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}{r: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// SetRetryPolicy sets the RetryPolicy of the transactions of db.
+func (db *DB) SetRetryPolicy(p RetryPolicy) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.retryPolicy = &p
+}
+
+type retryPolicyKey struct{}
+
+// WithRetryPolicy returns a copy of ctx that makes Transact use p instead of
+// the RetryPolicy of the DB.
+func WithRetryPolicy(ctx context.Context, p RetryPolicy) context.Context {
+	return context.WithValue(ctx, retryPolicyKey{}, p)
+}
+
+// retryPolicyFor returns the RetryPolicy for a transaction run with ctx.
+func (db *DB) retryPolicyFor(ctx context.Context) RetryPolicy {
+	if p, ok := ctx.Value(retryPolicyKey{}).(RetryPolicy); ok {
+		return p
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.retryPolicy != nil {
+		return *db.retryPolicy
+	}
+	return DefaultRetryPolicy
+}
+
+// sleep waits for d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// deadlockDetectedCode is the Postgres error code returned when a
+// transaction is aborted to break a deadlock.
+const deadlockDetectedCode = "40P01"
+
+// Reasons for retrying a transaction, as recorded in metrics.
+const (
+	retrySerializationFailure = "serialization_failure"
+	retryDeadlock             = "deadlock"
+	retryConnectionReset      = "connection_reset"
+)
+
+// retryReason returns why a transaction that failed with err can be
+// retried, or "" if it cannot. A connection reset while committing is not
+// retried, since the transaction may have been committed.
+func retryReason(err error) string {
+	switch pgCode(err) {
+	case serializationFailureCode:
+		return retrySerializationFailure
+	case deadlockDetectedCode:
+		return retryDeadlock
+	}
+	var cerr *commitError
+	if (errors.Is(err, driver.ErrBadConn) || errors.Is(err, syscall.ECONNRESET)) && !errors.As(err, &cerr) {
+		return retryConnectionReset
+	}
+	return ""
+}
+
+// pgCode returns the Postgres error code of err, if any. The underlying
+// error type depends on the driver, so both pq and pgx types are tried.
+func pgCode(err error) string {
+	var perr *pq.Error
+	if errors.As(err, &perr) {
+		return string(perr.Code)
+	}
+	var gerr *pgconn.PgError
+	if errors.As(err, &gerr) {
+		return gerr.Code
+	}
+	return ""
+}
+
+// commitError is an error returned by committing a transaction.
+type commitError struct {
+	err error
+}
+
+func (e *commitError) Error() string { return "tx.Commit(): " + e.err.Error() }
+func (e *commitError) Unwrap() error { return e.err }
+
+var (
+	// RetryReason tags transaction retries with why they happened.
+	RetryReason = tag.MustNewKey("todo_app.db_retry_reason")
+
+	transactionRetries = stats.Int64(
+		"todo_app/db/transaction_retries",
+		"Number of transactions retried",
+		stats.UnitDimensionless,
+	)
+	transactionRetriesExhausted = stats.Int64(
+		"todo_app/db/transaction_retries_exhausted",
+		"Number of transactions that failed after every attempt allowed by their retry policy",
+		stats.UnitDimensionless,
+	)
+
+	// RetryViews count transaction retries and transactions that ran out of
+	// attempts, by reason.
+	RetryViews = []*view.View{
+		{
+			Name:        transactionRetries.Name(),
+			Description: transactionRetries.Description(),
+			TagKeys:     []tag.Key{RetryReason},
+			Measure:     transactionRetries,
+			Aggregation: view.Count(),
+		},
+		{
+			Name:        transactionRetriesExhausted.Name(),
+			Description: transactionRetriesExhausted.Description(),
+			TagKeys:     []tag.Key{RetryReason},
+			Measure:     transactionRetriesExhausted,
+			Aggregation: view.Count(),
+		},
+	}
+)
+
+func recordRetry(ctx context.Context, m *stats.Int64Measure, reason string) {
+	stats.RecordWithTags(ctx, []tag.Mutator{tag.Upsert(RetryReason, reason)}, m.M(1))
+}
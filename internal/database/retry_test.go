@@ -0,0 +1,158 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/lib/pq"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for retry, want := range map[int]time.Duration{
+		1:  100 * time.Millisecond,
+		2:  200 * time.Millisecond,
+		4:  800 * time.Millisecond,
+		5:  time.Second,
+		50: time.Second,
+	} {
+		if got := p.delay(retry); got != want {
+			t.Errorf("delay(%d) = %s, want %s", retry, got, want)
+		}
+	}
+
+	p.Jitter = true
+	for k := 0; k < 100; k++ {
+		if d := p.delay(3); d < 0 || d > 400*time.Millisecond {
+			t.Fatalf("delay(3) with jitter = %s, want at most 400ms", d)
+		}
+	}
+}
+
+func TestRetryReason(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		want string
+	}{
+		{nil, ""},
+		{errors.New("boom"), ""},
+		{&pq.Error{Code: "40001"}, retrySerializationFailure},
+		{fmt.Errorf("txFunc(tx): %w", &pgconn.PgError{Code: "40P01"}), retryDeadlock},
+		{&pgconn.PgError{Code: "23505"}, ""},
+		{driver.ErrBadConn, retryConnectionReset},
+		{fmt.Errorf("read: %w", syscall.ECONNRESET), retryConnectionReset},
+		{&commitError{syscall.ECONNRESET}, ""},
+	} {
+		if got := retryReason(test.err); got != test.want {
+			t.Errorf("retryReason(%v) = %q, want %q", test.err, got, test.want)
+		}
+	}
+}
+
+func TestTransactRetry(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	db.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+
+	// SQLite ignores the isolation level, but Transact only retries at
+	// levels that need it.
+	serializationFailure := &pq.Error{Code: "40001"}
+	calls := 0
+	err := db.Transact(ctx, sql.LevelSerializable, func(*DB) error {
+		calls++
+		if calls < 3 {
+			return serializationFailure
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("got %v after %d calls, want success after 3", err, calls)
+	}
+
+	calls = 0
+	err = db.Transact(ctx, sql.LevelSerializable, func(*DB) error {
+		calls++
+		return serializationFailure
+	})
+	if !errors.Is(err, serializationFailure) || calls != 3 {
+		t.Errorf("got %v after %d calls, want a serialization failure after 3", err, calls)
+	}
+
+	calls = 0
+	err = db.Transact(WithRetryPolicy(ctx, RetryPolicy{MaxAttempts: 1}), sql.LevelSerializable, func(*DB) error {
+		calls++
+		return serializationFailure
+	})
+	if !errors.Is(err, serializationFailure) || calls != 1 {
+		t.Errorf("with a per-call policy: got %v after %d calls, want 1 call", err, calls)
+	}
+
+	calls = 0
+	err = db.Transact(ctx, sql.LevelDefault, func(*DB) error {
+		calls++
+		return serializationFailure
+	})
+	if !errors.Is(err, serializationFailure) || calls != 1 {
+		t.Errorf("default isolation level: got %v after %d calls, want a serialization failure after 1", err, calls)
+	}
+}
+
+func TestTransactRetryDeadlock(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	db.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+
+	// Deadlocks and reset connections can happen at any isolation level.
+	for _, failure := range []error{&pgconn.PgError{Code: "40P01"}, driver.ErrBadConn} {
+		calls := 0
+		err := db.Transact(ctx, sql.LevelDefault, func(*DB) error {
+			calls++
+			if calls < 2 {
+				return failure
+			}
+			return nil
+		})
+		if err != nil || calls != 2 {
+			t.Errorf("%v: got %v after %d calls, want success after 2", failure, err, calls)
+		}
+	}
+
+	// Only the outermost transaction is retried.
+	calls, nestedCalls := 0, 0
+	err := db.Transact(ctx, sql.LevelDefault, func(tx *DB) error {
+		calls++
+		return tx.Transact(ctx, sql.LevelDefault, func(*DB) error {
+			nestedCalls++
+			if calls < 2 {
+				return &pgconn.PgError{Code: "40P01"}
+			}
+			return nil
+		})
+	})
+	if err != nil || calls != 2 || nestedCalls != 2 {
+		t.Errorf("nested: got %v after %d calls and %d nested calls, want success after 2 of each", err, calls, nestedCalls)
+	}
+}
+
+func TestTransactRetryCanceled(t *testing.T) {
+	db := openTestDB(t)
+	db.SetRetryPolicy(RetryPolicy{MaxAttempts: 10, BaseDelay: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	calls := 0
+	err := db.Transact(ctx, sql.LevelSerializable, func(*DB) error {
+		calls++
+		return &pq.Error{Code: "40001"}
+	})
+	if !errors.Is(err, context.DeadlineExceeded) || calls != 1 {
+		t.Errorf("got %v after %d calls, want the context error after 1", err, calls)
+	}
+}
@@ -0,0 +1,184 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func insertRow(ctx context.Context, db *DB, id int) error {
+	_, err := db.Exec(ctx, "INSERT INTO rows (id, name) VALUES (?, 'n')", id)
+	return err
+}
+
+func rowIDs(t *testing.T, db *DB) []int {
+	t.Helper()
+	ids, err := db.CollectInts(context.Background(), "SELECT id FROM rows WHERE id > 2 ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func TestTransactNested(t *testing.T) {
+	ctx := context.Background()
+	errInner := errors.New("inner")
+
+	for _, test := range []struct {
+		name  string
+		inner func(*DB) error
+		want  []int
+	}{
+		{
+			name:  "commit",
+			inner: func(tx *DB) error { return insertRow(ctx, tx, 4) },
+			want:  []int{3, 4, 5},
+		},
+		{
+			name: "error",
+			inner: func(tx *DB) error {
+				if err := insertRow(ctx, tx, 4); err != nil {
+					return err
+				}
+				return errInner
+			},
+			want: []int{3, 5},
+		},
+		{
+			name: "failed statement",
+			inner: func(tx *DB) error {
+				if err := insertRow(ctx, tx, 4); err != nil {
+					return err
+				}
+				return insertRow(ctx, tx, 3)
+			},
+			want: []int{3, 5},
+		},
+		{
+			name: "recovered panic",
+			inner: func(tx *DB) (err error) {
+				defer func() {
+					if recover() != nil {
+						err = errInner
+					}
+				}()
+				return tx.Transact(ctx, sql.LevelDefault, func(tx *DB) error {
+					if err := insertRow(ctx, tx, 4); err != nil {
+						return err
+					}
+					panic("inner")
+				})
+			},
+			want: []int{3, 5},
+		},
+		{
+			name: "deeper",
+			inner: func(tx *DB) error {
+				if err := insertRow(ctx, tx, 4); err != nil {
+					return err
+				}
+				// Siblings at the same depth, one failing.
+				tx.Transact(ctx, sql.LevelDefault, func(tx *DB) error {
+					insertRow(ctx, tx, 6)
+					return errInner
+				})
+				return tx.Transact(ctx, sql.LevelDefault, func(tx *DB) error {
+					return insertRow(ctx, tx, 7)
+				})
+			},
+			want: []int{3, 4, 5, 7},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			db := openTestDB(t)
+			err := db.Transact(ctx, sql.LevelDefault, func(tx *DB) error {
+				if err := insertRow(ctx, tx, 3); err != nil {
+					return err
+				}
+				// Only the inner changes are rolled back on error, and the
+				// outer transaction can go on.
+				tx.Transact(ctx, sql.LevelDefault, test.inner)
+				return insertRow(ctx, tx, 5)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := rowIDs(t, db); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got rows %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTransactNestedError(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	errInner := errors.New("inner")
+
+	err := db.Transact(ctx, sql.LevelDefault, func(tx *DB) error {
+		return tx.Transact(ctx, sql.LevelDefault, func(*DB) error { return errInner })
+	})
+	if !errors.Is(err, errInner) {
+		t.Errorf("got %v, want the inner error", err)
+	}
+
+	err = db.Transact(ctx, sql.LevelDefault, func(tx *DB) error {
+		return tx.Transact(ctx, sql.LevelSerializable, func(*DB) error { return nil })
+	})
+	if err == nil {
+		t.Error("raising the isolation level of a nested transaction: got nil error")
+	}
+}
+
+func TestTransactNestedPanic(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	func() {
+		defer func() {
+			if p := recover(); p != "inner" {
+				t.Errorf("recovered %v, want the inner panic", p)
+			}
+		}()
+		db.Transact(ctx, sql.LevelDefault, func(tx *DB) error {
+			if err := insertRow(ctx, tx, 3); err != nil {
+				return err
+			}
+			return tx.Transact(ctx, sql.LevelDefault, func(tx *DB) error {
+				insertRow(ctx, tx, 4)
+				panic("inner")
+			})
+		})
+	}()
+
+	// An unrecovered panic rolls back the whole transaction, and the DB is
+	// usable afterwards.
+	if got := rowIDs(t, db); len(got) != 0 {
+		t.Errorf("got rows %v, want none", got)
+	}
+}
+
+func TestForContext(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	other := openTestDB(t)
+
+	if got := db.ForContext(ctx); got != db {
+		t.Error("ForContext without a transaction did not return db")
+	}
+	err := db.Transact(ctx, sql.LevelDefault, func(tx *DB) error {
+		ctx := WithTx(ctx, tx)
+		if got := db.ForContext(ctx); got != tx {
+			t.Error("ForContext did not return the transaction")
+		}
+		if got := other.ForContext(ctx); got != other {
+			t.Error("ForContext returned a transaction of another database")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
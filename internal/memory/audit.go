@@ -0,0 +1,129 @@
+package memory
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/urvil38/todo-app/internal/task"
+	"go.opencensus.io/trace"
+)
+
+// auditCapacity is the number of audit events kept by a TaskManager. Once the
+// buffer is full, the oldest events are overwritten.
+const auditCapacity = 10000
+
+// auditRing is a fixed size ring buffer of audit events.
+type auditRing struct {
+	events  []task.AuditEvent
+	next    int // index the next event is written to
+	full    bool
+	counter int
+}
+
+func newAuditRing(capacity int) auditRing {
+	return auditRing{events: make([]task.AuditEvent, capacity)}
+}
+
+// event returns a new event with the next ID, to be added by the record of
+// the change it describes.
+func (r *auditRing) event(ctx context.Context, action task.Action, taskID string, before, after *task.Task) *task.AuditEvent {
+	e := task.NewAuditEvent(ctx, action, taskID, before, after)
+	e.Id = strconv.Itoa(r.counter + 1)
+	return &e
+}
+
+// put adds e to the buffer with its ID, unless an event with that ID or a
+// later one was added, so that replaying the log over a snapshot that
+// already holds some events is harmless.
+func (r *auditRing) put(e task.AuditEvent) {
+	n, err := strconv.Atoi(e.Id)
+	if err != nil || n <= r.counter {
+		return
+	}
+	r.counter = n
+	r.events[r.next] = e
+	r.next = (r.next + 1) % len(r.events)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// clone returns a copy of r.
+func (r *auditRing) clone() auditRing {
+	c := *r
+	c.events = append([]task.AuditEvent(nil), r.events...)
+	return c
+}
+
+// list returns the events matching f, oldest first.
+func (r *auditRing) list(f task.AuditFilter) []task.AuditEvent {
+	start, n := 0, r.next
+	if r.full {
+		start, n = r.next, len(r.events)
+	}
+	var events []task.AuditEvent
+	for k := 0; k < n; k++ {
+		e := r.events[(start+k)%len(r.events)]
+		if !f.Match(e) {
+			continue
+		}
+		events = append(events, e)
+		if f.Limit > 0 && len(events) == f.Limit {
+			break
+		}
+	}
+	return events
+}
+
+func snapshot(t task.Task) *task.Task {
+	return &t
+}
+
+func (i *TaskManager) TaskHistory(ctx context.Context, id string) ([]task.AuditEvent, error) {
+	m, err := i.forWork(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	if m != i {
+		return m.TaskHistory(ctx, id)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	ctx, span := trace.StartSpan(ctx, "memory.TaskHistory")
+	defer span.End()
+
+	return i.audit.list(task.AuditFilter{TaskId: i.canonicalID(id)}), nil
+}
+
+func (i *TaskManager) ListAuditEvents(ctx context.Context, f task.AuditFilter) ([]task.AuditEvent, error) {
+	m, err := i.forWork(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	if m != i {
+		return m.ListAuditEvents(ctx, f)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	ctx, span := trace.StartSpan(ctx, "memory.ListAuditEvents")
+	defer span.End()
+
+	if f.TaskId != "" {
+		f.TaskId = i.canonicalID(f.TaskId)
+	}
+	return i.audit.list(f), nil
+}
+
+// canonicalID resolves a legacy ID, which tasks restored from a backup may
+// have. Events are only ever recorded under the current ID.
+// i.mu must be held.
+func (i *TaskManager) canonicalID(id string) string {
+	if e, ok := i.aliases[id]; ok {
+		return e.Value.(*task.Task).Id
+	}
+	return id
+}
@@ -0,0 +1,106 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/urvil38/todo-app/internal/backup"
+	"github.com/urvil38/todo-app/internal/task"
+	"go.opencensus.io/trace"
+)
+
+// ExportBackup writes every task, including those in the trash, and the
+// audit events still held to w.
+func (i *TaskManager) ExportBackup(ctx context.Context, w *backup.Writer) error {
+	ctx, span := trace.StartSpan(ctx, "memory.ExportBackup")
+	defer span.End()
+
+	// Copy, so that writing to a slow w does not block other callers.
+	i.mu.Lock()
+	tasks := i.collect(func(*task.Task) bool { return true })
+	events := i.audit.list(task.AuditFilter{})
+	i.mu.Unlock()
+
+	for _, t := range tasks {
+		if err := w.WriteTask(t); err != nil {
+			return err
+		}
+	}
+	for _, e := range events {
+		if err := w.WriteAuditEvent(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ImportBackup reads and verifies the whole archive in r before changing
+// anything. Audit events are appended with new IDs, so importing an archive
+// twice records its events twice. Restored tasks get no new audit events.
+func (i *TaskManager) ImportBackup(ctx context.Context, r io.Reader, policy backup.ConflictPolicy) (backup.Result, error) {
+	ctx, span := trace.StartSpan(ctx, "memory.ImportBackup")
+	defer span.End()
+
+	var (
+		tasks  []task.Task
+		events []task.AuditEvent
+	)
+	_, err := backup.Read(r, backup.Handler{
+		Task: func(t task.Task) error {
+			if err := task.ValidateName(t.Name); err != nil {
+				return fmt.Errorf("%w: task %s: %v", backup.ErrCorrupt, t.Id, err)
+			}
+			tasks = append(tasks, t)
+			return nil
+		},
+		AuditEvent: func(e task.AuditEvent) error {
+			events = append(events, e)
+			return nil
+		},
+	})
+	if err != nil {
+		return backup.Result{}, err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if policy == backup.ConflictFail {
+		for _, t := range tasks {
+			if _, ok := i.mTask[t.Id]; ok {
+				return backup.Result{}, fmt.Errorf("%w: %s", backup.ErrConflict, t.Id)
+			}
+		}
+	}
+	var (
+		res   backup.Result
+		batch []record
+	)
+	for k := range tasks {
+		t := tasks[k]
+		_, exists := i.mTask[t.Id]
+		switch {
+		case exists && policy == backup.ConflictSkip:
+			res.Skipped++
+			continue
+		case exists:
+			res.Overwritten++
+		default:
+			res.Tasks++
+		}
+		batch = append(batch, record{Put: &t})
+	}
+	for k := range events {
+		batch = append(batch, record{Audit: &events[k]})
+	}
+	// A single batch, so that the archive is persisted whole or not at all.
+	if len(batch) > 0 {
+		counter := i.audit.counter
+		if err := i.commit(record{Batch: renumber(batch, &counter)}); err != nil {
+			return backup.Result{}, err
+		}
+	}
+	res.AuditEvents = len(events)
+	return res, nil
+}
@@ -0,0 +1,214 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/urvil38/todo-app/internal/backup"
+	"github.com/urvil38/todo-app/internal/task"
+)
+
+func exportBackup(t *testing.T, tm *TaskManager) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := backup.NewWriter(&buf, "memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tm.ExportBackup(context.Background(), w); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	src := openPersistent(t, Config{})
+	a, _ := src.CreateTask(ctx, "a")
+	b, _ := src.CreateTask(ctx, "b")
+	src.CreateTask(ctx, "c")
+	if err := src.DeleteTask(ctx, b.Id); err != nil {
+		t.Fatal(err)
+	}
+	archive := exportBackup(t, src)
+
+	dst := openPersistent(t, Config{Dir: t.TempDir()})
+	res, err := dst.ImportBackup(ctx, bytes.NewReader(archive), backup.ConflictFail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (backup.Result{Tasks: 3, AuditEvents: 4}); res != want {
+		t.Errorf("ImportBackup() = %+v, want %+v", res, want)
+	}
+	if got, want := taskNames(t, dst), []string{"a", "c"}; !equalNames(got, want) {
+		t.Errorf("tasks = %v, want %v", got, want)
+	}
+	if trash, _ := dst.ListTrash(ctx); len(trash) != 1 || trash[0].Id != b.Id {
+		t.Errorf("trash = %+v, want task %s", trash, b.Id)
+	}
+	if got, _ := dst.GetTask(ctx, a.Id); !got.CreatedAt.Equal(a.CreatedAt) {
+		t.Errorf("CreatedAt = %v, want %v", got.CreatedAt, a.CreatedAt)
+	}
+
+	// Conflicting tasks fail the whole import, or are skipped or replaced.
+	if _, err := dst.UpdateTask(ctx, a.Id, "changed"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dst.ImportBackup(ctx, bytes.NewReader(archive), backup.ConflictFail); !errors.Is(err, backup.ErrConflict) {
+		t.Errorf("ImportBackup(fail) = %v, want ErrConflict", err)
+	}
+	res, err = dst.ImportBackup(ctx, bytes.NewReader(archive), backup.ConflictSkip)
+	if err != nil || res.Skipped != 3 || res.Tasks != 0 {
+		t.Errorf("ImportBackup(skip) = %+v, %v", res, err)
+	}
+	if got, _ := dst.GetTask(ctx, a.Id); got.Name != "changed" {
+		t.Errorf("skip replaced the task: %+v", got)
+	}
+	res, err = dst.ImportBackup(ctx, bytes.NewReader(archive), backup.ConflictOverwrite)
+	if err != nil || res.Overwritten != 3 {
+		t.Errorf("ImportBackup(overwrite) = %+v, %v", res, err)
+	}
+	if got, _ := dst.GetTask(ctx, a.Id); got.Name != "a" {
+		t.Errorf("overwrite kept the task: %+v", got)
+	}
+}
+
+func TestBackupCorruptChangesNothing(t *testing.T) {
+	ctx := context.Background()
+	src := openPersistent(t, Config{})
+	src.CreateTask(ctx, "a")
+	archive := exportBackup(t, src)
+
+	dst := openPersistent(t, Config{})
+	if _, err := dst.ImportBackup(ctx, bytes.NewReader(archive[:len(archive)-10]), backup.ConflictFail); err == nil {
+		t.Fatal("ImportBackup(truncated) succeeded")
+	}
+	if names := taskNames(t, dst); len(names) != 0 {
+		t.Errorf("tasks = %v, want none", names)
+	}
+}
+
+func TestBackupImportIsAtomic(t *testing.T) {
+	ctx := context.Background()
+	src := openPersistent(t, Config{})
+	src.CreateTask(ctx, "a")
+	src.CreateTask(ctx, "b")
+	archive := exportBackup(t, src)
+
+	dst := openPersistent(t, Config{Dir: t.TempDir()})
+	defer dst.Close()
+	if _, err := dst.ImportBackup(ctx, bytes.NewReader(archive), backup.ConflictFail); err != nil {
+		t.Fatal(err)
+	}
+	if dst.journal.records != 1 {
+		t.Errorf("import appended %d records, want 1", dst.journal.records)
+	}
+
+	// A failed append changes nothing.
+	failing := openPersistent(t, Config{Dir: t.TempDir()})
+	failing.journal.f.Close()
+	if _, err := failing.ImportBackup(ctx, bytes.NewReader(archive), backup.ConflictFail); err == nil {
+		t.Fatal("ImportBackup with a closed write-ahead log succeeded")
+	}
+	if names := taskNames(t, failing); len(names) != 0 {
+		t.Errorf("tasks = %v, want none", names)
+	}
+}
+
+// TestBackupImportLarge imports an archive larger than a record of the
+// write-ahead log, which is split over several records.
+func TestBackupImportLarge(t *testing.T) {
+	ctx := context.Background()
+	const n = 8000
+	src := openPersistent(t, Config{})
+	for k := 0; k < n; k++ {
+		if _, err := src.CreateTask(ctx, fmt.Sprintf("task %d with a name long enough to fill the log", k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	archive := exportBackup(t, src)
+
+	dir := t.TempDir()
+	cfg := Config{Dir: dir}
+	dst := openPersistent(t, cfg)
+	if _, err := dst.ImportBackup(ctx, bytes.NewReader(archive), backup.ConflictFail); err != nil {
+		t.Fatal(err)
+	}
+	if dst.journal.records < 2 {
+		t.Fatalf("import appended %d records, want it split", dst.journal.records)
+	}
+	if _, err := dst.CreateTask(ctx, "after"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.Close(); err != nil {
+		t.Fatal(err)
+	}
+	logData, err := os.ReadFile(filepath.Join(dir, logFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst = openPersistent(t, cfg)
+	if got := len(taskNames(t, dst)); got != n+1 {
+		t.Errorf("after reopening, got %d tasks, want %d", got, n+1)
+	}
+	dst.Close()
+
+	// A crash after the first part leaves none of the import.
+	torn := t.TempDir()
+	if err := os.WriteFile(filepath.Join(torn, logFileName), logData[:maxRecordSize], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tm := openPersistent(t, Config{Dir: torn})
+	defer tm.Close()
+	if names := taskNames(t, tm); len(names) != 0 {
+		t.Errorf("after a torn import, got %d tasks, want none", len(names))
+	}
+}
+
+// TestBackupLegacyIDs imports a task that still has the counter ID it had
+// in a postgres database, which remains an alias of the task.
+func TestBackupLegacyIDs(t *testing.T) {
+	ctx := context.Background()
+	var buf bytes.Buffer
+	w, err := backup.NewWriter(&buf, "postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	legacy := task.Task{Id: "01HF7Y3ZQ8M4W6X2N9K5T0R1VB", LegacyId: "7", Name: "a", CreatedAt: now, UpdatedAt: now}
+	if err := w.WriteTask(legacy); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Config{Dir: t.TempDir()}
+	tm := openPersistent(t, cfg)
+	if _, err := tm.ImportBackup(ctx, &buf, backup.ConflictFail); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tm.UpdateTask(ctx, "7", "a2"); err != nil {
+		t.Fatalf("UpdateTask by legacy ID: %v", err)
+	}
+	tm.Close()
+
+	tm = openPersistent(t, cfg)
+	defer tm.Close()
+	if got, err := tm.GetTask(ctx, "7"); err != nil || got.Id != legacy.Id || got.Name != "a2" {
+		t.Errorf("GetTask by legacy ID after reopening = %+v, %v", got, err)
+	}
+	if h, _ := tm.TaskHistory(ctx, "7"); len(h) != 1 || h[0].TaskId != legacy.Id {
+		t.Errorf("TaskHistory by legacy ID = %+v, want the update", h)
+	}
+}
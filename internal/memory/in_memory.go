@@ -3,116 +3,322 @@ package memory
 import (
 	"container/list"
 	"context"
-	"strconv"
 	"sync"
 	"time"
 
+	"github.com/urvil38/todo-app/internal/log"
 	"github.com/urvil38/todo-app/internal/task"
 	"go.opencensus.io/trace"
 )
 
+// Config configures the persistence of a TaskManager. The zero Config keeps
+// tasks in memory only.
+type Config struct {
+	// Dir is the directory holding the snapshot and write-ahead log. If
+	// empty, tasks are not persisted.
+	Dir string
+	// Sync controls when the write-ahead log is flushed to disk.
+	// Default is SyncAlways.
+	Sync SyncPolicy
+	// SnapshotEvery is the number of logged mutations after which the log
+	// is compacted into a new snapshot. Zero disables compaction.
+	SnapshotEvery int
+	// IDs generates the IDs of new tasks. Default is ULIDs.
+	IDs task.IDGenerator
+}
+
 type TaskManager struct {
 	mu      sync.Mutex
 	tasks   list.List
 	mTask   map[string]*list.Element
-	counter int
+	aliases map[string]*list.Element // by legacy ID
+	ids     task.IDGenerator
+	audit   auditRing
+	journal *journal // nil if tasks are not persisted
+	work    *Work    // the unit of work that i is the copy of a manager for
+}
+
+// NewTaskManager returns a TaskManager. If cfg.Dir is set, the tasks stored
+// there are loaded and every later mutation is persisted.
+func NewTaskManager(cfg Config) (*TaskManager, error) {
+	i := &TaskManager{
+		mTask:   make(map[string]*list.Element),
+		aliases: make(map[string]*list.Element),
+		ids:     cfg.IDs,
+		audit:   newAuditRing(auditCapacity),
+	}
+	if i.ids == nil {
+		i.ids = task.NewIDGenerator(task.IDSchemeULID)
+	}
+	if cfg.Dir == "" {
+		return i, nil
+	}
+	j, err := openJournal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := j.load(i.restore, i.apply); err != nil {
+		return nil, err
+	}
+	i.journal = j
+	return i, nil
 }
 
-func NewTaskManager() *TaskManager {
-	return &TaskManager{
-		mTask: make(map[string]*list.Element),
-		tasks: *list.New(),
+// Close flushes and closes the write-ahead log, if any.
+func (i *TaskManager) Close() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.journal == nil {
+		return nil
 	}
+	return i.journal.close()
+}
+
+// restore replaces the state with a snapshot.
+func (i *TaskManager) restore(data snapshotData) {
+	i.tasks.Init()
+	i.mTask = make(map[string]*list.Element)
+	i.aliases = make(map[string]*list.Element)
+	i.audit = newAuditRing(auditCapacity)
+	for k := range data.Tasks {
+		t := data.Tasks[k]
+		i.apply(record{Put: &t})
+	}
+	for _, e := range data.Audit {
+		i.audit.put(e)
+	}
+}
+
+// apply applies a record to the state. i.mu must be held, except while
+// loading.
+func (i *TaskManager) apply(rec record) {
+	for _, r := range rec.Batch {
+		i.apply(r)
+	}
+	if e, ok := i.mTask[rec.Remove]; ok {
+		if t := e.Value.(*task.Task); t.LegacyId != "" {
+			delete(i.aliases, t.LegacyId)
+		}
+		i.tasks.Remove(e)
+		delete(i.mTask, rec.Remove)
+	}
+	if rec.Put != nil {
+		t := *rec.Put
+		e, ok := i.mTask[t.Id]
+		if ok {
+			e.Value = &t
+		} else {
+			e = i.tasks.PushFront(&t)
+			i.mTask[t.Id] = e
+		}
+		if t.LegacyId != "" {
+			i.aliases[t.LegacyId] = e
+		}
+	}
+	if rec.Audit != nil {
+		i.audit.put(*rec.Audit)
+	}
+}
+
+// commit logs rec, if tasks are persisted, and applies it. Nothing is
+// changed if logging fails. i.mu must be held.
+func (i *TaskManager) commit(rec record) error {
+	if i.work != nil {
+		i.work.record(rec)
+	}
+	if i.journal != nil {
+		if err := i.journal.append(rec); err != nil {
+			return err
+		}
+	}
+	i.apply(rec)
+	if i.journal != nil && i.journal.needsSnapshot() {
+		data := snapshotData{
+			Tasks: i.collect(func(*task.Task) bool { return true }),
+			Audit: i.audit.list(task.AuditFilter{}),
+		}
+		if err := i.journal.snapshot(data); err != nil {
+			// The log still holds every change, so only compaction failed.
+			log.Logger.Error("memory: unable to write snapshot: ", err)
+		}
+	}
+	return nil
 }
 
 func (i *TaskManager) CreateTask(ctx context.Context, name string) (t task.Task, err error) {
+	m, err := i.forWork(ctx, true)
+	if err != nil {
+		return task.Task{}, err
+	}
+	if m != i {
+		return m.CreateTask(ctx, name)
+	}
+
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
 	ctx, span := trace.StartSpan(ctx, "memory.CreateTask")
 	defer span.End()
 
-	i.counter++
+	if err := task.ValidateName(name); err != nil {
+		return task.Task{}, err
+	}
+
+	now := time.Now()
 	t = task.Task{
-		Id:        strconv.Itoa(i.counter),
+		Id:        i.ids.NewID(now),
 		Name:      name,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	event := i.audit.event(ctx, task.ActionCreate, t.Id, nil, snapshot(t))
+	if err := i.commit(record{Put: &t, Audit: event}); err != nil {
+		return task.Task{}, err
 	}
-	ee := i.tasks.PushFront(&t)
-	i.mTask[t.Id] = ee
 	task.RecordTaskCreate(context.Background())
 	return t, nil
 }
 
 func (i *TaskManager) DeleteTask(ctx context.Context, id string) (err error) {
+	m, err := i.forWork(ctx, true)
+	if err != nil {
+		return err
+	}
+	if m != i {
+		return m.DeleteTask(ctx, id)
+	}
+
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
 	ctx, span := trace.StartSpan(ctx, "memory.DeleteTask")
 	defer span.End()
 
-	t, ok := i.mTask[id]
+	t, ok := i.lookup(id)
 	if !ok {
 		return task.ErrTaskNotFound
 	}
 
-	i.tasks.Remove(t)
-	delete(i.mTask, id)
+	before, after := *t, *t
+	now := time.Now()
+	after.DeletedAt, after.UpdatedAt = &now, now
+	event := i.audit.event(ctx, task.ActionDelete, after.Id, &before, &after)
+	if err := i.commit(record{Put: &after, Audit: event}); err != nil {
+		return err
+	}
 	task.RecordTaskDelete(context.Background())
 	return nil
 
 }
 
 func (i *TaskManager) GetTask(ctx context.Context, id string) (_ task.Task, err error) {
+	m, err := i.forWork(ctx, false)
+	if err != nil {
+		return task.Task{}, err
+	}
+	if m != i {
+		return m.GetTask(ctx, id)
+	}
+
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
 	ctx, span := trace.StartSpan(ctx, "memory.GetTask")
 	defer span.End()
 
-	t, ok := i.mTask[id]
+	t, ok := i.lookup(id)
 	if !ok {
 		return task.Task{}, task.ErrTaskNotFound
 	}
-	return *t.Value.(*task.Task), nil
+	return *t, nil
 }
 
 func (i *TaskManager) UpdateTask(ctx context.Context, id, name string) (_ task.Task, err error) {
+	m, err := i.forWork(ctx, true)
+	if err != nil {
+		return task.Task{}, err
+	}
+	if m != i {
+		return m.UpdateTask(ctx, id, name)
+	}
+
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
 	ctx, span := trace.StartSpan(ctx, "memory.UpdateTask")
 	defer span.End()
 
-	lElement, ok := i.mTask[id]
+	if err := task.ValidateName(name); err != nil {
+		return task.Task{}, err
+	}
+
+	t, ok := i.lookup(id)
 	if !ok {
 		return task.Task{}, task.ErrTaskNotFound
 	}
 
-	t := lElement.Value.(*task.Task)
-	t.Name = name
-	t.UpdatedAt = time.Now()
+	before, after := *t, *t
+	after.Name = name
+	after.UpdatedAt = time.Now()
+	event := i.audit.event(ctx, task.ActionUpdate, after.Id, &before, snapshot(after))
+	if err := i.commit(record{Put: &after, Audit: event}); err != nil {
+		return task.Task{}, err
+	}
 	task.RecordTaskUpdate(context.Background())
-	return *t, nil
+	return after, nil
 
 }
 
 func (i *TaskManager) ListTasks(ctx context.Context) ([]task.Task, error) {
+	m, err := i.forWork(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	if m != i {
+		return m.ListTasks(ctx)
+	}
+
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
 	ctx, span := trace.StartSpan(ctx, "memory.ListTasks")
 	defer span.End()
 
-	tasks := make([]task.Task, i.tasks.Len())
-	k := i.tasks.Len() - 1
-	for t := i.tasks.Front(); t != nil; t = t.Next() {
-		if t.Value != nil {
-			tasks[k] = *t.Value.(*task.Task)
-			k--
-		}
+	return i.collect(func(t *task.Task) bool { return t.DeletedAt == nil }), nil
+}
+
+// find returns the element of the task with the given ID or legacy ID,
+// whether or not it is in the trash.
+func (i *TaskManager) find(id string) (*list.Element, bool) {
+	if e, ok := i.mTask[id]; ok {
+		return e, true
 	}
+	e, ok := i.aliases[id]
+	return e, ok
+}
+
+// lookup returns the task with the given id unless it is in the trash.
+func (i *TaskManager) lookup(id string) (*task.Task, bool) {
+	e, ok := i.find(id)
+	if !ok {
+		return nil, false
+	}
+	t := e.Value.(*task.Task)
+	if t.DeletedAt != nil {
+		return nil, false
+	}
+	return t, true
+}
 
-	return tasks, nil
+// collect returns copies of the tasks for which keep returns true, in
+// insertion order.
+func (i *TaskManager) collect(keep func(*task.Task) bool) []task.Task {
+	tasks := make([]task.Task, 0, i.tasks.Len())
+	for e := i.tasks.Back(); e != nil; e = e.Prev() {
+		if t, ok := e.Value.(*task.Task); ok && keep(t) {
+			tasks = append(tasks, *t)
+		}
+	}
+	return tasks
 }
@@ -0,0 +1,22 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/urvil38/todo-app/internal/task"
+	"github.com/urvil38/todo-app/internal/task/tasktest"
+)
+
+func TestTaskManager(t *testing.T) {
+	tasktest.RunManagerTests(t, func(t *testing.T) task.Manager {
+		return openPersistent(t, Config{})
+	})
+}
+
+func TestPersistentTaskManager(t *testing.T) {
+	tasktest.RunManagerTests(t, func(t *testing.T) task.Manager {
+		tm := openPersistent(t, Config{Dir: t.TempDir(), SnapshotEvery: 5})
+		t.Cleanup(func() { tm.Close() })
+		return tm
+	})
+}
@@ -0,0 +1,393 @@
+package memory
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/urvil38/todo-app/internal/log"
+	"github.com/urvil38/todo-app/internal/task"
+)
+
+// SyncPolicy controls when the write-ahead log is flushed to stable storage.
+type SyncPolicy string
+
+const (
+	// SyncAlways fsyncs the log after every mutation.
+	SyncAlways SyncPolicy = "always"
+	// SyncInterval fsyncs the log once per second. Up to a second of
+	// mutations may be lost if the machine crashes.
+	SyncInterval SyncPolicy = "interval"
+	// SyncNever leaves flushing to the operating system.
+	SyncNever SyncPolicy = "never"
+)
+
+// ParseSyncPolicy validates s as a SyncPolicy.
+func ParseSyncPolicy(s string) (SyncPolicy, error) {
+	switch p := SyncPolicy(s); p {
+	case SyncAlways, SyncInterval, SyncNever:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unsupported sync policy: %q", s)
+	}
+}
+
+const (
+	logFileName      = "wal.log"
+	snapshotFileName = "snapshot.json"
+
+	// recordHeaderSize is the size of the length and checksum that precede
+	// every record in the log.
+	recordHeaderSize = 8
+
+	// maxRecordSize guards against allocating huge buffers when reading a
+	// corrupted length. Larger batches are split over several records.
+	maxRecordSize = 1 << 20
+
+	// batchOverhead bounds the size of a record holding a part of a batch,
+	// besides the records in the part and the commas between them.
+	batchOverhead = 64
+)
+
+// record is a single log entry. Records carry the full state of a task so
+// that replaying them is idempotent: a log that was already folded into a
+// snapshot can safely be replayed on top of it.
+type record struct {
+	// Put is the new state of a task, if any.
+	Put *task.Task `json:"put,omitempty"`
+	// Remove is the ID of a permanently removed task. It is applied before
+	// Put, so a record with both renames a task.
+	Remove string `json:"remove,omitempty"`
+	// Audit is the audit event of the change, if any, applied after Put.
+	// It keeps its ID, so that it is only added once.
+	Audit *task.AuditEvent `json:"audit,omitempty"`
+	// Batch holds the records of a committed unit of work, which are
+	// applied in order, so that they are logged all or none.
+	Batch []record `json:"batch,omitempty"`
+	// More means that Batch continues in the next record. A batch larger
+	// than maxRecordSize is split over several records, which are applied
+	// together once the last one is read.
+	More bool `json:"more,omitempty"`
+}
+
+// snapshotData is the content of the snapshot file. Tasks are in insertion
+// order, and audit events oldest first.
+type snapshotData struct {
+	Tasks []task.Task       `json:"tasks"`
+	Audit []task.AuditEvent `json:"audit,omitempty"`
+}
+
+// journal persists the state of a TaskManager in a directory holding a
+// snapshot and a write-ahead log of the changes made since.
+type journal struct {
+	dir           string
+	sync          SyncPolicy
+	snapshotEvery int
+
+	mu      sync.Mutex // guards f against the interval syncer
+	f       *os.File
+	records int // records appended since the last snapshot
+	done    chan struct{}
+}
+
+func openJournal(cfg Config) (*journal, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	j := &journal{
+		dir:           cfg.Dir,
+		sync:          cfg.Sync,
+		snapshotEvery: cfg.SnapshotEvery,
+		done:          make(chan struct{}),
+	}
+	if j.sync == "" {
+		j.sync = SyncAlways
+	}
+	return j, nil
+}
+
+// load reads the snapshot and replays the log, calling apply for each. A
+// torn or corrupt record at the end of the log is discarded and the log is
+// truncated before it. After load returns, the log is open for appending.
+func (j *journal) load(restore func(snapshotData), apply func(record)) error {
+	snap, err := os.ReadFile(filepath.Join(j.dir, snapshotFileName))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		var data snapshotData
+		if err := json.Unmarshal(snap, &data); err != nil {
+			return fmt.Errorf("unable to decode snapshot: %w", err)
+		}
+		restore(data)
+	}
+
+	f, err := os.OpenFile(filepath.Join(j.dir, logFileName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	good, n, err := replayLog(f, apply)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if fi, err := f.Stat(); err == nil && fi.Size() > good {
+		log.Logger.Warnf("memory: discarding %d bytes of incomplete write-ahead log", fi.Size()-good)
+		if err := f.Truncate(good); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if _, err := f.Seek(good, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+	j.f = f
+	j.records = n
+	if j.sync == SyncInterval {
+		go j.syncLoop()
+	}
+	return nil
+}
+
+// replayLog applies every intact record in r and returns the offset just
+// after the last one and the number of records read. The parts of a batch
+// are only applied once its last part is read.
+func replayLog(r io.Reader, apply func(record)) (good int64, n int, err error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, recordHeaderSize)
+	var (
+		off     int64
+		read    int
+		pending []record // the batch whose parts were read so far
+	)
+	for {
+		if _, err := io.ReadFull(br, header); err != nil {
+			// io.EOF is a clean end; io.ErrUnexpectedEOF is a torn header.
+			return good, n, nil
+		}
+		size := binary.BigEndian.Uint32(header[:4])
+		sum := binary.BigEndian.Uint32(header[4:])
+		if size > maxRecordSize {
+			return good, n, nil
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return good, n, nil
+		}
+		if crc32.ChecksumIEEE(payload) != sum {
+			return good, n, nil
+		}
+		var rec record
+		if err := json.Unmarshal(payload, &rec); err != nil {
+			return good, n, nil
+		}
+		off += int64(recordHeaderSize) + int64(size)
+		read++
+		if rec.More {
+			pending = append(pending, rec.Batch...)
+			continue
+		}
+		if pending != nil {
+			rec.Batch, pending = append(pending, rec.Batch...), nil
+		}
+		apply(rec)
+		good, n = off, read
+	}
+}
+
+// append writes rec to the log, syncing it if the policy requires.
+func (j *journal) append(rec record) error {
+	payloads, err := encodeRecord(rec)
+	if err != nil {
+		return err
+	}
+	var buf []byte
+	for _, payload := range payloads {
+		var header [recordHeaderSize]byte
+		binary.BigEndian.PutUint32(header[:4], uint32(len(payload)))
+		binary.BigEndian.PutUint32(header[4:], crc32.ChecksumIEEE(payload))
+		buf = append(append(buf, header[:]...), payload...)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.f.Write(buf); err != nil {
+		return fmt.Errorf("unable to append to write-ahead log: %w", err)
+	}
+	if j.sync == SyncAlways {
+		if err := j.f.Sync(); err != nil {
+			return fmt.Errorf("unable to sync write-ahead log: %w", err)
+		}
+	}
+	j.records += len(payloads)
+	return nil
+}
+
+// encodeRecord returns the payloads of the records rec is logged as: rec
+// itself, unless it is larger than maxRecordSize, in which case the records
+// it applies are split into batches that fit, all but the last marked More.
+func encodeRecord(rec record) ([][]byte, error) {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) <= maxRecordSize {
+		return [][]byte{payload}, nil
+	}
+
+	var (
+		payloads [][]byte
+		part     []record
+		size     int
+	)
+	flush := func(more bool) error {
+		payload, err := json.Marshal(record{Batch: part, More: more})
+		if err != nil {
+			return err
+		}
+		payloads = append(payloads, payload)
+		part, size = nil, 0
+		return nil
+	}
+	for _, r := range flatten(rec, nil) {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(b)+batchOverhead > maxRecordSize {
+			return nil, fmt.Errorf("write-ahead log record of %d bytes exceeds the limit of %d", len(b), maxRecordSize)
+		}
+		if size+len(b)+1+batchOverhead > maxRecordSize {
+			if err := flush(true); err != nil {
+				return nil, err
+			}
+		}
+		part = append(part, r)
+		size += len(b) + 1
+	}
+	if err := flush(false); err != nil {
+		return nil, err
+	}
+	return payloads, nil
+}
+
+// flatten appends to out the records without a batch that applying rec
+// applies, in order.
+func flatten(rec record, out []record) []record {
+	for _, r := range rec.Batch {
+		out = flatten(r, out)
+	}
+	rec.Batch, rec.More = nil, false
+	if rec.Put != nil || rec.Remove != "" || rec.Audit != nil {
+		out = append(out, rec)
+	}
+	return out
+}
+
+// needsSnapshot reports whether enough records were appended to compact the
+// log into a new snapshot.
+func (j *journal) needsSnapshot() bool {
+	return j.snapshotEvery > 0 && j.records >= j.snapshotEvery
+}
+
+// snapshot atomically replaces the snapshot with data and empties the log.
+// If the process crashes in between, the old log is replayed on top of the
+// new snapshot, which is harmless because records are idempotent.
+func (j *journal) snapshot(data snapshotData) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(j.dir, snapshotFileName+".tmp")
+	if err := writeFileSync(tmp, b); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(j.dir, snapshotFileName)); err != nil {
+		return err
+	}
+	if err := syncDir(j.dir); err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := j.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := j.f.Sync(); err != nil {
+		return err
+	}
+	j.records = 0
+	return nil
+}
+
+func (j *journal) syncLoop() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-j.done:
+			return
+		case <-ticker.C:
+			j.mu.Lock()
+			if err := j.f.Sync(); err != nil {
+				log.Logger.Error("memory: unable to sync write-ahead log: ", err)
+			}
+			j.mu.Unlock()
+		}
+	}
+}
+
+func (j *journal) close() error {
+	close(j.done)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.f.Sync(); err != nil {
+		j.f.Close()
+		return err
+	}
+	return j.f.Close()
+}
+
+func writeFileSync(name string, b []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir makes a rename in dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
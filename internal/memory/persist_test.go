@@ -0,0 +1,250 @@
+package memory
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/urvil38/todo-app/internal/task"
+)
+
+func openPersistent(t *testing.T, cfg Config) *TaskManager {
+	t.Helper()
+	tm, err := NewTaskManager(cfg)
+	if err != nil {
+		t.Fatalf("NewTaskManager(%+v): %v", cfg, err)
+	}
+	return tm
+}
+
+func taskNames(t *testing.T, tm *TaskManager) []string {
+	t.Helper()
+	tasks, err := tm.ListTasks(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tk := range tasks {
+		names = append(names, tk.Name)
+	}
+	return names
+}
+
+func equalNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if a[k] != b[k] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPersistReplay(t *testing.T) {
+	ctx := context.Background()
+	for _, snapshotEvery := range []int{0, 1, 3} {
+		cfg := Config{Dir: t.TempDir(), Sync: SyncAlways, SnapshotEvery: snapshotEvery}
+		tm := openPersistent(t, cfg)
+
+		a, _ := tm.CreateTask(ctx, "a")
+		b, _ := tm.CreateTask(ctx, "b")
+		c, _ := tm.CreateTask(ctx, "c")
+		if _, err := tm.UpdateTask(ctx, a.Id, "a2"); err != nil {
+			t.Fatal(err)
+		}
+		if err := tm.DeleteTask(ctx, b.Id); err != nil {
+			t.Fatal(err)
+		}
+		if err := tm.PurgeTask(ctx, c.Id); err != nil {
+			t.Fatal(err)
+		}
+		if err := tm.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		tm = openPersistent(t, cfg)
+		if got, want := taskNames(t, tm), []string{"a2"}; !equalNames(got, want) {
+			t.Errorf("snapshotEvery=%d: tasks = %v, want %v", snapshotEvery, got, want)
+		}
+		trash, _ := tm.ListTrash(ctx)
+		if len(trash) != 1 || trash[0].Id != b.Id {
+			t.Errorf("snapshotEvery=%d: trash = %v, want task %s", snapshotEvery, trash, b.Id)
+		}
+		// IDs must not be reused after a restart.
+		d, _ := tm.CreateTask(ctx, "d")
+		if d.Id == a.Id || d.Id == b.Id || d.Id == c.Id {
+			t.Errorf("snapshotEvery=%d: reused id %s", snapshotEvery, d.Id)
+		}
+		tm.Close()
+	}
+}
+
+// TestPersistTruncatedLog simulates a crash in the middle of appending a
+// record by cutting the log at every offset inside the last record.
+func TestPersistTruncatedLog(t *testing.T) {
+	ctx := context.Background()
+	src := t.TempDir()
+	tm := openPersistent(t, Config{Dir: src})
+	tm.CreateTask(ctx, "a")
+	tm.CreateTask(ctx, "b")
+	fi, err := os.Stat(filepath.Join(src, logFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	intact := fi.Size()
+	tm.CreateTask(ctx, "c")
+	tm.Close()
+
+	full, err := os.ReadFile(filepath.Join(src, logFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for size := intact; size < int64(len(full)); size++ {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, logFileName), full[:size], 0o644); err != nil {
+			t.Fatal(err)
+		}
+		cfg := Config{Dir: dir}
+		tm := openPersistent(t, cfg)
+		if got, want := taskNames(t, tm), []string{"a", "b"}; !equalNames(got, want) {
+			t.Fatalf("log cut at %d: tasks = %v, want %v", size, got, want)
+		}
+		// New records must be readable after the torn one was discarded.
+		tm.CreateTask(ctx, "d")
+		tm.Close()
+		tm = openPersistent(t, cfg)
+		if got, want := taskNames(t, tm), []string{"a", "b", "d"}; !equalNames(got, want) {
+			t.Fatalf("log cut at %d, after append: tasks = %v, want %v", size, got, want)
+		}
+		tm.Close()
+	}
+}
+
+func TestPersistCorruptRecord(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := Config{Dir: dir}
+	tm := openPersistent(t, cfg)
+	tm.CreateTask(ctx, "a")
+	tm.CreateTask(ctx, "b")
+	tm.Close()
+
+	name := filepath.Join(dir, logFileName)
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[len(b)-2] ^= 0xff // flip a byte inside the last record
+	if err := os.WriteFile(name, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tm = openPersistent(t, cfg)
+	defer tm.Close()
+	if got, want := taskNames(t, tm), []string{"a"}; !equalNames(got, want) {
+		t.Errorf("tasks = %v, want %v", got, want)
+	}
+}
+
+// TestPersistStaleLog checks that a log left behind by a crash between
+// writing a snapshot and truncating the log is replayed harmlessly.
+func TestPersistStaleLog(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := Config{Dir: dir}
+	tm := openPersistent(t, cfg)
+	a, _ := tm.CreateTask(ctx, "a")
+	tm.CreateTask(ctx, "b")
+	tm.UpdateTask(ctx, a.Id, "a2")
+	tm.PurgeTask(ctx, a.Id)
+	staleLog, err := os.ReadFile(filepath.Join(dir, logFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm.mu.Lock()
+	err = tm.journal.snapshot(snapshotData{Tasks: tm.collect(func(*task.Task) bool { return true })})
+	tm.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm.Close()
+	if err := os.WriteFile(filepath.Join(dir, logFileName), staleLog, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tm = openPersistent(t, cfg)
+	defer tm.Close()
+	if got, want := taskNames(t, tm), []string{"b"}; !equalNames(got, want) {
+		t.Errorf("tasks = %v, want %v", got, want)
+	}
+}
+
+func TestPersistSyncInterval(t *testing.T) {
+	ctx := context.Background()
+	cfg := Config{Dir: t.TempDir(), Sync: SyncInterval}
+	tm := openPersistent(t, cfg)
+	tm.CreateTask(ctx, "a")
+	if err := tm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tm = openPersistent(t, cfg)
+	defer tm.Close()
+	if got, want := taskNames(t, tm), []string{"a"}; !equalNames(got, want) {
+		t.Errorf("tasks = %v, want %v", got, want)
+	}
+}
+
+func TestPersistAudit(t *testing.T) {
+	ctx := context.Background()
+	for _, snapshotEvery := range []int{0, 1, 3} {
+		cfg := Config{Dir: t.TempDir(), SnapshotEvery: snapshotEvery}
+		tm := openPersistent(t, cfg)
+
+		a, _ := tm.CreateTask(ctx, "a")
+		if _, err := tm.UpdateTask(ctx, a.Id, "a2"); err != nil {
+			t.Fatal(err)
+		}
+		if err := tm.DeleteTask(ctx, a.Id); err != nil {
+			t.Fatal(err)
+		}
+		err := tm.Transact(ctx, func(ctx context.Context) error {
+			_, err := tm.CreateTask(ctx, "b")
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := tm.ListAuditEvents(ctx, task.AuditFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tm.Close()
+
+		tm = openPersistent(t, cfg)
+		got, err := tm.ListAuditEvents(ctx, task.AuditFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 4 || len(want) != 4 {
+			t.Fatalf("snapshotEvery=%d: got %d events after reopening, want 4 of 4", snapshotEvery, len(got))
+		}
+		for k := range got {
+			if got[k].Id != want[k].Id || got[k].Action != want[k].Action || got[k].TaskId != want[k].TaskId {
+				t.Errorf("snapshotEvery=%d: event %d = %+v, want %+v", snapshotEvery, k, got[k], want[k])
+			}
+		}
+
+		// New events carry on from the last persisted ID.
+		if _, err := tm.CreateTask(ctx, "c"); err != nil {
+			t.Fatal(err)
+		}
+		events, _ := tm.ListAuditEvents(ctx, task.AuditFilter{})
+		if len(events) != 5 || events[4].Id != "5" {
+			t.Errorf("snapshotEvery=%d: events after reopening = %+v, want a fifth with ID 5", snapshotEvery, events)
+		}
+		tm.Close()
+	}
+}
@@ -0,0 +1,121 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/urvil38/todo-app/internal/task"
+	"go.opencensus.io/trace"
+)
+
+// ListTrash returns the tasks in the trash in the order they were deleted.
+func (i *TaskManager) ListTrash(ctx context.Context) ([]task.Task, error) {
+	m, err := i.forWork(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	if m != i {
+		return m.ListTrash(ctx)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	ctx, span := trace.StartSpan(ctx, "memory.ListTrash")
+	defer span.End()
+
+	tasks := i.collect(func(t *task.Task) bool { return t.DeletedAt != nil })
+	sort.SliceStable(tasks, func(a, b int) bool {
+		return tasks[a].DeletedAt.Before(*tasks[b].DeletedAt)
+	})
+	return tasks, nil
+}
+
+func (i *TaskManager) RestoreTask(ctx context.Context, id string) (_ task.Task, err error) {
+	m, err := i.forWork(ctx, true)
+	if err != nil {
+		return task.Task{}, err
+	}
+	if m != i {
+		return m.RestoreTask(ctx, id)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	ctx, span := trace.StartSpan(ctx, "memory.RestoreTask")
+	defer span.End()
+
+	e, ok := i.find(id)
+	if !ok || e.Value.(*task.Task).DeletedAt == nil {
+		return task.Task{}, task.ErrTaskNotFound
+	}
+
+	before, after := *e.Value.(*task.Task), *e.Value.(*task.Task)
+	after.DeletedAt = nil
+	after.UpdatedAt = time.Now()
+	event := i.audit.event(ctx, task.ActionRestore, after.Id, &before, snapshot(after))
+	if err := i.commit(record{Put: &after, Audit: event}); err != nil {
+		return task.Task{}, err
+	}
+	return after, nil
+}
+
+func (i *TaskManager) PurgeTask(ctx context.Context, id string) (err error) {
+	m, err := i.forWork(ctx, true)
+	if err != nil {
+		return err
+	}
+	if m != i {
+		return m.PurgeTask(ctx, id)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	ctx, span := trace.StartSpan(ctx, "memory.PurgeTask")
+	defer span.End()
+
+	e, ok := i.find(id)
+	if !ok {
+		return task.ErrTaskNotFound
+	}
+	return i.purge(ctx, e.Value.(*task.Task).Id)
+}
+
+func (i *TaskManager) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	m, err := i.forWork(ctx, true)
+	if err != nil {
+		return 0, err
+	}
+	if m != i {
+		return m.PurgeTrash(ctx, before)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	ctx, span := trace.StartSpan(ctx, "memory.PurgeTrash")
+	defer span.End()
+
+	purged := i.collect(func(t *task.Task) bool {
+		return t.DeletedAt != nil && t.DeletedAt.Before(before)
+	})
+	sort.SliceStable(purged, func(a, b int) bool {
+		return purged[a].DeletedAt.Before(*purged[b].DeletedAt)
+	})
+	for n, t := range purged {
+		if err := i.purge(ctx, t.Id); err != nil {
+			return n, err
+		}
+	}
+	return len(purged), nil
+}
+
+// purge permanently removes the task with the given id. i.mu must be held.
+func (i *TaskManager) purge(ctx context.Context, id string) error {
+	before := *i.mTask[id].Value.(*task.Task)
+	event := i.audit.event(ctx, task.ActionPurge, id, &before, nil)
+	return i.commit(record{Remove: id, Audit: event})
+}
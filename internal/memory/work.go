@@ -0,0 +1,237 @@
+package memory
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/urvil38/todo-app/internal/task"
+	"go.opencensus.io/trace"
+)
+
+var (
+	// ErrWorkConflict is returned when committing a unit of work that
+	// changed a task that was also changed since the work first wrote.
+	ErrWorkConflict = errors.New("memory: unit of work conflicts with a concurrent change")
+	// ErrWorkDone is returned for calls made with a unit of work that was
+	// already committed or rolled back.
+	ErrWorkDone = errors.New("memory: unit of work already committed or rolled back")
+)
+
+type workKey struct{}
+
+// Work is a unit of work of a TaskManager, started by Begin. Until the first
+// write made with it, calls read the TaskManager. The first write copies the
+// state of the TaskManager, and later calls use the copy, so that changes
+// are only seen by the work until it is committed.
+//
+// Tasks are never changed in place, so the copy shares them with the
+// TaskManager and costs a pointer per task, besides a copy of the audit
+// events held.
+type Work struct {
+	root   *TaskManager // the manager whose methods the work is used with
+	parent *Work        // the enclosing work, if any
+
+	mu      sync.Mutex
+	done    bool
+	clone   *TaskManager          // the copy, once the work wrote
+	base    map[string]*task.Task // the tasks changed, as they were copied
+	records []record              // the changes made to clone
+}
+
+// Begin starts a unit of work, returning a copy of ctx that carries it. The
+// calls to i made with that context are part of the work, which must be
+// ended with Commit or Rollback. If ctx already carries a unit of work of i,
+// the new one is committed into it.
+func (i *TaskManager) Begin(ctx context.Context) (context.Context, *Work) {
+	w := &Work{root: i}
+	if parent, ok := ctx.Value(workKey{}).(*Work); ok && parent.root == i {
+		w.parent = parent
+	}
+	return context.WithValue(ctx, workKey{}, w), w
+}
+
+// Transact calls f with a unit of work, committing it if f returns nil and
+// rolling it back otherwise.
+func (i *TaskManager) Transact(ctx context.Context, f func(ctx context.Context) error) (err error) {
+	ctx, span := trace.StartSpan(ctx, "memory.Transact")
+	defer span.End()
+
+	ctx, w := i.Begin(ctx)
+	defer func() {
+		if p := recover(); p != nil {
+			w.Rollback()
+			panic(p)
+		}
+	}()
+	if err := f(ctx); err != nil {
+		w.Rollback()
+		return err
+	}
+	return w.Commit()
+}
+
+// forWork returns the manager that calls to i made with ctx must use: i
+// itself, unless ctx carries a unit of work of i.
+func (i *TaskManager) forWork(ctx context.Context, write bool) (*TaskManager, error) {
+	w, ok := ctx.Value(workKey{}).(*Work)
+	if !ok || w.root != i {
+		return i, nil
+	}
+	return w.manager(write)
+}
+
+// manager returns the manager that the calls made with w use, copying the
+// state if write is true and w has not written yet.
+func (w *Work) manager(write bool) (*TaskManager, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.done {
+		return nil, ErrWorkDone
+	}
+	if w.clone != nil {
+		return w.clone, nil
+	}
+	m, err := w.target(write)
+	if err != nil || !write {
+		return m, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w.clone = m.cloneFor(w)
+	w.base = make(map[string]*task.Task)
+	return w.clone, nil
+}
+
+// target returns the manager that w is committed into.
+func (w *Work) target(write bool) (*TaskManager, error) {
+	if w.parent == nil {
+		return w.root, nil
+	}
+	return w.parent.manager(write)
+}
+
+// cloneFor returns a copy of the state of i, without persistence, whose
+// changes are recorded in w. i.mu must be held.
+func (i *TaskManager) cloneFor(w *Work) *TaskManager {
+	c := &TaskManager{
+		mTask:   make(map[string]*list.Element, len(i.mTask)),
+		aliases: make(map[string]*list.Element, len(i.aliases)),
+		ids:     i.ids,
+		audit:   i.audit.clone(),
+		work:    w,
+	}
+	for e := i.tasks.Back(); e != nil; e = e.Prev() {
+		t := e.Value.(*task.Task)
+		ce := c.tasks.PushFront(t)
+		c.mTask[t.Id] = ce
+		if t.LegacyId != "" {
+			c.aliases[t.LegacyId] = ce
+		}
+	}
+	return c
+}
+
+// record notes rec before it is applied to w.clone. w.clone.mu must be held.
+func (w *Work) record(rec record) {
+	w.noteBase(rec)
+	w.records = append(w.records, rec)
+}
+
+// noteBase saves the tasks that rec changes as they are in w.clone, unless
+// they were changed before.
+func (w *Work) noteBase(rec record) {
+	for _, r := range rec.Batch {
+		w.noteBase(r)
+	}
+	ids := []string{rec.Remove}
+	if rec.Put != nil {
+		ids = append(ids, rec.Put.Id)
+	}
+	for _, id := range ids {
+		if _, ok := w.base[id]; ok || id == "" {
+			continue
+		}
+		var t *task.Task
+		if e, ok := w.clone.mTask[id]; ok {
+			t = e.Value.(*task.Task)
+		}
+		w.base[id] = t
+	}
+}
+
+// Commit applies the changes made with w, as a single batch if they are
+// persisted, which is split over several records if it is too large for
+// one. It fails with ErrWorkConflict, changing nothing, if a task the
+// work changed was changed by someone else after the work first wrote.
+func (w *Work) Commit() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.done {
+		return ErrWorkDone
+	}
+	w.done = true
+	if w.clone == nil {
+		return nil
+	}
+	m, err := w.target(true)
+	if err != nil {
+		return err
+	}
+	w.clone.mu.Lock()
+	defer w.clone.mu.Unlock()
+	if len(w.records) == 0 {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, t := range w.base {
+		var cur *task.Task
+		if e, ok := m.mTask[id]; ok {
+			cur = e.Value.(*task.Task)
+		}
+		if cur != t {
+			return fmt.Errorf("%w: task %s", ErrWorkConflict, id)
+		}
+	}
+	counter := m.audit.counter
+	return m.commit(record{Batch: renumber(w.records, &counter)})
+}
+
+// renumber returns copies of recs whose audit events have the IDs following
+// *counter, in the order they are applied, and advances *counter past them.
+// Events made by a unit of work are numbered after the events of the
+// manager it was copied from, which may have recorded others since.
+func renumber(recs []record, counter *int) []record {
+	if len(recs) == 0 {
+		return nil
+	}
+	out := make([]record, len(recs))
+	for k, r := range recs {
+		r.Batch = renumber(r.Batch, counter)
+		if r.Audit != nil {
+			e := *r.Audit
+			*counter++
+			e.Id = strconv.Itoa(*counter)
+			r.Audit = &e
+		}
+		out[k] = r
+	}
+	return out
+}
+
+// Rollback discards the changes made with w. It does nothing if w was
+// already committed or rolled back.
+func (w *Work) Rollback() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.done = true
+	w.clone = nil
+}
@@ -0,0 +1,107 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/urvil38/todo-app/internal/task"
+)
+
+func TestWorkConflict(t *testing.T) {
+	ctx := context.Background()
+	tm := openPersistent(t, Config{})
+	a, err := tm.CreateTask(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wctx, w := tm.Begin(ctx)
+	if _, err := tm.UpdateTask(wctx, a.Id, "mine"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tm.UpdateTask(ctx, a.Id, "theirs"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Commit(); !errors.Is(err, ErrWorkConflict) {
+		t.Fatalf("Commit: got %v, want ErrWorkConflict", err)
+	}
+	if got := taskNames(t, tm); !reflect.DeepEqual(got, []string{"theirs"}) {
+		t.Errorf("got %q, want [theirs]", got)
+	}
+
+	if _, err := tm.GetTask(wctx, a.Id); !errors.Is(err, ErrWorkDone) {
+		t.Errorf("GetTask after Commit: got %v, want ErrWorkDone", err)
+	}
+	if err := w.Commit(); !errors.Is(err, ErrWorkDone) {
+		t.Errorf("second Commit: got %v, want ErrWorkDone", err)
+	}
+}
+
+func TestWorkPersisted(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	tm := openPersistent(t, Config{Dir: dir})
+
+	err := tm.Transact(ctx, func(ctx context.Context) error {
+		for _, name := range []string{"a", "b"} {
+			if _, err := tm.CreateTask(ctx, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := tm.ListAuditEvents(ctx, task.AuditFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Errorf("got %d audit events, want 2", len(events))
+	}
+	tm.Close()
+
+	tm = openPersistent(t, Config{Dir: dir})
+	defer tm.Close()
+	if got := taskNames(t, tm); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("after reopening, got %q, want [a b]", got)
+	}
+}
+
+// TestWorkPersistedLarge commits a unit of work larger than a record of the
+// write-ahead log, which is split over several records.
+func TestWorkPersistedLarge(t *testing.T) {
+	ctx := context.Background()
+	const n = 8000
+	cfg := Config{Dir: t.TempDir()}
+	tm := openPersistent(t, cfg)
+
+	err := tm.Transact(ctx, func(ctx context.Context) error {
+		for k := 0; k < n; k++ {
+			if _, err := tm.CreateTask(ctx, fmt.Sprintf("task %d with a name long enough to fill the log", k)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tm.journal.records < 2 {
+		t.Fatalf("unit of work appended %d records, want it split", tm.journal.records)
+	}
+	if _, err := tm.CreateTask(ctx, "after"); err != nil {
+		t.Fatal(err)
+	}
+	tm.Close()
+
+	tm = openPersistent(t, cfg)
+	defer tm.Close()
+	if got := len(taskNames(t, tm)); got != n+1 {
+		t.Errorf("after reopening, got %d tasks, want %d", got, n+1)
+	}
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net/http"
+
+	chi_middleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/urvil38/todo-app/internal/task"
+)
+
+// Actor returns a middleware that records who issued the request in the
+// request context, so that task mutations can be attributed in the audit log.
+// It must be installed after chi's RequestID and the RealIP middlewares.
+func Actor() Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := task.WithActor(r.Context(), task.Actor{
+				RequestID:  chi_middleware.GetReqID(r.Context()),
+				RemoteAddr: r.RemoteAddr,
+				UserAgent:  r.UserAgent(),
+			})
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
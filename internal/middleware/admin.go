@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// AdminAuth returns a middleware that only lets through requests carrying
+// token as a bearer token in their Authorization header, and answers the
+// others with 401 Unauthorized. An empty token lets no request through.
+func AdminAuth(token string) Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !hasBearerToken(r, token) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// AdminPrincipal returns a function that returns "admin" for requests
+// authorized by AdminAuth(token), and "" for the others, for PrincipalKey.
+func AdminPrincipal(token string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		if hasBearerToken(r, token) {
+			return "admin"
+		}
+		return ""
+	}
+}
+
+// hasBearerToken reports whether r carries token, which must not be empty,
+// as a bearer token.
+func hasBearerToken(r *http.Request, token string) bool {
+	const prefix = "Bearer "
+	h := r.Header.Get("Authorization")
+	if token == "" || !strings.HasPrefix(h, prefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(h[len(prefix):]), []byte(token)) == 1
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/urvil38/todo-app/internal/task"
+)
+
+const (
+	// RecentWriteCookie is set on responses to successful writes. While it
+	// is present, the client's reads see its own writes.
+	RecentWriteCookie = "todo_recent_write"
+	// ReadYourWritesHeader asks for a read that sees every earlier write,
+	// for clients that do not keep cookies.
+	ReadYourWritesHeader = "X-Read-Your-Writes"
+)
+
+// ReadYourWrites returns a middleware that lets clients read their own
+// writes when reads are served by replicas that may lag behind. Successful
+// writes set RecentWriteCookie for the given window, and requests carrying
+// the cookie or ReadYourWritesHeader are marked with task.WithFreshReads.
+func ReadYourWrites(window time.Duration) Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, err := r.Cookie(RecentWriteCookie); err == nil || r.Header.Get(ReadYourWritesHeader) != "" {
+				r = r.WithContext(task.WithFreshReads(r.Context()))
+			}
+			if !isWrite(r.Method) {
+				h.ServeHTTP(w, r)
+				return
+			}
+			rw := &recentWriteWriter{ResponseWriter: w, window: window}
+			h.ServeHTTP(rw, r)
+			// Handlers that write nothing, such as that of DELETE, succeed
+			// with the implicit 200 status.
+			if !rw.wroteHeader {
+				rw.WriteHeader(http.StatusOK)
+			}
+		})
+	}
+}
+
+func isWrite(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	default:
+		return true
+	}
+}
+
+// recentWriteWriter sets the recent write cookie if the response succeeds.
+// Headers cannot change once written, so the status is checked on the way
+// out.
+type recentWriteWriter struct {
+	http.ResponseWriter
+	window      time.Duration
+	wroteHeader bool
+}
+
+func (rw *recentWriteWriter) WriteHeader(code int) {
+	if !rw.wroteHeader {
+		rw.wroteHeader = true
+		if code < 400 {
+			http.SetCookie(rw.ResponseWriter, &http.Cookie{
+				Name:     RecentWriteCookie,
+				Value:    "1",
+				Path:     "/",
+				MaxAge:   int(math.Ceil(rw.window.Seconds())),
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recentWriteWriter) Write(b []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	return rw.ResponseWriter.Write(b)
+}
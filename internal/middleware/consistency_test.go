@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/urvil38/todo-app/internal/task"
+)
+
+func TestReadYourWritesCookie(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		method     string
+		handler    http.HandlerFunc
+		wantCookie bool
+	}{
+		{
+			name:       "write with body",
+			method:     http.MethodPost,
+			handler:    func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("{}")) },
+			wantCookie: true,
+		},
+		{
+			name:       "write with status",
+			method:     http.MethodPost,
+			handler:    func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusCreated) },
+			wantCookie: true,
+		},
+		{
+			name:       "write with no response",
+			method:     http.MethodDelete,
+			handler:    func(w http.ResponseWriter, r *http.Request) {},
+			wantCookie: true,
+		},
+		{
+			name:   "failed write",
+			method: http.MethodDelete,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "not found", http.StatusNotFound)
+			},
+		},
+		{
+			name:    "read",
+			method:  http.MethodGet,
+			handler: func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("{}")) },
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			ReadYourWrites(10*time.Second)(test.handler).ServeHTTP(rec, httptest.NewRequest(test.method, "/v1/tasks/1", nil))
+			var cookie *http.Cookie
+			for _, c := range rec.Result().Cookies() {
+				if c.Name == RecentWriteCookie {
+					cookie = c
+				}
+			}
+			if (cookie != nil) != test.wantCookie {
+				t.Fatalf("cookie = %v, want set: %t", cookie, test.wantCookie)
+			}
+			if cookie != nil && cookie.MaxAge != 10 {
+				t.Errorf("cookie MaxAge = %d, want 10", cookie.MaxAge)
+			}
+		})
+	}
+}
+
+func TestReadYourWritesFreshReads(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		setup func(r *http.Request)
+		want  bool
+	}{
+		{"plain", func(r *http.Request) {}, false},
+		{"cookie", func(r *http.Request) { r.AddCookie(&http.Cookie{Name: RecentWriteCookie, Value: "1"}) }, true},
+		{"header", func(r *http.Request) { r.Header.Set(ReadYourWritesHeader, "1") }, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var got bool
+			h := ReadYourWrites(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = task.FreshReadsRequested(r.Context())
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/v1/tasks", nil)
+			test.setup(r)
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			if got != test.want {
+				t.Errorf("FreshReadsRequested = %t, want %t", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig configures the CORS middleware.
+type CORSConfig struct {
+	// AllowedOrigins lists the origins that may make cross-origin requests.
+	// An entry may be "*" to allow any origin, or contain a wildcard
+	// subdomain such as "https://*.example.com".
+	AllowedOrigins []string
+	// AllowedMethods and AllowedHeaders are returned in preflight responses.
+	AllowedMethods []string
+	AllowedHeaders []string
+	// ExposedHeaders lists response headers that browsers may read.
+	ExposedHeaders []string
+	// AllowCredentials allows requests with cookies or HTTP authentication.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache preflight responses.
+	MaxAge time.Duration
+}
+
+// CORS returns a middleware implementing Cross-Origin Resource Sharing. It
+// answers preflight requests itself, since the router only accepts the
+// methods registered for each route. If no origins are allowed the
+// middleware does nothing.
+func CORS(cfg CORSConfig) Middleware {
+	allowAll := false
+	for _, o := range cfg.AllowedOrigins {
+		if o == "*" {
+			allowAll = true
+		}
+	}
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	exposed := strings.Join(cfg.ExposedHeaders, ", ")
+
+	return func(h http.Handler) http.Handler {
+		if len(cfg.AllowedOrigins) == 0 {
+			return h
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			hdr := w.Header()
+			// The response differs by origin unless every origin gets "*".
+			if !allowAll || cfg.AllowCredentials {
+				hdr.Add("Vary", "Origin")
+			}
+			if preflight {
+				hdr.Add("Vary", "Access-Control-Request-Method")
+				hdr.Add("Vary", "Access-Control-Request-Headers")
+			}
+
+			if origin == "" || !(allowAll || originAllowed(cfg.AllowedOrigins, origin)) {
+				if preflight {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			if allowAll && !cfg.AllowCredentials {
+				hdr.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				hdr.Set("Access-Control-Allow-Origin", origin)
+			}
+			if cfg.AllowCredentials {
+				hdr.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if !preflight {
+				if exposed != "" {
+					hdr.Set("Access-Control-Expose-Headers", exposed)
+				}
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			if methods != "" {
+				hdr.Set("Access-Control-Allow-Methods", methods)
+			}
+			if headers != "" {
+				hdr.Set("Access-Control-Allow-Headers", headers)
+			}
+			if cfg.MaxAge > 0 {
+				hdr.Set("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// originAllowed reports whether origin matches one of the allowed origins.
+// Matching is case-insensitive, and "*." in an allowed origin matches one or
+// more subdomain labels.
+func originAllowed(allowed []string, origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, a := range allowed {
+		a = strings.ToLower(a)
+		if a == origin {
+			return true
+		}
+		i := strings.Index(a, "*.")
+		if i < 0 {
+			continue
+		}
+		prefix, suffix := a[:i], a[i+1:]
+		if len(origin) > len(prefix)+len(suffix) &&
+			strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) &&
+			!strings.ContainsAny(origin[len(prefix):len(origin)-len(suffix)], "/:") {
+			return true
+		}
+	}
+	return false
+}
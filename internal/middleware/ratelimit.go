@@ -0,0 +1,176 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urvil38/todo-app/internal/ratelimit"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+var (
+	// RateLimitClass is the tag key for the class of a rate limited request:
+	// "read", "write", or the route of a RouteLimit.
+	RateLimitClass = tag.MustNewKey("todo_app.rate_limit_class")
+
+	// RateLimitRejected counts requests rejected by the RateLimit middleware.
+	RateLimitRejected = stats.Int64(
+		"todo_app/http/server/rate_limit_rejected",
+		"Number of requests rejected by rate limiting",
+		stats.UnitDimensionless,
+	)
+)
+
+// RateLimitConfig configures the RateLimit middleware.
+type RateLimitConfig struct {
+	// Read applies to GET, HEAD and OPTIONS requests, Write to all others.
+	Read, Write ratelimit.Limit
+
+	// Routes override Read and Write for the requests they match. The first
+	// match applies.
+	Routes []RouteLimit
+
+	// Key returns the identity requests are counted against. If nil, the
+	// client IP is used, so RealIP should run before RateLimit.
+	Key func(r *http.Request) string
+}
+
+// RouteLimit is the limit of the requests with Method, or any method if it
+// is empty, whose path starts with Prefix. Its requests are counted apart
+// from the others.
+type RouteLimit struct {
+	Method string
+	Prefix string
+	Limit  ratelimit.Limit
+}
+
+func (rl RouteLimit) matches(r *http.Request) bool {
+	return (rl.Method == "" || rl.Method == r.Method) && strings.HasPrefix(r.URL.Path, rl.Prefix)
+}
+
+// String returns the route of rl, such as "POST /v1/task".
+func (rl RouteLimit) String() string {
+	if rl.Method == "" {
+		return rl.Prefix
+	}
+	return rl.Method + " " + rl.Prefix
+}
+
+// ParseRouteLimits parses route limits written as "[METHOD ]/prefix=N", for N
+// requests per period.
+func ParseRouteLimits(specs []string, period time.Duration) ([]RouteLimit, error) {
+	var limits []RouteLimit
+	for _, spec := range specs {
+		route, n, ok := cut(spec, "=")
+		if !ok {
+			return nil, fmt.Errorf("route limit %q: missing =", spec)
+		}
+		requests, err := strconv.Atoi(strings.TrimSpace(n))
+		if err != nil {
+			return nil, fmt.Errorf("route limit %q: %v", spec, err)
+		}
+		rl := RouteLimit{Limit: ratelimit.Limit{Requests: requests, Period: period}}
+		fields := strings.Fields(route)
+		switch len(fields) {
+		case 1:
+			rl.Prefix = fields[0]
+		case 2:
+			rl.Method, rl.Prefix = strings.ToUpper(fields[0]), fields[1]
+		default:
+			return nil, fmt.Errorf("route limit %q: want [METHOD ]/prefix=N", spec)
+		}
+		if !strings.HasPrefix(rl.Prefix, "/") {
+			return nil, fmt.Errorf("route limit %q: path must start with /", spec)
+		}
+		limits = append(limits, rl)
+	}
+	return limits, nil
+}
+
+// cut is strings.Cut, which is newer than the Go version of the module.
+func cut(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// PrincipalKey returns a RateLimitConfig.Key that counts the requests of
+// authenticated clients by the principal that principal returns, and those
+// of the others, for which it returns "", by client IP.
+func PrincipalKey(principal func(r *http.Request) string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		if p := principal(r); p != "" {
+			return "principal:" + p
+		}
+		return "ip:" + clientIP(r)
+	}
+}
+
+// RateLimit returns a middleware that rejects requests exceeding the
+// configured limits with 429 Too Many Requests. Limits are tracked per key,
+// and separately for reads, writes and each of the routes with their own
+// limit. If the store fails, requests are let through.
+func RateLimit(store ratelimit.Store, cfg RateLimitConfig, lg *logrus.Logger) Middleware {
+	key := cfg.Key
+	if key == nil {
+		key = clientIP
+	}
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			class, limit := "write", cfg.Write
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				class, limit = "read", cfg.Read
+			}
+			for _, rl := range cfg.Routes {
+				if rl.matches(r) {
+					class, limit = rl.String(), rl.Limit
+					break
+				}
+			}
+			if !limit.Enabled() || r.URL.Path == "/health" {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			res, err := store.Take(r.Context(), class+":"+key(r), limit)
+			if err != nil {
+				lg.Error("rateLimit: unable to take token: ", err)
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("RateLimit-Reset", ceilSeconds(res.Reset))
+			if !res.Allowed {
+				ctx, _ := tag.New(r.Context(), tag.Upsert(RateLimitClass, class))
+				stats.Record(ctx, RateLimitRejected.M(1))
+				w.Header().Set("Retry-After", ceilSeconds(res.RetryAfter))
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,210 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urvil38/todo-app/internal/ratelimit"
+)
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("store unavailable")
+}
+
+func TestRateLimit(t *testing.T) {
+	lg := logrus.New()
+	lg.SetOutput(io.Discard)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	type request struct {
+		method, path, remoteAddr, auth string
+		// wantCode is the status of the response, and wantRemaining its
+		// RateLimit-Remaining header, if the request is limited.
+		wantCode      int
+		wantRemaining string
+	}
+	get := func(path string, code int, remaining string) request {
+		return request{method: http.MethodGet, path: path, wantCode: code, wantRemaining: remaining}
+	}
+	post := func(path string, code int, remaining string) request {
+		return request{method: http.MethodPost, path: path, wantCode: code, wantRemaining: remaining}
+	}
+	for _, test := range []struct {
+		name     string
+		store    ratelimit.Store
+		cfg      RateLimitConfig
+		requests []request
+	}{
+		{
+			name: "reads and writes counted apart",
+			cfg: RateLimitConfig{
+				Read:  ratelimit.Limit{Requests: 2, Period: time.Hour},
+				Write: ratelimit.Limit{Requests: 1, Period: time.Hour},
+			},
+			requests: []request{
+				get("/v1/tasks", http.StatusOK, "1"),
+				post("/v1/task", http.StatusOK, "0"),
+				get("/v1/tasks", http.StatusOK, "0"),
+				get("/v1/tasks", http.StatusTooManyRequests, "0"),
+				post("/v1/task", http.StatusTooManyRequests, "0"),
+			},
+		},
+		{
+			name: "disabled limit",
+			cfg:  RateLimitConfig{Write: ratelimit.Limit{Requests: 1, Period: time.Hour}},
+			requests: []request{
+				get("/v1/tasks", http.StatusOK, ""),
+				get("/v1/tasks", http.StatusOK, ""),
+			},
+		},
+		{
+			name: "health exempt",
+			cfg:  RateLimitConfig{Read: ratelimit.Limit{Requests: 1, Period: time.Hour}},
+			requests: []request{
+				get("/health", http.StatusOK, ""),
+				get("/health", http.StatusOK, ""),
+			},
+		},
+		{
+			name: "route limits",
+			cfg: RateLimitConfig{
+				Read:  ratelimit.Limit{Requests: 5, Period: time.Hour},
+				Write: ratelimit.Limit{Requests: 5, Period: time.Hour},
+				Routes: []RouteLimit{
+					{Method: http.MethodPost, Prefix: "/v1/task", Limit: ratelimit.Limit{Requests: 1, Period: time.Hour}},
+					{Prefix: "/v1/trash", Limit: ratelimit.Limit{Requests: 2, Period: time.Hour}},
+				},
+			},
+			requests: []request{
+				post("/v1/task", http.StatusOK, "0"),
+				post("/v1/task", http.StatusTooManyRequests, "0"),
+				// The method of the route does not match.
+				get("/v1/task/1", http.StatusOK, "4"),
+				// Routes without a method match all of them, and share
+				// their bucket.
+				get("/v1/trash", http.StatusOK, "1"),
+				post("/v1/trash/1/restore", http.StatusOK, "0"),
+				get("/v1/trash", http.StatusTooManyRequests, "0"),
+				post("/v1/other", http.StatusOK, "4"),
+			},
+		},
+		{
+			name: "keyed by client IP",
+			cfg:  RateLimitConfig{Read: ratelimit.Limit{Requests: 1, Period: time.Hour}},
+			requests: []request{
+				{method: http.MethodGet, path: "/v1/tasks", remoteAddr: "192.0.2.1:1234", wantCode: http.StatusOK, wantRemaining: "0"},
+				{method: http.MethodGet, path: "/v1/tasks", remoteAddr: "192.0.2.1:5678", wantCode: http.StatusTooManyRequests, wantRemaining: "0"},
+				{method: http.MethodGet, path: "/v1/tasks", remoteAddr: "192.0.2.2:1234", wantCode: http.StatusOK, wantRemaining: "0"},
+			},
+		},
+		{
+			name: "keyed by principal",
+			cfg: RateLimitConfig{
+				Read: ratelimit.Limit{Requests: 1, Period: time.Hour},
+				Key:  PrincipalKey(AdminPrincipal("s3cret")),
+			},
+			requests: []request{
+				{method: http.MethodGet, path: "/v1/tasks", remoteAddr: "192.0.2.1:1234", auth: "Bearer s3cret", wantCode: http.StatusOK, wantRemaining: "0"},
+				// The principal is counted apart from the IP it uses, and
+				// wherever it comes from.
+				{method: http.MethodGet, path: "/v1/tasks", remoteAddr: "192.0.2.1:1234", wantCode: http.StatusOK, wantRemaining: "0"},
+				{method: http.MethodGet, path: "/v1/tasks", remoteAddr: "192.0.2.2:1234", auth: "Bearer s3cret", wantCode: http.StatusTooManyRequests, wantRemaining: "0"},
+				// A wrong token is counted by IP.
+				{method: http.MethodGet, path: "/v1/tasks", remoteAddr: "192.0.2.1:1234", auth: "Bearer guess", wantCode: http.StatusTooManyRequests, wantRemaining: "0"},
+			},
+		},
+		{
+			name:  "store failure lets requests through",
+			store: failingStore{},
+			cfg:   RateLimitConfig{Read: ratelimit.Limit{Requests: 1, Period: time.Hour}},
+			requests: []request{
+				get("/v1/tasks", http.StatusOK, ""),
+				get("/v1/tasks", http.StatusOK, ""),
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			store := test.store
+			if store == nil {
+				store = ratelimit.NewMemoryStore()
+			}
+			h := RateLimit(store, test.cfg, lg)(ok)
+			for k, req := range test.requests {
+				r := httptest.NewRequest(req.method, req.path, nil)
+				if req.remoteAddr != "" {
+					r.RemoteAddr = req.remoteAddr
+				}
+				if req.auth != "" {
+					r.Header.Set("Authorization", req.auth)
+				}
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, r)
+
+				if rec.Code != req.wantCode {
+					t.Errorf("request %d, %s %s: status = %d, want %d", k, req.method, req.path, rec.Code, req.wantCode)
+				}
+				if got := rec.Header().Get("RateLimit-Remaining"); got != req.wantRemaining {
+					t.Errorf("request %d, %s %s: RateLimit-Remaining = %q, want %q", k, req.method, req.path, got, req.wantRemaining)
+				}
+				if got, want := rec.Header().Get("Retry-After") != "", req.wantCode == http.StatusTooManyRequests; got != want {
+					t.Errorf("request %d, %s %s: Retry-After set: %t, want %t", k, req.method, req.path, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	// One token is added every 20 seconds.
+	cfg := RateLimitConfig{Read: ratelimit.Limit{Requests: 3, Period: time.Minute}}
+	h := RateLimit(ratelimit.NewMemoryStore(), cfg, logrus.New())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, want := range []map[string]string{
+		{"RateLimit-Limit": "3", "RateLimit-Remaining": "2", "RateLimit-Reset": "20", "Retry-After": ""},
+		{"RateLimit-Limit": "3", "RateLimit-Remaining": "1", "RateLimit-Reset": "40", "Retry-After": ""},
+		{"RateLimit-Limit": "3", "RateLimit-Remaining": "0", "RateLimit-Reset": "60", "Retry-After": ""},
+		{"RateLimit-Limit": "3", "RateLimit-Remaining": "0", "RateLimit-Reset": "60", "Retry-After": "20"},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/tasks", nil))
+		for header, want := range want {
+			if got := rec.Header().Get(header); got != want {
+				t.Errorf("%s = %q, want %q", header, got, want)
+			}
+		}
+	}
+}
+
+func TestParseRouteLimits(t *testing.T) {
+	got, err := ParseRouteLimits([]string{"POST /v1/task=30", "/v1/admin = 10", "get /v1/tasks=0"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []RouteLimit{
+		{Method: http.MethodPost, Prefix: "/v1/task", Limit: ratelimit.Limit{Requests: 30, Period: time.Minute}},
+		{Prefix: "/v1/admin", Limit: ratelimit.Limit{Requests: 10, Period: time.Minute}},
+		{Method: http.MethodGet, Prefix: "/v1/tasks", Limit: ratelimit.Limit{Requests: 0, Period: time.Minute}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ParseRouteLimits() = %+v, want %+v", got, want)
+	}
+	for k := range want {
+		if got[k] != want[k] {
+			t.Errorf("route %d = %+v, want %+v", k, got[k], want[k])
+		}
+	}
+
+	for _, spec := range []string{"/v1/task", "POST /v1/task=many", "v1/task=1", "POST /v1/task extra=1"} {
+		if _, err := ParseRouteLimits([]string{spec}, time.Minute); err == nil {
+			t.Errorf("ParseRouteLimits(%q) succeeded, want error", spec)
+		}
+	}
+}
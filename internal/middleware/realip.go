@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ParseTrustedProxies parses the IP addresses and CIDR ranges of proxies
+// whose forwarding headers RealIP may trust.
+func ParseTrustedProxies(specs []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, spec := range specs {
+		if !strings.Contains(spec, "/") {
+			ip := net.ParseIP(spec)
+			if ip == nil {
+				return nil, fmt.Errorf("trusted proxy %q: invalid IP address", spec)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(spec)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %v", spec, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// RealIP returns a middleware that replaces the RemoteAddr of requests sent
+// by one of the trusted proxies with the client IP they forwarded, like chi's
+// RealIP. The True-Client-IP and X-Real-IP headers are taken as set by the
+// proxy. X-Forwarded-For is read from the right, skipping trusted proxies,
+// since its leftmost entries are whatever the client sent.
+//
+// The headers of other requests are ignored, so that clients cannot choose
+// the IP they are rate limited and audited by. With no trusted proxies,
+// RealIP does nothing.
+func RealIP(trusted []*net.IPNet) Middleware {
+	isTrusted := func(ip net.IP) bool {
+		for _, n := range trusted {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	return func(h http.Handler) http.Handler {
+		if len(trusted) == 0 {
+			return h
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if peer := net.ParseIP(clientIP(r)); peer != nil && isTrusted(peer) {
+				if ip := forwardedIP(r, isTrusted); ip != "" {
+					r.RemoteAddr = ip
+				}
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// forwardedIP returns the client IP forwarded with r, or "" if there is none.
+func forwardedIP(r *http.Request, isTrusted func(net.IP) bool) string {
+	for _, name := range []string{"True-Client-IP", "X-Real-IP"} {
+		if ip := net.ParseIP(strings.TrimSpace(r.Header.Get(name))); ip != nil {
+			return ip.String()
+		}
+	}
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	client := ""
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		client = ip.String()
+		if !isTrusted(ip) {
+			break
+		}
+	}
+	return client
+}
@@ -0,0 +1,203 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urvil38/todo-app/internal/ratelimit"
+)
+
+func TestRealIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1", "fd00::/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name       string
+		trusted    bool
+		remoteAddr string
+		headers    map[string][]string
+		want       string
+	}{
+		{
+			name:       "untrusted by default",
+			remoteAddr: "203.0.113.7:1234",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.1"}},
+			want:       "203.0.113.7:1234",
+		},
+		{
+			name:       "untrusted peer",
+			trusted:    true,
+			remoteAddr: "203.0.113.7:1234",
+			headers: map[string][]string{
+				"X-Forwarded-For": {"198.51.100.1"},
+				"X-Real-IP":       {"198.51.100.2"},
+				"True-Client-IP":  {"198.51.100.3"},
+			},
+			want: "203.0.113.7:1234",
+		},
+		{
+			name:       "no headers",
+			trusted:    true,
+			remoteAddr: "10.1.2.3:1234",
+			want:       "10.1.2.3:1234",
+		},
+		{
+			name:       "real ip",
+			trusted:    true,
+			remoteAddr: "10.1.2.3:1234",
+			headers: map[string][]string{
+				"X-Forwarded-For": {"198.51.100.1"},
+				"X-Real-IP":       {"198.51.100.2"},
+			},
+			want: "198.51.100.2",
+		},
+		{
+			name:       "true client ip",
+			trusted:    true,
+			remoteAddr: "192.168.1.1:1234",
+			headers: map[string][]string{
+				"X-Real-IP":      {"198.51.100.2"},
+				"True-Client-IP": {"198.51.100.3"},
+			},
+			want: "198.51.100.3",
+		},
+		{
+			name:       "forwarded for",
+			trusted:    true,
+			remoteAddr: "10.1.2.3:1234",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.1"}},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "spoofed forwarded for",
+			trusted:    true,
+			remoteAddr: "10.1.2.3:1234",
+			headers:    map[string][]string{"X-Forwarded-For": {"1.2.3.4, 198.51.100.1"}},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "proxy chain",
+			trusted:    true,
+			remoteAddr: "10.1.2.3:1234",
+			headers:    map[string][]string{"X-Forwarded-For": {"1.2.3.4, 198.51.100.1", "10.9.9.9, 192.168.1.1"}},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "only proxies",
+			trusted:    true,
+			remoteAddr: "10.1.2.3:1234",
+			headers:    map[string][]string{"X-Forwarded-For": {"10.9.9.9, 10.8.8.8"}},
+			want:       "10.9.9.9",
+		},
+		{
+			name:       "invalid hop",
+			trusted:    true,
+			remoteAddr: "10.1.2.3:1234",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.1, unknown"}},
+			want:       "10.1.2.3:1234",
+		},
+		{
+			name:       "ipv6",
+			trusted:    true,
+			remoteAddr: "[fd00::1]:1234",
+			headers:    map[string][]string{"X-Forwarded-For": {"2001:db8::1"}},
+			want:       "2001:db8::1",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			proxies := trusted
+			if !test.trusted {
+				proxies = nil
+			}
+			var got string
+			h := RealIP(proxies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.RemoteAddr
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/v1/tasks", nil)
+			r.RemoteAddr = test.remoteAddr
+			for name, values := range test.headers {
+				for _, v := range values {
+					r.Header.Add(name, v)
+				}
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			if got != test.want {
+				t.Errorf("RemoteAddr = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRealIPRateLimit(t *testing.T) {
+	lg := logrus.New()
+	lg.SetOutput(io.Discard)
+	limit := ratelimit.Limit{Requests: 1, Period: time.Hour}
+	newHandler := func(trusted []string) http.Handler {
+		t.Helper()
+		proxies, err := ParseTrustedProxies(trusted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+		return Chain(
+			RealIP(proxies),
+			RateLimit(ratelimit.NewMemoryStore(), RateLimitConfig{Read: limit}, lg),
+		)(ok)
+	}
+	get := func(h http.Handler, remoteAddr, forwardedFor string) int {
+		r := httptest.NewRequest(http.MethodGet, "/v1/tasks", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("X-Forwarded-For", forwardedFor)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	// Without trusted proxies, a client cannot get a new limit by sending a
+	// different X-Forwarded-For with each request.
+	h := newHandler(nil)
+	if code := get(h, "203.0.113.7:1234", "198.51.100.1"); code != http.StatusOK {
+		t.Fatalf("first request: status = %d, want %d", code, http.StatusOK)
+	}
+	if code := get(h, "203.0.113.7:1234", "198.51.100.2"); code != http.StatusTooManyRequests {
+		t.Errorf("spoofed request: status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+
+	// Behind a trusted proxy, clients are limited apart.
+	h = newHandler([]string{"10.0.0.0/8"})
+	for _, client := range []string{"198.51.100.1", "198.51.100.2"} {
+		if code := get(h, "10.1.2.3:1234", client); code != http.StatusOK {
+			t.Errorf("request of %s: status = %d, want %d", client, code, http.StatusOK)
+		}
+	}
+	if code := get(h, "10.1.2.3:1234", "198.51.100.1"); code != http.StatusTooManyRequests {
+		t.Errorf("second request of 198.51.100.1: status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	got, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1", "::1", "fd00::/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"10.0.0.0/8", "192.168.1.1/32", "::1/128", "fd00::/8"}
+	if len(got) != len(want) {
+		t.Fatalf("ParseTrustedProxies() = %v, want %v", got, want)
+	}
+	for k := range want {
+		if got[k].String() != want[k] {
+			t.Errorf("proxy %d = %s, want %s", k, got[k], want[k])
+		}
+	}
+
+	for _, spec := range []string{"localhost", "10.0.0.0/33", "10.0.0", ""} {
+		if _, err := ParseTrustedProxies([]string{spec}); err == nil {
+			t.Errorf("ParseTrustedProxies(%q) succeeded, want error", spec)
+		}
+	}
+}
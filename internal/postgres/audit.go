@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/urvil38/todo-app/internal/database"
+	"github.com/urvil38/todo-app/internal/task"
+	"go.opencensus.io/trace"
+)
+
+// insertAuditEvent records a task mutation. It must be called with a DB that
+// is in the same transaction as the mutation itself.
+func insertAuditEvent(ctx context.Context, tx *database.DB, action task.Action, taskID string, before, after *task.Task) error {
+	e := task.NewAuditEvent(ctx, action, taskID, before, after)
+	b, a, err := e.MarshalSnapshots()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+	INSERT INTO audit_events(
+		task_id, action, request_id, remote_addr, user_agent, before, after)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, e.TaskId, string(e.Action), e.Actor.RequestID, e.Actor.RemoteAddr, e.Actor.UserAgent, b, a)
+	return err
+}
+
+func (tm *TaskManager) TaskHistory(ctx context.Context, id string) ([]task.AuditEvent, error) {
+	ctx, span := trace.StartSpan(ctx, "db.TaskHistory")
+	defer span.End()
+
+	return tm.ListAuditEvents(ctx, task.AuditFilter{TaskId: id})
+}
+
+func (tm *TaskManager) ListAuditEvents(ctx context.Context, f task.AuditFilter) ([]task.AuditEvent, error) {
+	ctx, span := trace.StartSpan(ctx, "db.ListAuditEvents")
+	defer span.End()
+
+	var conds []string
+	if f.TaskId != "" {
+		// Events recorded before a task's ID was converted are filed under
+		// its legacy ID, so match both.
+		conds = append(conds, `(task_id = :task_id
+			OR task_id IN (SELECT id FROM tasks WHERE legacy_id = :task_id AND legacy_id <> '')
+			OR task_id IN (SELECT legacy_id FROM tasks WHERE id = :task_id AND legacy_id <> ''))`)
+	}
+	if !f.Since.IsZero() {
+		conds = append(conds, "created_at >= :since")
+	}
+	if !f.Until.IsZero() {
+		conds = append(conds, "created_at < :until")
+	}
+
+	query := "SELECT " + task.AuditEventColumns + " FROM audit_events"
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " ORDER BY created_at, id"
+	if f.Limit > 0 {
+		query += " LIMIT :limit"
+	}
+
+	params := map[string]interface{}{"task_id": f.TaskId, "since": f.Since, "until": f.Until, "limit": f.Limit}
+	var events []task.AuditEvent
+	err := tm.db.primary(ctx).NamedRunQuery(ctx, query, params, func(rows *sql.Rows) error {
+		e, err := task.ScanAuditEvent(rows.Scan)
+		if err != nil {
+			return err
+		}
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,269 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/lib/pq"
+	"github.com/urvil38/todo-app/internal/backup"
+	"github.com/urvil38/todo-app/internal/database"
+	"github.com/urvil38/todo-app/internal/task"
+	"go.opencensus.io/trace"
+)
+
+// backupBatchSize is the number of rows fetched or inserted at a time by
+// backups and restores.
+const backupBatchSize = 1000
+
+// uniqueViolationCode is the Postgres error code of a unique constraint
+// violation.
+const uniqueViolationCode = "23505"
+
+func (tm *TaskManager) ExportBackup(ctx context.Context, w *backup.Writer) error {
+	ctx, span := trace.StartSpan(ctx, "db.ExportBackup")
+	defer span.End()
+
+	return tm.db.ExportBackup(ctx, w)
+}
+
+func (tm *TaskManager) ImportBackup(ctx context.Context, r io.Reader, policy backup.ConflictPolicy) (backup.Result, error) {
+	ctx, span := trace.StartSpan(ctx, "db.ImportBackup")
+	defer span.End()
+
+	return tm.db.ImportBackup(ctx, r, policy)
+}
+
+// ExportBackup writes every task, including those in the trash, and every
+// audit event to w. Both tables are read from the same snapshot.
+func (db *DB) ExportBackup(ctx context.Context, w *backup.Writer) error {
+	// Rows written to w cannot be taken back, so the transaction must not
+	// be retried, after a reset connection for example.
+	ctx = database.WithRetryPolicy(ctx, database.RetryPolicy{MaxAttempts: 1})
+	return db.db.Transact(ctx, sql.LevelRepeatableRead, func(tx *database.DB) error {
+		err := database.QueryIter(ctx, tx, "SELECT "+taskColumns+" FROM tasks ORDER BY created_at, id", backupBatchSize, w.WriteTask)
+		if err != nil {
+			return err
+		}
+		return tx.RunQueryIncrementally(ctx, "SELECT "+task.AuditEventColumns+" FROM audit_events ORDER BY id", backupBatchSize, func(rows *sql.Rows) error {
+			e, err := task.ScanAuditEvent(rows.Scan)
+			if err != nil {
+				return err
+			}
+			return w.WriteAuditEvent(e)
+		})
+	})
+}
+
+// ImportBackup restores the archive in r in a single transaction, so that a
+// corrupt archive or a conflict under backup.ConflictFail changes nothing.
+// Audit events keep their IDs where they are free; see restoreAuditEvents.
+// Restored tasks get no new audit events.
+func (db *DB) ImportBackup(ctx context.Context, r io.Reader, policy backup.ConflictPolicy) (backup.Result, error) {
+	var res backup.Result
+	err := db.db.Transact(ctx, sql.LevelDefault, func(tx *database.DB) error {
+		if err := PreserveUpdatedAt(ctx, tx); err != nil {
+			return err
+		}
+
+		var tasks []task.Task
+		var events []task.AuditEvent
+		_, err := backup.Read(r, backup.Handler{
+			Task: func(t task.Task) error {
+				tasks = append(tasks, t)
+				if len(tasks) < backupBatchSize {
+					return nil
+				}
+				err := restoreTasks(ctx, tx, tasks, policy, &res)
+				tasks = tasks[:0]
+				return err
+			},
+			AuditEvent: func(e task.AuditEvent) error {
+				events = append(events, e)
+				if len(events) < backupBatchSize {
+					return nil
+				}
+				err := restoreAuditEvents(ctx, tx, events, &res)
+				events = events[:0]
+				return err
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if err := restoreTasks(ctx, tx, tasks, policy, &res); err != nil {
+			return err
+		}
+		if err := restoreAuditEvents(ctx, tx, events, &res); err != nil {
+			return err
+		}
+
+		// Continue the sequence after the restored events.
+		_, err = tx.Exec(ctx, "SELECT setval('audit_events_id_seq', max(id)) FROM audit_events HAVING max(id) IS NOT NULL")
+		return err
+	})
+	if err != nil {
+		return backup.Result{}, err
+	}
+	return res, nil
+}
+
+// PreserveUpdatedAt makes the set_updated_at trigger keep the updated_at of
+// the tasks written by tx until it ends, so that they can be restored as
+// they were. Unlike disabling the trigger, it does not lock the table, and
+// does not affect other transactions. tx must be a transaction.
+func PreserveUpdatedAt(ctx context.Context, tx *database.DB) error {
+	_, err := tx.Exec(ctx, "SET LOCAL todo.preserve_updated_at = 'on'")
+	return err
+}
+
+func restoreTasks(ctx context.Context, tx *database.DB, tasks []task.Task, policy backup.ConflictPolicy, res *backup.Result) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	columns := []string{"id", "name", "created_at", "updated_at", "deleted_at", "legacy_id"}
+	var values []interface{}
+	for _, t := range tasks {
+		if err := task.ValidateName(t.Name); err != nil {
+			return fmt.Errorf("%w: task %s: %v", backup.ErrCorrupt, t.Id, err)
+		}
+		values = append(values, t.Id, t.Name, t.CreatedAt, t.UpdatedAt, t.DeletedAt, t.LegacyId)
+	}
+
+	switch policy {
+	case backup.ConflictSkip:
+		inserted := 0
+		err := tx.BulkInsertReturning(ctx, "tasks", columns, values, "ON CONFLICT DO NOTHING", []string{"id"}, func(rows *sql.Rows) error {
+			inserted++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		res.Tasks += inserted
+		res.Skipped += len(tasks) - inserted
+	case backup.ConflictOverwrite:
+		// xmax is only set on rows that existed and were updated.
+		return tx.BulkUpsertReturning(ctx, "tasks", columns, values, []string{"id"}, []string{"xmax <> 0"}, func(rows *sql.Rows) error {
+			var updated bool
+			if err := rows.Scan(&updated); err != nil {
+				return err
+			}
+			if updated {
+				res.Overwritten++
+			} else {
+				res.Tasks++
+			}
+			return nil
+		})
+	default:
+		err := tx.BulkInsert(ctx, "tasks", columns, values, "")
+		var perr *pgconn.PgError
+		if errors.As(err, &perr) && perr.Code == uniqueViolationCode {
+			return fmt.Errorf("%w: %s", backup.ErrConflict, perr.Detail)
+		}
+		if err != nil {
+			return err
+		}
+		res.Tasks += len(tasks)
+	}
+	return nil
+}
+
+// restoreAuditEvents inserts events with their archived IDs. An event whose
+// ID is taken by an event of the same task created at the same time was
+// restored before, and is skipped. One whose ID is taken by an unrelated
+// event is inserted with a new ID.
+func restoreAuditEvents(ctx context.Context, tx *database.DB, events []task.AuditEvent, res *backup.Result) error {
+	if len(events) == 0 {
+		return nil
+	}
+	columns := []string{"id", "task_id", "action", "request_id", "remote_addr", "user_agent", "before", "after", "created_at"}
+	var (
+		ids    []int64
+		values []interface{}
+	)
+	for _, e := range events {
+		id, err := strconv.ParseInt(e.Id, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: audit event id %q", backup.ErrCorrupt, e.Id)
+		}
+		before, after, err := e.MarshalSnapshots()
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+		values = append(values, id, e.TaskId, string(e.Action), e.Actor.RequestID, e.Actor.RemoteAddr, e.Actor.UserAgent, before, after, e.CreatedAt)
+	}
+	inserted := make(map[int64]bool)
+	err := tx.BulkInsertReturning(ctx, "audit_events", columns, values, "ON CONFLICT (id) DO NOTHING", []string{"id"}, func(rows *sql.Rows) error {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		inserted[id] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	res.AuditEvents += len(inserted)
+	if len(inserted) == len(events) {
+		return nil
+	}
+
+	// Compare the events that were not inserted with those holding their IDs.
+	var conflicts []int64
+	for _, id := range ids {
+		if !inserted[id] {
+			conflicts = append(conflicts, id)
+		}
+	}
+	type identity struct {
+		taskID    string
+		createdAt time.Time
+	}
+	existing := make(map[int64]identity)
+	err = tx.RunQuery(ctx, "SELECT id, task_id, created_at FROM audit_events WHERE id = ANY($1)", func(rows *sql.Rows) error {
+		var (
+			id int64
+			e  identity
+		)
+		if err := rows.Scan(&id, &e.taskID, &e.createdAt); err != nil {
+			return err
+		}
+		existing[id] = e
+		return nil
+	}, pq.Array(conflicts))
+	if err != nil {
+		return err
+	}
+	var renumbered []interface{}
+	for k, id := range ids {
+		if inserted[id] {
+			continue
+		}
+		if e := existing[id]; e.taskID == events[k].TaskId && e.createdAt.Equal(events[k].CreatedAt) {
+			res.SkippedAuditEvents++
+			continue
+		}
+		renumbered = append(renumbered, values[k*len(columns)+1:(k+1)*len(columns)]...)
+	}
+	if len(renumbered) == 0 {
+		return nil
+	}
+	// Move the sequence past the IDs restored so far, which it did not issue.
+	if _, err := tx.Exec(ctx, "SELECT setval('audit_events_id_seq', max(id)) FROM audit_events"); err != nil {
+		return err
+	}
+	if err := tx.BulkInsert(ctx, "audit_events", columns[1:], renumbered, ""); err != nil {
+		return err
+	}
+	res.AuditEvents += len(renumbered) / (len(columns) - 1)
+	return nil
+}
@@ -0,0 +1,102 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/urvil38/todo-app/internal/backup"
+	"github.com/urvil38/todo-app/internal/database"
+	"github.com/urvil38/todo-app/internal/task"
+)
+
+func TestBackupRoundTrip(t *testing.T) {
+	if testDB == nil {
+		t.Skip("no database")
+	}
+	ctx := context.Background()
+	if err := database.ResetDB(ctx, testDB); err != nil {
+		t.Fatal(err)
+	}
+	tm := &TaskManager{db: New(testDB), ids: task.NewIDGenerator(task.IDSchemeULID)}
+	a, err := tm.CreateTask(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := tm.CreateTask(ctx, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tm.DeleteTask(ctx, b.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	w, err := backup.NewWriter(&buf, "postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tm.ExportBackup(ctx, w); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	archive := buf.Bytes()
+
+	if _, err := tm.ImportBackup(ctx, bytes.NewReader(archive), backup.ConflictFail); !errors.Is(err, backup.ErrConflict) {
+		t.Errorf("ImportBackup(fail) into the same database = %v, want ErrConflict", err)
+	}
+
+	if err := database.ResetDB(ctx, testDB); err != nil {
+		t.Fatal(err)
+	}
+	res, err := tm.ImportBackup(ctx, bytes.NewReader(archive), backup.ConflictFail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (backup.Result{Tasks: 2, AuditEvents: 3}); res != want {
+		t.Errorf("ImportBackup() = %+v, want %+v", res, want)
+	}
+	got, err := tm.GetTask(ctx, a.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.UpdatedAt.Equal(a.UpdatedAt) {
+		t.Errorf("UpdatedAt = %v, want %v", got.UpdatedAt, a.UpdatedAt)
+	}
+	if trash, err := tm.ListTrash(ctx); err != nil || len(trash) != 1 || trash[0].Id != b.Id {
+		t.Errorf("ListTrash() = %+v, %v", trash, err)
+	}
+
+	res, err = tm.ImportBackup(ctx, bytes.NewReader(archive), backup.ConflictSkip)
+	if err != nil || res.Skipped != 2 || res.AuditEvents != 0 || res.SkippedAuditEvents != 3 {
+		t.Errorf("ImportBackup(skip) = %+v, %v", res, err)
+	}
+	res, err = tm.ImportBackup(ctx, bytes.NewReader(archive), backup.ConflictOverwrite)
+	if err != nil || res.Overwritten != 2 {
+		t.Errorf("ImportBackup(overwrite) = %+v, %v", res, err)
+	}
+
+	// Events of another database that hold the same IDs are kept, with new
+	// IDs.
+	if err := database.ResetDB(ctx, testDB); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testDB.Exec(ctx, "ALTER SEQUENCE audit_events_id_seq RESTART"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"x", "y", "z"} {
+		if _, err := tm.CreateTask(ctx, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err = tm.ImportBackup(ctx, bytes.NewReader(archive), backup.ConflictFail)
+	if err != nil || res.AuditEvents != 3 || res.SkippedAuditEvents != 0 {
+		t.Errorf("ImportBackup() over unrelated events = %+v, %v", res, err)
+	}
+	if events, err := tm.ListAuditEvents(ctx, task.AuditFilter{}); err != nil || len(events) != 6 {
+		t.Errorf("ListAuditEvents() = %d events, %v, want 6", len(events), err)
+	}
+}
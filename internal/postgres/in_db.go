@@ -3,6 +3,8 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"time"
 
 	"github.com/urvil38/todo-app/internal/config"
 	"github.com/urvil38/todo-app/internal/database"
@@ -11,8 +13,17 @@ import (
 	"go.opencensus.io/trace"
 )
 
+// taskColumns are the columns of the tasks table, in the order of the fields
+// of task.Task.
+const taskColumns = "id, name, created_at, updated_at, deleted_at, legacy_id"
+
+// matchID matches a task by ID or by legacy ID, given as $1. Tasks without
+// a legacy ID have an empty legacy_id, which must not match an empty ID.
+const matchID = "(id = $1 OR (legacy_id = $1 AND legacy_id <> ''))"
+
 type TaskManager struct {
-	db *DB
+	db  *DB
+	ids task.IDGenerator
 }
 
 func NewTaskManager(ctx context.Context, cfg config.Config) *TaskManager {
@@ -21,23 +32,50 @@ func NewTaskManager(ctx context.Context, cfg config.Config) *TaskManager {
 		log.Logger.Fatal(err)
 	}
 	return &TaskManager{
-		db: db,
+		db:  db,
+		ids: task.NewIDGenerator(task.IDScheme(cfg.IDScheme)),
 	}
 }
 
+// DB returns the database used by tm.
+func (tm *TaskManager) DB() *DB {
+	return tm.db
+}
+
+// Transact runs f in a database transaction carried by its context. The
+// TaskManager calls made with that context run their own transactions as
+// savepoints within it.
+func (tm *TaskManager) Transact(ctx context.Context, f func(ctx context.Context) error) error {
+	ctx, span := trace.StartSpan(ctx, "db.Transact")
+	defer span.End()
+
+	return tm.db.primary(ctx).Transact(ctx, sql.LevelDefault, func(tx *database.DB) error {
+		return f(database.WithTx(ctx, tx))
+	})
+}
+
 func (tm *TaskManager) CreateTask(ctx context.Context, name string) (_ task.Task, err error) {
 	ctx, span := trace.StartSpan(ctx, "db.CreateTask")
 	defer span.End()
 
+	if err := task.ValidateName(name); err != nil {
+		return task.Task{}, err
+	}
+
 	taskArgs := database.StructScanner(task.Task{})
 	var t task.Task
 
-	err = tm.db.db.QueryRow(ctx, `
-	INSERT INTO tasks(
-		name)
-	VALUES ($1)
-	RETURNING id, name, created_at, updated_at
-	`, name).Scan(taskArgs(&t)...)
+	err = tm.db.primary(ctx).Transact(ctx, sql.LevelDefault, func(tx *database.DB) error {
+		err := tx.QueryRow(ctx, `
+		INSERT INTO tasks(
+			id, name)
+		VALUES ($1, $2)
+		RETURNING `+taskColumns, tm.ids.NewID(time.Now()), name).Scan(taskArgs(&t)...)
+		if err != nil {
+			return err
+		}
+		return insertAuditEvent(ctx, tx, task.ActionCreate, t.Id, nil, &t)
+	})
 	if err != nil {
 		return t, err
 	}
@@ -49,12 +87,26 @@ func (tm *TaskManager) UpdateTask(ctx context.Context, id, name string) (task.Ta
 	ctx, span := trace.StartSpan(ctx, "db.UpdateTask")
 	defer span.End()
 
+	if err := task.ValidateName(name); err != nil {
+		return task.Task{}, err
+	}
+
 	taskArgs := database.StructScanner(task.Task{})
-	var t task.Task
+	var before, t task.Task
 
-	err := tm.db.db.QueryRow(ctx, "UPDATE tasks SET name = $1 WHERE id = $2 RETURNING id, name, created_at, updated_at", name, id).Scan(taskArgs(&t)...)
+	err := tm.db.primary(ctx).Transact(ctx, sql.LevelDefault, func(tx *database.DB) error {
+		err := tx.QueryRow(ctx, "SELECT "+taskColumns+" FROM tasks WHERE "+matchID+" AND deleted_at IS NULL FOR UPDATE", id).Scan(taskArgs(&before)...)
+		if err != nil {
+			return err
+		}
+		err = tx.QueryRow(ctx, "UPDATE tasks SET name = $1 WHERE id = $2 RETURNING "+taskColumns, name, before.Id).Scan(taskArgs(&t)...)
+		if err != nil {
+			return err
+		}
+		return insertAuditEvent(ctx, tx, task.ActionUpdate, t.Id, &before, &t)
+	})
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, sql.ErrNoRows) {
 			return t, task.ErrTaskNotFound
 		} else {
 			return t, err
@@ -71,9 +123,20 @@ func (tm *TaskManager) DeleteTask(ctx context.Context, id string) error {
 	taskArgs := database.StructScanner(task.Task{})
 	var t task.Task
 
-	err := tm.db.db.QueryRow(ctx, "DELETE FROM tasks WHERE id = $1 RETURNING id, name, created_at, updated_at", id).Scan(taskArgs(&t)...)
+	err := tm.db.primary(ctx).Transact(ctx, sql.LevelDefault, func(tx *database.DB) error {
+		var before task.Task
+		err := tx.QueryRow(ctx, "SELECT "+taskColumns+" FROM tasks WHERE "+matchID+" AND deleted_at IS NULL FOR UPDATE", id).Scan(taskArgs(&before)...)
+		if err != nil {
+			return err
+		}
+		err = tx.QueryRow(ctx, "UPDATE tasks SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 RETURNING "+taskColumns, before.Id).Scan(taskArgs(&t)...)
+		if err != nil {
+			return err
+		}
+		return insertAuditEvent(ctx, tx, task.ActionDelete, t.Id, &before, &t)
+	})
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, sql.ErrNoRows) {
 			return task.ErrTaskNotFound
 		} else {
 			return err
@@ -84,23 +147,21 @@ func (tm *TaskManager) DeleteTask(ctx context.Context, id string) error {
 	return nil
 }
 
+// ListTasks reads from a replica, if there are any, unless
+// task.WithFreshReads was used.
 func (tm *TaskManager) ListTasks(ctx context.Context) ([]task.Task, error) {
 	ctx, span := trace.StartSpan(ctx, "db.ListTasks")
 	defer span.End()
 
 	var tasks []task.Task
 
-	collect := func(rows *sql.Rows) error {
-		var t task.Task
-		taskArgs := database.StructScanner(task.Task{})
-		if err := rows.Scan(taskArgs(&t)...); err != nil {
-			return err
-		}
-		tasks = append(tasks, t)
-		return nil
-	}
-
-	err := tm.db.db.RunQueryIncrementally(ctx, "SELECT id, name, created_at, updated_at FROM tasks", 5000, collect)
+	err := tm.db.read(ctx, func(db *database.DB) error {
+		tasks = nil
+		return database.QueryIter(ctx, db, "SELECT "+taskColumns+" FROM tasks WHERE deleted_at IS NULL ORDER BY created_at, id", 5000, func(t task.Task) error {
+			tasks = append(tasks, t)
+			return nil
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -108,16 +169,20 @@ func (tm *TaskManager) ListTasks(ctx context.Context) ([]task.Task, error) {
 	return tasks, nil
 }
 
+// GetTask reads from a replica, if there are any, unless
+// task.WithFreshReads was used.
 func (tm *TaskManager) GetTask(ctx context.Context, id string) (task.Task, error) {
 	ctx, span := trace.StartSpan(ctx, "db.GetTask")
 	defer span.End()
 
-	taskArgs := database.StructScanner(task.Task{})
 	var t task.Task
 
-	err := tm.db.db.QueryRow(ctx, "SELECT id, name, created_at, updated_at FROM tasks WHERE id = $1", id).Scan(taskArgs(&t)...)
+	err := tm.db.read(ctx, func(db *database.DB) (err error) {
+		t, err = database.QueryOne[task.Task](ctx, db, "SELECT "+taskColumns+" FROM tasks WHERE "+matchID+" AND deleted_at IS NULL", id)
+		return err
+	})
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, sql.ErrNoRows) {
 			return t, task.ErrTaskNotFound
 		} else {
 			return t, err
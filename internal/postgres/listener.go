@@ -0,0 +1,347 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/urvil38/todo-app/internal/log"
+	"github.com/urvil38/todo-app/internal/task"
+)
+
+// TaskChangesChannel is the channel on which the tasks table publishes its
+// changes, as set up by the migrations.
+const TaskChangesChannel = "task_changes"
+
+const (
+	// listenerMinBackoff and listenerMaxBackoff bound the delay between
+	// attempts to connect a Listener.
+	listenerMinBackoff = 250 * time.Millisecond
+	listenerMaxBackoff = 30 * time.Second
+	// listenerPingInterval is how long a Listener waits for notifications
+	// before checking that its connection is still alive.
+	listenerPingInterval = 30 * time.Second
+	// listenerTimeout bounds connecting and running a command.
+	listenerTimeout = 10 * time.Second
+)
+
+// ErrListenerClosed is returned by Listen once the Listener is closed.
+var ErrListenerClosed = errors.New("postgres: listener closed")
+
+// Listener holds a dedicated connection to postgres on which it listens for
+// notifications, and calls the handlers of their channels. When the
+// connection is lost, it reconnects with exponential backoff and listens on
+// the same channels again. Notifications sent while it is disconnected are
+// lost, which is why handlers registered with OnReconnect are called once it
+// is back, for instance to drop what they cached.
+type Listener struct {
+	cfg    *pgconn.Config
+	cancel context.CancelFunc
+
+	mu          sync.Mutex
+	handlers    map[string][]func(payload string)
+	onReconnect []func()
+	listening   map[string]bool // channels listened on by the connection
+	changed     chan struct{}   // closed when listening changes
+
+	wake    chan struct{} // signals that a channel was added
+	stopped chan struct{} // closed when the Listener is closed
+}
+
+// NewListener returns a Listener that connects with connString, such as
+// config.Config.DBConnInfo returns. It connects in the background, until
+// Close is called.
+func NewListener(connString string) (*Listener, error) {
+	cfg, err := pgconn.ParseConfig(connString)
+	if err != nil {
+		return nil, fmt.Errorf("pgconn.ParseConfig(): %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &Listener{
+		cfg:       cfg,
+		cancel:    cancel,
+		handlers:  make(map[string][]func(string)),
+		listening: make(map[string]bool),
+		changed:   make(chan struct{}),
+		wake:      make(chan struct{}, 1),
+		stopped:   make(chan struct{}),
+	}
+	cfg.OnNotification = func(_ *pgconn.PgConn, n *pgconn.Notification) {
+		l.dispatch(n)
+	}
+	go l.run(ctx)
+	return l, nil
+}
+
+// Close stops l and closes its connection.
+func (l *Listener) Close() error {
+	l.cancel()
+	<-l.stopped
+	return nil
+}
+
+// Listen calls f with the payload of every notification sent on channel,
+// and waits until l listens on it, or ctx is done. In the latter case f
+// stays registered, and will be called once l is connected.
+//
+// Handlers are called one at a time, in the order the notifications were
+// sent, from the goroutine of l: they must return quickly, and must not call
+// Close.
+func (l *Listener) Listen(ctx context.Context, channel string, f func(payload string)) error {
+	l.mu.Lock()
+	l.handlers[channel] = append(l.handlers[channel], f)
+	l.mu.Unlock()
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+
+	for {
+		l.mu.Lock()
+		ok, changed := l.listening[channel], l.changed
+		l.mu.Unlock()
+		if ok {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-l.stopped:
+			return ErrListenerClosed
+		}
+	}
+}
+
+// OnReconnect calls f every time l is connected again after losing its
+// connection, once it listens on its channels again. Like the handlers of
+// notifications, f is called from the goroutine of l.
+func (l *Listener) OnReconnect(f func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.onReconnect = append(l.onReconnect, f)
+}
+
+// dispatch calls the handlers of the channel of n.
+func (l *Listener) dispatch(n *pgconn.Notification) {
+	l.mu.Lock()
+	handlers := l.handlers[n.Channel]
+	l.mu.Unlock()
+	for _, f := range handlers {
+		f(n.Payload)
+	}
+}
+
+// run connects l until ctx is done, waiting longer after every failed
+// attempt.
+func (l *Listener) run(ctx context.Context) {
+	defer close(l.stopped)
+
+	connected := false
+	for failures := 0; ; {
+		conn, err := l.connect(ctx)
+		if err == nil {
+			if connected {
+				log.Logger.Infof("postgres listener reconnected")
+				l.reconnected()
+			}
+			connected, failures = true, 0
+			err = l.serve(ctx, conn)
+			l.setListening("", false)
+			closeCtx, cancel := context.WithTimeout(context.Background(), listenerTimeout)
+			conn.Close(closeCtx)
+			cancel()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		failures++
+		d := listenerBackoff(failures)
+		log.Logger.Warnf("postgres listener disconnected, reconnecting in %s: %v", d, err)
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return
+		}
+	}
+}
+
+// connect opens a connection that listens on the channels of l.
+func (l *Listener) connect(ctx context.Context) (*pgconn.PgConn, error) {
+	cctx, cancel := context.WithTimeout(ctx, listenerTimeout)
+	conn, err := pgconn.ConnectConfig(cctx, l.cfg)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	if err := l.listenAll(ctx, conn); err != nil {
+		conn.Close(context.Background())
+		return nil, err
+	}
+	return conn, nil
+}
+
+// serve waits for the notifications received by conn, which the handlers
+// are called with as they arrive, and listens on the channels added
+// meanwhile. It returns when ctx is done or conn fails.
+func (l *Listener) serve(ctx context.Context, conn *pgconn.PgConn) error {
+	for {
+		if err := l.listenAll(ctx, conn); err != nil {
+			return err
+		}
+		wctx, cancel := context.WithTimeout(ctx, listenerPingInterval)
+		stop := make(chan struct{})
+		go func() {
+			select {
+			case <-l.wake:
+				cancel()
+			case <-stop:
+			}
+		}()
+		err := conn.WaitForNotification(wctx)
+		close(stop)
+		waitErr := wctx.Err()
+		cancel()
+		switch {
+		case err == nil:
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case waitErr == nil:
+			return err
+		case errors.Is(waitErr, context.DeadlineExceeded):
+			pctx, cancel := context.WithTimeout(ctx, listenerTimeout)
+			_, err := conn.Exec(pctx, "-- ping").ReadAll()
+			cancel()
+			if err != nil {
+				return fmt.Errorf("ping: %v", err)
+			}
+		}
+	}
+}
+
+// listenAll runs LISTEN on conn for the channels of l that it does not
+// listen on yet.
+func (l *Listener) listenAll(ctx context.Context, conn *pgconn.PgConn) error {
+	l.mu.Lock()
+	var channels []string
+	for c := range l.handlers {
+		if !l.listening[c] {
+			channels = append(channels, c)
+		}
+	}
+	l.mu.Unlock()
+
+	for _, c := range channels {
+		lctx, cancel := context.WithTimeout(ctx, listenerTimeout)
+		_, err := conn.Exec(lctx, "LISTEN "+pgx.Identifier{c}.Sanitize()).ReadAll()
+		cancel()
+		if err != nil {
+			return fmt.Errorf("LISTEN %s: %v", c, err)
+		}
+		l.setListening(c, true)
+	}
+	return nil
+}
+
+// setListening records whether the connection listens on channel, or, if
+// channel is empty, that it listens on none.
+func (l *Listener) setListening(channel string, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if channel == "" {
+		l.listening = make(map[string]bool)
+	} else {
+		l.listening[channel] = ok
+	}
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// reconnected calls the OnReconnect handlers.
+func (l *Listener) reconnected() {
+	l.mu.Lock()
+	handlers := l.onReconnect
+	l.mu.Unlock()
+	for _, f := range handlers {
+		f()
+	}
+}
+
+var listenerJitter = struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}{r: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// listenerBackoff returns the delay before the given attempt to reconnect,
+// counting from 1. It doubles from listenerMinBackoff up to
+// listenerMaxBackoff, and up to half of it is taken off at random, so that
+// servers that lost the database together do not reconnect in lockstep.
+func listenerBackoff(attempt int) time.Duration {
+	d := listenerMinBackoff
+	for k := 1; k < attempt && d < listenerMaxBackoff; k++ {
+		d *= 2
+	}
+	if d > listenerMaxBackoff {
+		d = listenerMaxBackoff
+	}
+	listenerJitter.mu.Lock()
+	defer listenerJitter.mu.Unlock()
+	return d - time.Duration(listenerJitter.r.Int63n(int64(d/2)+1))
+}
+
+// TaskChangeOp says how a TaskChange changed a task.
+type TaskChangeOp string
+
+const (
+	TaskInserted TaskChangeOp = "insert"
+	// TaskUpdated is also the operation of tasks moved to and out of the
+	// trash, whose DeletedAt changes.
+	TaskUpdated TaskChangeOp = "update"
+	// TaskDeleted is the operation of tasks purged from the database.
+	TaskDeleted TaskChangeOp = "delete"
+)
+
+// TaskChange is a change to the tasks table, as published on
+// TaskChangesChannel when the transaction that made it commits.
+type TaskChange struct {
+	Op TaskChangeOp `json:"op"`
+	// Task is the task after the change, or before it for TaskDeleted.
+	Task task.Task `json:"task"`
+}
+
+// ListenTaskChanges calls f with the changes made to tasks by every client
+// of the database, this process included. Notifications that cannot be
+// decoded are logged and dropped. See Listen.
+func (l *Listener) ListenTaskChanges(ctx context.Context, f func(TaskChange)) error {
+	return l.Listen(ctx, TaskChangesChannel, func(payload string) {
+		c, err := parseTaskChange(payload)
+		if err != nil {
+			log.Logger.Errorf("postgres listener: %v", err)
+			return
+		}
+		f(c)
+	})
+}
+
+// parseTaskChange decodes the payload of a notification sent on
+// TaskChangesChannel.
+func parseTaskChange(payload string) (TaskChange, error) {
+	var c TaskChange
+	if err := json.Unmarshal([]byte(payload), &c); err != nil {
+		return TaskChange{}, fmt.Errorf("decoding task change %q: %v", payload, err)
+	}
+	switch c.Op {
+	case TaskInserted, TaskUpdated, TaskDeleted:
+	default:
+		return TaskChange{}, fmt.Errorf("task change %q has unknown operation %q", payload, c.Op)
+	}
+	return c, nil
+}
@@ -0,0 +1,106 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/urvil38/todo-app/internal/database"
+	"github.com/urvil38/todo-app/internal/task"
+)
+
+func TestParseTaskChange(t *testing.T) {
+	c, err := parseTaskChange(`{"op" : "update", "task" : {"id":"01G7","name":"a","created_at":"2022-07-01T12:00:00.123456+00:00","updated_at":"2022-07-02T12:00:00+00:00","deleted_at":null,"legacy_id":"7"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Op != TaskUpdated || c.Task.Id != "01G7" || c.Task.Name != "a" || c.Task.LegacyId != "7" || c.Task.DeletedAt != nil {
+		t.Errorf("parseTaskChange() = %+v", c)
+	}
+	if want := time.Date(2022, 7, 1, 12, 0, 0, 123456000, time.UTC); !c.Task.CreatedAt.Equal(want) {
+		t.Errorf("CreatedAt = %v, want %v", c.Task.CreatedAt, want)
+	}
+
+	for _, payload := range []string{`{"op":"truncate","task":{}}`, `not json`} {
+		if _, err := parseTaskChange(payload); err == nil {
+			t.Errorf("parseTaskChange(%q) succeeded, want error", payload)
+		}
+	}
+}
+
+func TestListenerBackoff(t *testing.T) {
+	for attempt := 1; attempt < 20; attempt++ {
+		max := listenerMinBackoff << (attempt - 1)
+		if max > listenerMaxBackoff || max <= 0 {
+			max = listenerMaxBackoff
+		}
+		if d := listenerBackoff(attempt); d < max/2 || d > max {
+			t.Errorf("listenerBackoff(%d) = %s, want between %s and %s", attempt, d, max/2, max)
+		}
+	}
+}
+
+func TestListenerTaskChanges(t *testing.T) {
+	if testDB == nil {
+		t.Skip("no database")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := database.ResetDB(ctx, testDB); err != nil {
+		t.Fatal(err)
+	}
+	l, err := NewListener(database.DBConnURI(testDBName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	changes := make(chan TaskChange, 10)
+	if err := l.ListenTaskChanges(ctx, func(c TaskChange) { changes <- c }); err != nil {
+		t.Fatal(err)
+	}
+	reconnected := make(chan struct{}, 1)
+	l.OnReconnect(func() { reconnected <- struct{}{} })
+
+	next := func() TaskChange {
+		t.Helper()
+		select {
+		case c := <-changes:
+			return c
+		case <-ctx.Done():
+			t.Fatal("no task change received")
+			return TaskChange{}
+		}
+	}
+
+	tm := &TaskManager{db: New(testDB), ids: task.NewIDGenerator(task.IDSchemeULID)}
+	a, err := tm.CreateTask(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := next(); c.Op != TaskInserted || c.Task.Id != a.Id || c.Task.Name != "a" {
+		t.Errorf("after CreateTask, got %+v", c)
+	}
+	if err := tm.DeleteTask(ctx, a.Id); err != nil {
+		t.Fatal(err)
+	}
+	if c := next(); c.Op != TaskUpdated || c.Task.Id != a.Id || c.Task.DeletedAt == nil {
+		t.Errorf("after DeleteTask, got %+v", c)
+	}
+
+	// Losing the connection makes the listener reconnect and listen again.
+	if _, err := testDB.Exec(ctx, "SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE query LIKE 'LISTEN %' AND pid <> pg_backend_pid()"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-reconnected:
+	case <-ctx.Done():
+		t.Fatal("listener did not reconnect")
+	}
+
+	if err := tm.PurgeTask(ctx, a.Id); err != nil {
+		t.Fatal(err)
+	}
+	if c := next(); c.Op != TaskDeleted || c.Task.Id != a.Id {
+		t.Errorf("after PurgeTask, got %+v", c)
+	}
+}
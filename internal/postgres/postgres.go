@@ -2,15 +2,28 @@ package postgres
 
 import (
 	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"contrib.go.opencensus.io/integrations/ocsql"
 	_ "github.com/jackc/pgx/v4/stdlib"
 	"github.com/urvil38/todo-app/internal/config"
 	"github.com/urvil38/todo-app/internal/database"
 	"github.com/urvil38/todo-app/internal/log"
+	"github.com/urvil38/todo-app/internal/task"
+	"go.opencensus.io/trace"
 )
 
+// replicaCheckInterval is how often the health of read replicas is checked.
+const replicaCheckInterval = 10 * time.Second
+
 func OpenDB(ctx context.Context, cfg *config.Config) (_ *DB, err error) {
 
 	// Wrap the postgres driver with our own wrapper, which adds OpenCensus instrumentation.
@@ -30,27 +43,189 @@ func OpenDB(ctx context.Context, cfg *config.Config) (_ *DB, err error) {
 	if err != nil {
 		return nil, err
 	}
+	pool := database.PoolConfig{
+		MaxOpenConns:    cfg.DBMaxOpenConns,
+		MaxIdleConns:    cfg.DBMaxIdleConns,
+		ConnMaxLifetime: cfg.DBConnMaxLifetime,
+		ConnMaxIdleTime: cfg.DBConnMaxIdleTime,
+	}
+	ddb.ConfigurePool(pool)
+	ddb.SetRetryPolicy(database.RetryPolicy{
+		MaxAttempts: cfg.DBRetryMaxAttempts,
+		BaseDelay:   cfg.DBRetryBaseDelay,
+		MaxDelay:    cfg.DBRetryMaxDelay,
+		Jitter:      true,
+	})
+	if cfg.AutoMigrate {
+		err = database.Migrate(ctx, ddb)
+	} else {
+		err = database.CheckSchemaVersion(ctx, ddb)
+	}
+	if err != nil {
+		ddb.Close()
+		return nil, err
+	}
+	database.RegisterPool("primary", ddb)
+	db := New(ddb)
+	for _, host := range cfg.DBReadHosts {
+		// Replicas are not pinged here: one that is down is skipped until
+		// a health check finds it up.
+		log.Logger.Infof("opening read replica on host %s", host)
+		rdb, err := sql.Open(ocDriver, cfg.DBReadConnInfo(host))
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		r := &replica{host: host, db: database.New(rdb)}
+		r.db.ConfigurePool(pool)
+		database.RegisterPool("replica:"+host, r.db)
+		db.replicas = append(db.replicas, r)
+	}
+	if len(db.replicas) > 0 {
+		db.checkReplicas(ctx)
+		go db.checkReplicasLoop()
+	}
 	log.Logger.Infof("database open finished")
-	return New(ddb), nil
+	return db, nil
 }
 
 type DB struct {
 	db *database.DB
+
+	// replicas serve reads that may lag behind db.
+	replicas []*replica
+	next     uint32 // atomic: round-robin position in replicas
+	done     chan struct{}
+
+	closeOnce sync.Once
+	closeErr  error // the result of the first Close
+}
+
+type replica struct {
+	host    string
+	db      *database.DB
+	healthy int32 // atomic: 1 if the last check or query succeeded
 }
 
 // New returns a new postgres DB.
 func New(db *database.DB) *DB {
 	return &DB{
-		db: db,
+		db:   db,
+		done: make(chan struct{}),
 	}
 }
 
-// Close closes a DB.
+// Close closes a DB. Later calls do nothing and return the same error.
 func (db *DB) Close() error {
-	return db.db.Close()
+	db.closeOnce.Do(func() {
+		close(db.done)
+		var errs database.MultiErr
+		for _, r := range db.replicas {
+			if err := r.db.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if err := db.db.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		if len(errs) > 0 {
+			db.closeErr = errs
+		}
+	})
+	return db.closeErr
 }
 
 // Underlying returns the *database.DB inside db.
 func (db *DB) Underlying() *database.DB {
 	return db.db
 }
+
+func (db *DB) checkReplicasLoop() {
+	ticker := time.NewTicker(replicaCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-db.done:
+			return
+		case <-ticker.C:
+			db.checkReplicas(context.Background())
+		}
+	}
+}
+
+func (db *DB) checkReplicas(ctx context.Context) {
+	for _, r := range db.replicas {
+		ctx, cancel := context.WithTimeout(ctx, replicaCheckInterval/2)
+		var one int
+		err := r.db.QueryRow(ctx, "SELECT 1").Scan(&one)
+		cancel()
+		r.setHealthy(err)
+	}
+}
+
+// setHealthy records the outcome of the last use of r, logging changes.
+func (r *replica) setHealthy(err error) {
+	if err == nil {
+		if atomic.SwapInt32(&r.healthy, 1) == 0 {
+			log.Logger.Infof("read replica %s is healthy", r.host)
+		}
+		return
+	}
+	if atomic.SwapInt32(&r.healthy, 0) == 1 {
+		log.Logger.Warnf("read replica %s is unhealthy, reading from the primary: %v", r.host, err)
+	}
+}
+
+// primary returns the transaction of the unit of work carried by ctx, if
+// any, or else the primary.
+func (db *DB) primary(ctx context.Context) *database.DB {
+	return db.db.ForContext(ctx)
+}
+
+// replica returns the next healthy replica, or nil if reads must go to the
+// primary: there is no healthy replica, the caller asked to see its own
+// writes, or db or ctx is in a transaction.
+func (db *DB) replica(ctx context.Context) *replica {
+	if len(db.replicas) == 0 || task.FreshReadsRequested(ctx) || db.primary(ctx).InTransaction() {
+		return nil
+	}
+	start := atomic.AddUint32(&db.next, 1)
+	for k := range db.replicas {
+		r := db.replicas[(int(start)+k)%len(db.replicas)]
+		if atomic.LoadInt32(&r.healthy) == 1 {
+			return r
+		}
+	}
+	return nil
+}
+
+// read calls f with a replica, if one should be used, or else with the
+// primary. If the replica cannot be reached, it is marked unhealthy and f
+// is called again with the primary, so f must not keep state between calls.
+func (db *DB) read(ctx context.Context, f func(*database.DB) error) error {
+	r := db.replica(ctx)
+	if r == nil {
+		return f(db.primary(ctx))
+	}
+	trace.FromContext(ctx).AddAttributes(trace.StringAttribute("db.replica", r.host))
+	err := f(r.db)
+	if err == nil || !isConnError(ctx, err) {
+		return err
+	}
+	r.setHealthy(err)
+	return f(db.db)
+}
+
+// isConnError reports whether err means the database could not be reached
+// or dropped the connection, as opposed to the query failing or finding
+// nothing. Errors caused by ctx ending are not connection errors.
+func isConnError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &netErr)
+}
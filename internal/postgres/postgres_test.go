@@ -0,0 +1,143 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/urvil38/todo-app/internal/database"
+	"github.com/urvil38/todo-app/internal/task"
+	"github.com/urvil38/todo-app/internal/task/tasktest"
+)
+
+const testDBName = "todo_test"
+
+// testDB is nil when no database is reachable, in which case the tests that
+// need it are skipped.
+var testDB *database.DB
+
+func TestMain(m *testing.M) {
+	if err := database.ConnectAndExecute(database.DBConnURI(""), func(*sql.DB) error { return nil }); err != nil {
+		log.Printf("postgres unreachable, skipping database tests: %v", err)
+		os.Exit(m.Run())
+	}
+	if err := database.CreateDBIfNotExists(testDBName); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := database.TryToMigrate(testDBName); err != nil {
+		log.Fatal(err)
+	}
+	db, err := database.Open("pgx", database.DBConnURI(testDBName))
+	if err != nil {
+		log.Fatal(err)
+	}
+	testDB = db
+	code := m.Run()
+	db.Close()
+	os.Exit(code)
+}
+
+func TestTaskManager(t *testing.T) {
+	tasktest.RunManagerTests(t, func(t *testing.T) task.Manager {
+		if testDB == nil {
+			t.Skip("no database")
+		}
+		if err := database.ResetDB(context.Background(), testDB); err != nil {
+			t.Fatal(err)
+		}
+		return &TaskManager{db: New(testDB), ids: task.NewIDGenerator(task.IDSchemeULID)}
+	})
+}
+
+// TestRunQueryIncrementally runs a query incrementally while processing the
+// rows of another, in the same transaction, which needs distinct cursors.
+func TestRunQueryIncrementally(t *testing.T) {
+	if testDB == nil {
+		t.Skip("no database")
+	}
+	ctx := context.Background()
+	errStop := errors.New("stop")
+	err := testDB.Transact(ctx, sql.LevelDefault, func(tx *database.DB) error {
+		var pairs int
+		err := tx.RunQueryIncrementally(ctx, "SELECT generate_series(1, 3)", 2, func(*sql.Rows) error {
+			return tx.RunQueryIncrementally(ctx, "SELECT generate_series(1, 4)", 3, func(*sql.Rows) error {
+				pairs++
+				return nil
+			})
+		})
+		if err != nil {
+			return err
+		}
+		if pairs != 12 {
+			t.Errorf("processed %d pairs of rows, want 12", pairs)
+		}
+
+		// A query stopped by an error leaves no cursor open behind it.
+		err = tx.RunQueryIncrementally(ctx, "SELECT generate_series(1, 3)", 1, func(*sql.Rows) error {
+			return errStop
+		})
+		if !errors.Is(err, errStop) {
+			t.Errorf("got %v, want the error of the processing function", err)
+		}
+		var open int
+		if err := tx.QueryRow(ctx, "SELECT count(*) FROM pg_cursors").Scan(&open); err != nil {
+			return err
+		}
+		if open != 0 {
+			t.Errorf("%d cursors are still open", open)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIsConnError(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range []struct {
+		err  error
+		want bool
+	}{
+		{driver.ErrBadConn, true},
+		{fmt.Errorf("read: %w", io.EOF), true},
+		{io.ErrUnexpectedEOF, true},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, true},
+		{sql.ErrNoRows, false},
+		{&pgconn.PgError{Code: "23505"}, false},
+		{errors.New("scan: converting NULL to string is unsupported"), false},
+	} {
+		if got := isConnError(ctx, test.err); got != test.want {
+			t.Errorf("isConnError(%v) = %t, want %t", test.err, got, test.want)
+		}
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if isConnError(canceled, driver.ErrBadConn) {
+		t.Error("isConnError with a canceled context = true, want false")
+	}
+}
+
+func TestCloseTwice(t *testing.T) {
+	sdb, err := sql.Open("pgx", "postgres://localhost/unused")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := New(database.New(sdb))
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Errorf("second Close() = %v, want nil", err)
+	}
+}
@@ -0,0 +1,80 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/urvil38/todo-app/internal/database"
+	"github.com/urvil38/todo-app/internal/log"
+	"github.com/urvil38/todo-app/internal/ratelimit"
+)
+
+// rateLimitPruneAge is how long a bucket must be unused before it is deleted.
+const rateLimitPruneAge = time.Hour
+
+// RateLimitStore keeps rate limit buckets in the rate_limits table, so that
+// all server replicas share the same limits. Time is taken from the
+// database to avoid clock skew between replicas.
+type RateLimitStore struct {
+	db        *DB
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+// NewRateLimitStore returns a RateLimitStore using db.
+func NewRateLimitStore(db *DB) *RateLimitStore {
+	return &RateLimitStore{db: db}
+}
+
+func (s *RateLimitStore) Take(ctx context.Context, key string, l ratelimit.Limit) (res ratelimit.Result, err error) {
+	s.maybePrune(ctx)
+
+	err = s.db.db.Transact(ctx, sql.LevelDefault, func(tx *database.DB) error {
+		// Make sure the row exists so that it can be locked.
+		_, err := tx.Exec(ctx, `
+		INSERT INTO rate_limits(key, tokens, updated_at)
+		VALUES ($1, $2, CURRENT_TIMESTAMP)
+		ON CONFLICT DO NOTHING`, key, float64(l.Requests))
+		if err != nil {
+			return err
+		}
+
+		var (
+			b   ratelimit.Bucket
+			now time.Time
+		)
+		err = tx.QueryRow(ctx, `
+		SELECT tokens, updated_at, CURRENT_TIMESTAMP
+		FROM rate_limits
+		WHERE key = $1
+		FOR UPDATE`, key).Scan(&b.Tokens, &b.Last, &now)
+		if err != nil {
+			return err
+		}
+
+		res = b.Take(l, now)
+		_, err = tx.Exec(ctx, "UPDATE rate_limits SET tokens = $2, updated_at = $3 WHERE key = $1", key, b.Tokens, b.Last)
+		return err
+	})
+	return res, err
+}
+
+// maybePrune deletes buckets that have not been used for rateLimitPruneAge,
+// at most once per rateLimitPruneAge.
+func (s *RateLimitStore) maybePrune(ctx context.Context) {
+	s.mu.Lock()
+	if time.Since(s.lastPrune) < rateLimitPruneAge {
+		s.mu.Unlock()
+		return
+	}
+	s.lastPrune = time.Now()
+	s.mu.Unlock()
+
+	_, err := s.db.db.Exec(ctx, "DELETE FROM rate_limits WHERE updated_at < CURRENT_TIMESTAMP - make_interval(secs => $1)",
+		rateLimitPruneAge.Seconds())
+	if err != nil {
+		log.Logger.Error("RateLimitStore: unable to prune buckets: ", err)
+	}
+}
@@ -0,0 +1,101 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/urvil38/todo-app/internal/database"
+	"github.com/urvil38/todo-app/internal/task"
+	"go.opencensus.io/trace"
+)
+
+func (tm *TaskManager) ListTrash(ctx context.Context) ([]task.Task, error) {
+	ctx, span := trace.StartSpan(ctx, "db.ListTrash")
+	defer span.End()
+
+	return database.QueryAll[task.Task](ctx, tm.db.primary(ctx), "SELECT "+taskColumns+" FROM tasks WHERE deleted_at IS NOT NULL ORDER BY deleted_at")
+}
+
+func (tm *TaskManager) RestoreTask(ctx context.Context, id string) (task.Task, error) {
+	ctx, span := trace.StartSpan(ctx, "db.RestoreTask")
+	defer span.End()
+
+	taskArgs := database.StructScanner(task.Task{})
+	var before, t task.Task
+
+	err := tm.db.primary(ctx).Transact(ctx, sql.LevelDefault, func(tx *database.DB) error {
+		err := tx.QueryRow(ctx, "SELECT "+taskColumns+" FROM tasks WHERE "+matchID+" AND deleted_at IS NOT NULL FOR UPDATE", id).Scan(taskArgs(&before)...)
+		if err != nil {
+			return err
+		}
+		err = tx.QueryRow(ctx, "UPDATE tasks SET deleted_at = NULL WHERE id = $1 RETURNING "+taskColumns, before.Id).Scan(taskArgs(&t)...)
+		if err != nil {
+			return err
+		}
+		return insertAuditEvent(ctx, tx, task.ActionRestore, t.Id, &before, &t)
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return t, task.ErrTaskNotFound
+		}
+		return t, err
+	}
+	return t, nil
+}
+
+func (tm *TaskManager) PurgeTask(ctx context.Context, id string) error {
+	ctx, span := trace.StartSpan(ctx, "db.PurgeTask")
+	defer span.End()
+
+	taskArgs := database.StructScanner(task.Task{})
+	var t task.Task
+
+	err := tm.db.primary(ctx).Transact(ctx, sql.LevelDefault, func(tx *database.DB) error {
+		err := tx.QueryRow(ctx, "DELETE FROM tasks WHERE "+matchID+" RETURNING "+taskColumns, id).Scan(taskArgs(&t)...)
+		if err != nil {
+			return err
+		}
+		return insertAuditEvent(ctx, tx, task.ActionPurge, t.Id, &t, nil)
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return task.ErrTaskNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (tm *TaskManager) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	ctx, span := trace.StartSpan(ctx, "db.PurgeTrash")
+	defer span.End()
+
+	var n int
+
+	err := tm.db.primary(ctx).Transact(ctx, sql.LevelDefault, func(tx *database.DB) error {
+		n = 0
+		purged, err := database.QueryAll[task.Task](ctx, tx, "DELETE FROM tasks WHERE deleted_at < $1 RETURNING "+taskColumns, before)
+		if err != nil {
+			return err
+		}
+		// RETURNING follows no order, so record the purges in the order the
+		// tasks were deleted.
+		sort.SliceStable(purged, func(a, b int) bool {
+			return purged[a].DeletedAt.Before(*purged[b].DeletedAt)
+		})
+		for k := range purged {
+			if err := insertAuditEvent(ctx, tx, task.ActionPurge, purged[k].Id, &purged[k], nil); err != nil {
+				return err
+			}
+		}
+		n = len(purged)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
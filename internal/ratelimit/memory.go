@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// pruneInterval is how often a MemoryStore drops buckets that have refilled
+// completely, since they are indistinguishable from new ones.
+const pruneInterval = time.Minute
+
+type memoryEntry struct {
+	bucket Bucket
+	limit  Limit
+}
+
+// MemoryStore keeps buckets in process memory. It is only suitable when a
+// single server instance is running.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryEntry
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*memoryEntry),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, l Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastPrune) > pruneInterval {
+		s.prune(now)
+	}
+
+	e, ok := s.buckets[key]
+	if !ok {
+		e = &memoryEntry{bucket: NewBucket(l, now)}
+		s.buckets[key] = e
+	}
+	e.limit = l
+	return e.bucket.Take(l, now), nil
+}
+
+// prune drops full buckets. s.mu must be held.
+func (s *MemoryStore) prune(now time.Time) {
+	for k, e := range s.buckets {
+		if e.bucket.Full(e.limit, now) {
+			delete(s.buckets, k)
+		}
+	}
+	s.lastPrune = now
+}
@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	now := time.Date(2022, 7, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	l := Limit{Requests: 2, Period: time.Minute}
+
+	for _, test := range []struct {
+		key     string
+		advance time.Duration
+		allowed bool
+	}{
+		{"a", 0, true},
+		{"a", 0, true},
+		{"a", 0, false},
+		// Keys have buckets of their own.
+		{"b", 0, true},
+		// A token is added every 30 seconds.
+		{"a", 29 * time.Second, false},
+		{"a", time.Second, true},
+		{"a", 0, false},
+	} {
+		now = now.Add(test.advance)
+		res, err := s.Take(ctx, test.key, l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Allowed != test.allowed {
+			t.Errorf("Take(%q) at %s = %+v, want allowed: %t", test.key, now.Format(time.Kitchen), res, test.allowed)
+		}
+	}
+}
+
+func TestMemoryStorePrune(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	now := time.Date(2022, 7, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	s.Take(ctx, "short", Limit{Requests: 1, Period: time.Second})
+	s.Take(ctx, "long", Limit{Requests: 1, Period: time.Hour})
+	if n := len(s.buckets); n != 2 {
+		t.Fatalf("%d buckets, want 2", n)
+	}
+
+	// Full buckets are dropped at most once per pruneInterval.
+	now = now.Add(pruneInterval / 2)
+	s.Take(ctx, "other", Limit{Requests: 1, Period: time.Hour})
+	if _, ok := s.buckets["short"]; !ok {
+		t.Error("bucket pruned before pruneInterval elapsed")
+	}
+	now = now.Add(pruneInterval)
+	s.Take(ctx, "other", Limit{Requests: 1, Period: time.Hour})
+	if _, ok := s.buckets["short"]; ok {
+		t.Error("full bucket not pruned")
+	}
+	if _, ok := s.buckets["long"]; !ok {
+		t.Error("bucket that is not full pruned")
+	}
+}
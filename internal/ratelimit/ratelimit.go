@@ -0,0 +1,88 @@
+// Package ratelimit implements token bucket rate limiting with pluggable
+// storage for the buckets.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit allows Requests requests per Period, with bursts of up to Requests.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// Enabled reports whether l imposes any limit.
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Period > 0
+}
+
+// rate returns the number of tokens added to a bucket per second.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// Result is the outcome of taking a token from a bucket.
+type Result struct {
+	Allowed bool
+	// Limit is the capacity of the bucket.
+	Limit int
+	// Remaining is the number of whole tokens left in the bucket.
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until a token becomes available. It is zero
+	// if the request was allowed.
+	RetryAfter time.Duration
+}
+
+// Store holds token buckets by key.
+type Store interface {
+	// Take removes a token from the bucket identified by key, creating a
+	// full bucket if none exists.
+	Take(ctx context.Context, key string, l Limit) (Result, error)
+}
+
+// Bucket is the state of a single token bucket. It is exported so that
+// stores can persist it.
+type Bucket struct {
+	Tokens float64
+	Last   time.Time
+}
+
+// NewBucket returns a full bucket for l.
+func NewBucket(l Limit, now time.Time) Bucket {
+	return Bucket{Tokens: float64(l.Requests), Last: now}
+}
+
+// Take refills the bucket for the time elapsed since it was last used and
+// removes a token if one is available.
+func (b *Bucket) Take(l Limit, now time.Time) Result {
+	capacity := float64(l.Requests)
+	if elapsed := now.Sub(b.Last); elapsed > 0 {
+		b.Tokens = math.Min(capacity, b.Tokens+elapsed.Seconds()*l.rate())
+	}
+	b.Last = now
+
+	res := Result{Limit: l.Requests}
+	if b.Tokens >= 1 {
+		b.Tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.Tokens) / l.rate())
+	}
+	res.Remaining = int(b.Tokens)
+	res.Reset = seconds((capacity - b.Tokens) / l.rate())
+	return res
+}
+
+// Full reports whether the bucket would be full at the given time.
+func (b *Bucket) Full(l Limit, now time.Time) bool {
+	return b.Tokens+now.Sub(b.Last).Seconds()*l.rate() >= float64(l.Requests)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketTake(t *testing.T) {
+	// One token per second, up to 10.
+	l := Limit{Requests: 10, Period: 10 * time.Second}
+	start := time.Date(2022, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, test := range []struct {
+		name    string
+		tokens  float64
+		elapsed time.Duration
+		want    Result
+		// wantTokens is what the bucket holds afterwards.
+		wantTokens float64
+	}{
+		{
+			name:       "full",
+			tokens:     10,
+			want:       Result{Allowed: true, Limit: 10, Remaining: 9, Reset: time.Second},
+			wantTokens: 9,
+		},
+		{
+			name:       "last token",
+			tokens:     1,
+			want:       Result{Allowed: true, Limit: 10, Remaining: 0, Reset: 10 * time.Second},
+			wantTokens: 0,
+		},
+		{
+			name:       "empty",
+			tokens:     0,
+			want:       Result{Limit: 10, Remaining: 0, Reset: 10 * time.Second, RetryAfter: time.Second},
+			wantTokens: 0,
+		},
+		{
+			name:       "partial token",
+			tokens:     0.25,
+			want:       Result{Limit: 10, Remaining: 0, Reset: 9750 * time.Millisecond, RetryAfter: 750 * time.Millisecond},
+			wantTokens: 0.25,
+		},
+		{
+			name:       "refilled",
+			tokens:     0,
+			elapsed:    2500 * time.Millisecond,
+			want:       Result{Allowed: true, Limit: 10, Remaining: 1, Reset: 8500 * time.Millisecond},
+			wantTokens: 1.5,
+		},
+		{
+			name:       "refill capped at capacity",
+			tokens:     5,
+			elapsed:    time.Hour,
+			want:       Result{Allowed: true, Limit: 10, Remaining: 9, Reset: time.Second},
+			wantTokens: 9,
+		},
+		{
+			name:       "clock going back",
+			tokens:     3,
+			elapsed:    -time.Minute,
+			want:       Result{Allowed: true, Limit: 10, Remaining: 2, Reset: 8 * time.Second},
+			wantTokens: 2,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			b := Bucket{Tokens: test.tokens, Last: start}
+			now := start.Add(test.elapsed)
+			if got := b.Take(l, now); got != test.want {
+				t.Errorf("Take() = %+v, want %+v", got, test.want)
+			}
+			if b.Tokens != test.wantTokens || !b.Last.Equal(now) {
+				t.Errorf("after Take(), bucket = %+v, want %v tokens at %v", b, test.wantTokens, now)
+			}
+		})
+	}
+}
+
+func TestBucketFull(t *testing.T) {
+	l := Limit{Requests: 10, Period: 10 * time.Second}
+	start := time.Date(2022, 7, 1, 12, 0, 0, 0, time.UTC)
+	b := Bucket{Tokens: 7, Last: start}
+	for _, test := range []struct {
+		elapsed time.Duration
+		want    bool
+	}{
+		{0, false},
+		{2 * time.Second, false},
+		{3 * time.Second, true},
+		{time.Hour, true},
+	} {
+		if got := b.Full(l, start.Add(test.elapsed)); got != test.want {
+			t.Errorf("Full() after %s = %t, want %t", test.elapsed, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/urvil38/todo-app/internal/backup"
+)
+
+// backupHandler streams an archive of all task data. Errors after the first
+// row can only be logged; the archive then lacks its manifest, which
+// restores detect.
+func (s *Server) backupHandler(w http.ResponseWriter, r *http.Request) {
+	exp, ok := s.storageManager().(backup.Exporter)
+	if !ok {
+		http.Error(w, fmt.Sprintf("backups are not supported by the %s storage", s.storage), http.StatusNotImplemented)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="todo-backup-%s.jsonl"`, time.Now().UTC().Format("20060102T150405Z")))
+	bw, err := backup.NewWriter(w, s.storage)
+	if err == nil {
+		err = exp.ExportBackup(r.Context(), bw)
+	}
+	if err == nil {
+		err = bw.Close()
+	}
+	if err != nil {
+		s.logger.Error("backupHandler: unable to write backup: ", err)
+	}
+}
+
+// maxRestoreSize is the size of the largest archive that restoreHandler
+// accepts. Larger ones can be restored with the db devtool.
+const maxRestoreSize = 256 << 20
+
+// restoreHandler restores the archive in the request body. The conflict
+// query parameter is the backup.ConflictPolicy, fail by default.
+func (s *Server) restoreHandler(w http.ResponseWriter, r *http.Request) {
+	imp, ok := s.storageManager().(backup.Importer)
+	if !ok {
+		http.Error(w, fmt.Sprintf("restores are not supported by the %s storage", s.storage), http.StatusNotImplemented)
+		return
+	}
+
+	policy := backup.ConflictFail
+	if v := r.URL.Query().Get("conflict"); v != "" {
+		var err error
+		if policy, err = backup.ParseConflictPolicy(v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	res, err := imp.ImportBackup(r.Context(), http.MaxBytesReader(w, r.Body, maxRestoreSize), policy)
+	if s.taskCache != nil {
+		s.taskCache.Purge()
+	}
+	if err != nil {
+		switch {
+		case isBodyTooLarge(err):
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		case errors.Is(err, backup.ErrCorrupt), errors.Is(err, backup.ErrTruncated):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, backup.ErrConflict):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			s.logger.Error("restoreHandler: unable to restore backup: ", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		s.logger.Error("restoreHandler: json encoding err: ", err)
+	}
+}
+
+// isBodyTooLarge reports whether err comes from reading past the limit of an
+// http.MaxBytesReader, which only has a dedicated error type from Go 1.19.
+func isBodyTooLarge(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "http: request body too large")
+}
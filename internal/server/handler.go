@@ -3,7 +3,10 @@ package server
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	taskpkg "github.com/urvil38/todo-app/internal/task"
@@ -25,8 +28,12 @@ func (s *Server) createTaskHandler(w http.ResponseWriter, r *http.Request) {
 
 	task, err := s.taskManager.CreateTask(r.Context(), p.Name)
 	if err != nil {
-		s.logger.Error("createTaskHandler: unable to create task: ", err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		if errors.Is(err, taskpkg.ErrNameTooLong) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			s.logger.Error("createTaskHandler: unable to create task: ", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -97,6 +104,8 @@ func (s *Server) updateTaskHandler(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		if errors.Is(err, taskpkg.ErrTaskNotFound) {
 			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		} else if errors.Is(err, taskpkg.ErrNameTooLong) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 		} else {
 			s.logger.Error("updateTaskHandler: unable to update task: ", err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -116,7 +125,12 @@ func (s *Server) updateTaskHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) deleteTaskHandler(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
-	err := s.taskManager.DeleteTask(r.Context(), id)
+	var err error
+	if r.URL.Query().Get("permanent") == "true" {
+		err = s.taskManager.PurgeTask(r.Context(), id)
+	} else {
+		err = s.taskManager.DeleteTask(r.Context(), id)
+	}
 	if err != nil {
 		if errors.Is(err, taskpkg.ErrTaskNotFound) {
 			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
@@ -129,3 +143,117 @@ func (s *Server) deleteTaskHandler(w http.ResponseWriter, r *http.Request) {
 
 	s.logger.Infof("task deleted with id: %v", id)
 }
+
+func (s *Server) listTrashHandler(w http.ResponseWriter, r *http.Request) {
+
+	tasks, err := s.taskManager.ListTrash(r.Context())
+	if err != nil {
+		s.logger.Error("listTrashHandler: unable to list trash: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	encoder := json.NewEncoder(w)
+
+	err = encoder.Encode(tasks)
+	if err != nil {
+		s.logger.Error("listTrashHandler: json encoding err: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) restoreTaskHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	task, err := s.taskManager.RestoreTask(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, taskpkg.ErrTaskNotFound) {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		} else {
+			s.logger.Error("restoreTaskHandler: unable to restore task: ", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.logger.Infof("task restored with id: %v", task.Id)
+	encoder := json.NewEncoder(w)
+	err = encoder.Encode(task)
+	if err != nil {
+		s.logger.Error("restoreTaskHandler: json encoding err: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) taskHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	events, err := s.auditLog.TaskHistory(r.Context(), id)
+	if err != nil {
+		s.logger.Error("taskHistoryHandler: unable to get task history: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if len(events) == 0 {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	encoder := json.NewEncoder(w)
+
+	err = encoder.Encode(events)
+	if err != nil {
+		s.logger.Error("taskHistoryHandler: json encoding err: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) listAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	f, err := parseAuditFilter(r)
+	if err != nil {
+		s.logger.Error("listAuditEventsHandler: invalid query: ", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	events, err := s.auditLog.ListAuditEvents(r.Context(), f)
+	if err != nil {
+		s.logger.Error("listAuditEventsHandler: unable to list audit events: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	encoder := json.NewEncoder(w)
+
+	err = encoder.Encode(events)
+	if err != nil {
+		s.logger.Error("listAuditEventsHandler: json encoding err: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+}
+
+// parseAuditFilter reads the task_id, since, until and limit query
+// parameters. Times must be in RFC 3339 format.
+func parseAuditFilter(r *http.Request) (f taskpkg.AuditFilter, err error) {
+	q := r.URL.Query()
+	f.TaskId = q.Get("task_id")
+	if v := q.Get("since"); v != "" {
+		if f.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, fmt.Errorf("since: %v", err)
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		if f.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, fmt.Errorf("until: %v", err)
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit < 0 {
+			return f, fmt.Errorf("limit: invalid value %q", v)
+		}
+	}
+	return f, nil
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	chi_middleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/sirupsen/logrus"
+	"github.com/urvil38/todo-app/internal/memory"
+	"github.com/urvil38/todo-app/internal/middleware"
+	"github.com/urvil38/todo-app/internal/task"
+)
+
+// newTestServer returns the handler of a server storing tasks in memory.
+func newTestServer(t *testing.T, adminToken string) http.Handler {
+	t.Helper()
+	tm, err := memory.NewTaskManager(memory.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lg := logrus.New()
+	lg.SetOutput(io.Discard)
+	s := &Server{logger: lg, adminToken: adminToken, taskManager: tm, auditLog: tm}
+	router := chi.NewRouter()
+	s.Install(func(method, pattern string, h http.Handler) { router.Method(method, pattern, h) })
+	return middleware.Chain(chi_middleware.RequestID, middleware.Actor())(router)
+}
+
+// do sends a request to h and checks the status of the response, whose body
+// it decodes into v, if not nil.
+func do(t *testing.T, h http.Handler, method, target, body string, header http.Header, wantCode int, v interface{}) {
+	t.Helper()
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("User-Agent", "handler-test")
+	for k, vs := range header {
+		r.Header[k] = vs
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != wantCode {
+		t.Fatalf("%s %s: status = %d, want %d", method, target, rec.Code, wantCode)
+	}
+	if v != nil {
+		if err := json.NewDecoder(rec.Body).Decode(v); err != nil {
+			t.Fatalf("%s %s: decoding response: %v", method, target, err)
+		}
+	}
+}
+
+func TestAuditEvents(t *testing.T) {
+	h := newTestServer(t, "s3cret")
+	admin := http.Header{"Authorization": {"Bearer s3cret"}}
+
+	do(t, h, http.MethodPost, "/v1/task", `{"name":"a"}`, nil, http.StatusCreated, nil)
+	do(t, h, http.MethodPost, "/v1/task", `{"name":"other"}`, nil, http.StatusCreated, nil)
+	var tasks []task.Task
+	do(t, h, http.MethodGet, "/v1/tasks", "", nil, http.StatusOK, &tasks)
+	if len(tasks) != 2 {
+		t.Fatalf("got %d tasks, want 2", len(tasks))
+	}
+	id := tasks[0].Id
+	do(t, h, http.MethodPost, "/v1/task/"+id, `{"name":"b"}`, nil, http.StatusOK, nil)
+	do(t, h, http.MethodDelete, "/v1/task/"+id, "", nil, http.StatusOK, nil)
+
+	var events []task.AuditEvent
+	do(t, h, http.MethodGet, "/v1/admin/audit?task_id="+id, "", admin, http.StatusOK, &events)
+	want := []struct {
+		action        task.Action
+		before, after string
+	}{
+		{task.ActionCreate, "", "a"},
+		{task.ActionUpdate, "a", "b"},
+		{task.ActionDelete, "b", "b"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d audit events, want %d: %+v", len(events), len(want), events)
+	}
+	for k, e := range events {
+		name := func(t *task.Task) string {
+			if t == nil {
+				return ""
+			}
+			return t.Name
+		}
+		if e.TaskId != id || e.Action != want[k].action || name(e.Before) != want[k].before || name(e.After) != want[k].after {
+			t.Errorf("event %d = %s of %s from %q to %q, want %s of %s from %q to %q", k,
+				e.Action, e.TaskId, name(e.Before), name(e.After), want[k].action, id, want[k].before, want[k].after)
+		}
+		if e.Actor.RequestID == "" || e.Actor.RemoteAddr == "" || e.Actor.UserAgent != "handler-test" {
+			t.Errorf("event %d has actor %+v, want the request ID, address and user agent of the request", k, e.Actor)
+		}
+	}
+	if deleted := events[2].After; deleted == nil || deleted.DeletedAt == nil {
+		t.Errorf("delete event has after %+v, want a task in the trash", deleted)
+	}
+
+	// The history of the task has the same events.
+	var history []task.AuditEvent
+	do(t, h, http.MethodGet, "/v1/task/"+id+"/history", "", nil, http.StatusOK, &history)
+	if len(history) != len(events) {
+		t.Errorf("got %d events in the history, want %d", len(history), len(events))
+	}
+
+	do(t, h, http.MethodGet, "/v1/admin/audit", "", admin, http.StatusOK, &events)
+	if len(events) != 4 {
+		t.Errorf("got %d audit events of every task, want 4", len(events))
+	}
+	do(t, h, http.MethodGet, "/v1/admin/audit?limit=1", "", admin, http.StatusOK, &events)
+	if len(events) != 1 || events[0].Action != task.ActionCreate {
+		t.Errorf("with limit=1, got %+v, want the first event", events)
+	}
+	do(t, h, http.MethodGet, "/v1/admin/audit?since=yesterday", "", admin, http.StatusBadRequest, nil)
+}
+
+func TestAuditEndpointAuth(t *testing.T) {
+	h := newTestServer(t, "s3cret")
+	for _, test := range []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{"no token", nil, http.StatusUnauthorized},
+		{"wrong token", http.Header{"Authorization": {"Bearer guess"}}, http.StatusUnauthorized},
+		{"admin token", http.Header{"Authorization": {"Bearer s3cret"}}, http.StatusOK},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			do(t, h, http.MethodGet, "/v1/admin/audit", "", test.header, test.want, nil)
+		})
+	}
+
+	// Without an admin token, the endpoint is not served.
+	h = newTestServer(t, "")
+	do(t, h, http.MethodGet, "/v1/admin/audit", "", http.Header{"Authorization": {"Bearer "}}, http.StatusNotFound, nil)
+}
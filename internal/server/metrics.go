@@ -1,6 +1,7 @@
 package server
 
 import (
+	"github.com/urvil38/todo-app/internal/middleware"
 	"go.opencensus.io/plugin/ochttp"
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/tag"
@@ -35,10 +36,18 @@ var (
 		Measure:     ochttp.ServerResponseBytes,
 		Aggregation: ochttp.DefaultSizeDistribution,
 	}
+	ServerRateLimitRejectedCount = &view.View{
+		Name:        "todo_app/http/server/rate_limit_rejected_count",
+		Description: "Count of requests rejected by rate limiting by class",
+		TagKeys:     []tag.Key{middleware.RateLimitClass},
+		Measure:     middleware.RateLimitRejected,
+		Aggregation: view.Count(),
+	}
 	ServerViews = []*view.View{
 		ServerRequestCount,
 		ServerResponseCount,
 		ServerLatency,
 		ServerResponseBytes,
+		ServerRateLimitRejectedCount,
 	}
 )
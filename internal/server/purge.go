@@ -0,0 +1,29 @@
+package server
+
+import (
+	"context"
+	"time"
+)
+
+// purgeTrash permanently removes tasks that have been in the trash for longer
+// than retention, checking every interval until ctx is done.
+func (s *Server) purgeTrash(ctx context.Context, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.taskManager.PurgeTrash(ctx, time.Now().Add(-retention))
+			if err != nil {
+				s.logger.Error("purgeTrash: unable to purge trash: ", err)
+				continue
+			}
+			if n > 0 {
+				s.logger.Infof("purged %d task(s) from trash", n)
+			}
+		}
+	}
+}
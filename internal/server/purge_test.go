@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urvil38/todo-app/internal/memory"
+)
+
+func TestPurgeTrash(t *testing.T) {
+	ctx := context.Background()
+	tm, err := memory.NewTaskManager(memory.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lg := logrus.New()
+	lg.SetOutput(io.Discard)
+	s := &Server{logger: lg, taskManager: tm}
+
+	trashed, _ := tm.CreateTask(ctx, "trashed")
+	live, _ := tm.CreateTask(ctx, "live")
+	if err := tm.DeleteTask(ctx, trashed.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	// run purges every millisecond for a while, then stops.
+	run := func(retention time.Duration, until func() bool) {
+		t.Helper()
+		ctx, stop := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			s.purgeTrash(ctx, retention, time.Millisecond)
+			close(done)
+		}()
+		deadline := time.Now().Add(5 * time.Second)
+		for !until() && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		stop()
+		<-done
+	}
+	trashLen := func() int {
+		trash, err := tm.ListTrash(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(trash)
+	}
+
+	// Tasks in the trash for less than the retention are kept.
+	start := time.Now()
+	run(time.Hour, func() bool { return time.Since(start) > 50*time.Millisecond })
+	if n := trashLen(); n != 1 {
+		t.Fatalf("trash holds %d tasks within the retention, want 1", n)
+	}
+
+	run(0, func() bool { return trashLen() == 0 })
+	if n := trashLen(); n != 0 {
+		t.Errorf("trash holds %d tasks past the retention, want none", n)
+	}
+	if _, err := tm.GetTask(ctx, live.Id); err != nil {
+		t.Errorf("GetTask of live task: %v", err)
+	}
+}
@@ -4,46 +4,129 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"contrib.go.opencensus.io/integrations/ocsql"
 	chi_middleware "github.com/go-chi/chi/v5/middleware"
 	"github.com/sirupsen/logrus"
+	"github.com/urvil38/todo-app/internal/bolt"
+	"github.com/urvil38/todo-app/internal/cache"
 	"github.com/urvil38/todo-app/internal/config"
+	"github.com/urvil38/todo-app/internal/database"
 	"github.com/urvil38/todo-app/internal/log"
 	"github.com/urvil38/todo-app/internal/memory"
 	"github.com/urvil38/todo-app/internal/middleware"
 	"github.com/urvil38/todo-app/internal/postgres"
+	"github.com/urvil38/todo-app/internal/ratelimit"
+	"github.com/urvil38/todo-app/internal/sqlite"
 	"github.com/urvil38/todo-app/internal/task"
 	"github.com/urvil38/todo-app/internal/telemetry"
+	"github.com/urvil38/todo-app/internal/tlsconfig"
 )
 
 type Server struct {
-	listenAddr  string
-	server      *http.Server
-	logger      *logrus.Logger
-	taskManager task.Manager
+	listenAddr     string
+	server         *http.Server
+	redirectServer *http.Server
+	logger         *logrus.Logger
+	storage        string
+	adminToken     string // required by the admin endpoints, if set
+	taskManager    task.Manager
+	auditLog       task.AuditLog
+	taskCache      *cache.TaskManager // nil if tasks are not cached
+	taskListener   *postgres.Listener // invalidates taskCache, if set
+	rateLimits     ratelimit.Store
 }
 
 func New(ctx context.Context, cfg config.Config) *Server {
 	s := Server{
 		listenAddr: cfg.Addr + ":" + cfg.Port,
 		logger:     log.Logger,
+		storage:    cfg.Storage,
+		adminToken: cfg.AdminToken,
 	}
 
-	if cfg.UseDB {
-		s.taskManager = postgres.NewTaskManager(ctx, cfg)
-	} else {
-		s.taskManager = memory.NewTaskManager()
+	s.rateLimits = ratelimit.NewMemoryStore()
+	switch cfg.Storage {
+	case "postgres":
+		tm := postgres.NewTaskManager(ctx, cfg)
+		s.taskManager, s.auditLog = tm, tm
+		if cfg.RateLimitStore == "postgres" {
+			s.rateLimits = postgres.NewRateLimitStore(tm.DB())
+		}
+	case "sqlite":
+		tm := sqlite.NewTaskManager(ctx, cfg)
+		s.taskManager, s.auditLog = tm, tm
+	case "bolt":
+		tm := bolt.NewTaskManager(cfg)
+		s.taskManager, s.auditLog = tm, tm
+	default:
+		syncPolicy, err := memory.ParseSyncPolicy(cfg.MemorySync)
+		if err != nil {
+			s.logger.Fatal(err)
+		}
+		tm, err := memory.NewTaskManager(memory.Config{
+			Dir:           cfg.MemoryDataDir,
+			Sync:          syncPolicy,
+			SnapshotEvery: cfg.MemorySnapshotEvery,
+			IDs:           task.NewIDGenerator(task.IDScheme(cfg.IDScheme)),
+		})
+		if err != nil {
+			s.logger.Fatal(err)
+		}
+		s.taskManager, s.auditLog = tm, tm
+	}
+
+	if cfg.TaskCacheSize > 0 {
+		s.taskCache = cache.New(s.taskManager, cache.Config{
+			Size:        cfg.TaskCacheSize,
+			TTL:         cfg.TaskCacheTTL,
+			NegativeTTL: cfg.TaskCacheNegativeTTL,
+		})
+		s.taskManager = s.taskCache
+		if cfg.TaskCacheNotifications {
+			s.listenTaskChanges(ctx, cfg)
+		}
 	}
 
 	return &s
 }
 
+// listenTaskChanges invalidates the tasks of s.taskCache changed by other
+// servers, and empties it when notifications may have been missed.
+func (s *Server) listenTaskChanges(ctx context.Context, cfg config.Config) {
+	l, err := postgres.NewListener(cfg.DBConnInfo())
+	if err != nil {
+		s.logger.Fatal(err)
+	}
+	l.OnReconnect(s.taskCache.Purge)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	err = l.ListenTaskChanges(ctx, func(c postgres.TaskChange) {
+		s.taskCache.Invalidate(c.Task.Id, c.Task.LegacyId)
+	})
+	if err != nil {
+		// The listener keeps trying in the background.
+		s.logger.Warnf("not yet listening for task changes: %v", err)
+	}
+	s.taskListener = l
+}
+
+// storageManager returns the task.Manager of the storage, without the cache.
+func (s *Server) storageManager() task.Manager {
+	if s.taskCache != nil {
+		return s.taskCache.Unwrap()
+	}
+	return s.taskManager
+}
+
 func (s *Server) Run(ctx context.Context, cfg config.Config) {
 
 	signalCh := make(chan os.Signal, 1)
@@ -56,32 +139,91 @@ func (s *Server) Run(ctx context.Context, cfg config.Config) {
 		task.TaskCreatedCountView,
 		task.TaskUpdatedCountView,
 		task.TaskDeletedCountView,
+		task.TaskCacheHitCountView,
+		task.TaskCacheMissCountView,
+		task.TaskCacheEvictionCountView,
 	)
 
 	views = append(views, ocsql.DefaultViews...)
+	views = append(views, database.PoolViews...)
+	views = append(views, database.RetryViews...)
 
 	if err := telemetry.Init(cfg, views...); err != nil {
 		s.logger.Fatal(ctx, err)
 	}
 
+	routeLimits, err := middleware.ParseRouteLimits(cfg.RateLimitRoutes, time.Minute)
+	if err != nil {
+		s.logger.Fatal("unable to parse TODO_RATE_LIMIT_ROUTES: ", err)
+	}
+
+	trustedProxies, err := middleware.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		s.logger.Fatal("unable to parse TODO_TRUSTED_PROXIES: ", err)
+	}
+
 	mw := middleware.Chain(
 		chi_middleware.RequestID,
-		chi_middleware.RealIP,
+		middleware.RealIP(trustedProxies),
+		middleware.Actor(),
+		middleware.ReadYourWrites(cfg.ReadYourWritesWindow),
+		middleware.CORS(middleware.CORSConfig{
+			AllowedOrigins:   cfg.CORSAllowedOrigins,
+			AllowedMethods:   cfg.CORSAllowedMethods,
+			AllowedHeaders:   cfg.CORSAllowedHeaders,
+			ExposedHeaders:   cfg.CORSExposedHeaders,
+			AllowCredentials: cfg.CORSAllowCredentials,
+			MaxAge:           cfg.CORSMaxAge,
+		}),
 		chi_middleware.SetHeader("content-type", "application/json"),
 		middleware.RequestLog(s.logger),
+		middleware.RateLimit(s.rateLimits, middleware.RateLimitConfig{
+			Read:   ratelimit.Limit{Requests: cfg.RateLimitReads, Period: time.Minute},
+			Write:  ratelimit.Limit{Requests: cfg.RateLimitWrites, Period: time.Minute},
+			Routes: routeLimits,
+			Key:    middleware.PrincipalKey(middleware.AdminPrincipal(cfg.AdminToken)),
+		}, s.logger),
 		chi_middleware.Timeout(1*time.Minute),
 		chi_middleware.Recoverer,
 	)
 
+	tlsConfig, err := tlsconfig.Server(ctx, cfg)
+	if err != nil {
+		s.logger.Fatal(ctx, err)
+	}
+
 	s.server = &http.Server{
 		Addr:         s.listenAddr,
 		Handler:      mw(router),
+		TLSConfig:    tlsConfig,
 		WriteTimeout: 10 * time.Second,
 		ReadTimeout:  10 * time.Second,
 	}
 
 	go s.start()
 
+	if cfg.TLSRedirectPort != "" {
+		s.redirectServer = &http.Server{
+			Addr:         cfg.Addr + ":" + cfg.TLSRedirectPort,
+			Handler:      redirectToHTTPS(cfg.Port),
+			WriteTimeout: 10 * time.Second,
+			ReadTimeout:  10 * time.Second,
+		}
+		go s.startRedirect()
+	}
+
+	database.SetSlowQueryThreshold(cfg.DBSlowQueryThreshold)
+	if cfg.DBStatsInterval > 0 {
+		stopPoolStats := database.RecordPoolStats(cfg.DBStatsInterval)
+		defer stopPoolStats()
+	}
+
+	purgeCtx, stopPurge := context.WithCancel(ctx)
+	defer stopPurge()
+	if cfg.TrashPurgeInterval > 0 {
+		go s.purgeTrash(purgeCtx, cfg.TrashRetention, cfg.TrashPurgeInterval)
+	}
+
 	sig := <-signalCh
 	s.logger.Infof("Received %v Signal", sig)
 
@@ -97,22 +239,71 @@ func (s *Server) Install(handle func(string, string, http.Handler)) {
 	handle(http.MethodGet, "/v1/task/{id}", http.HandlerFunc(s.getTaskHandler))
 	handle(http.MethodPost, "/v1/task/{id}", http.HandlerFunc(s.updateTaskHandler))
 	handle(http.MethodDelete, "/v1/task/{id}", http.HandlerFunc(s.deleteTaskHandler))
+	handle(http.MethodGet, "/v1/task/{id}/history", http.HandlerFunc(s.taskHistoryHandler))
+	handle(http.MethodPost, "/v1/task/{id}/restore", http.HandlerFunc(s.restoreTaskHandler))
+	handle(http.MethodGet, "/v1/trash", http.HandlerFunc(s.listTrashHandler))
+	// The audit log and backups expose every task, and restores replace
+	// them, so they are opt-in.
+	if s.adminToken != "" {
+		admin := middleware.AdminAuth(s.adminToken)
+		handle(http.MethodGet, "/v1/admin/audit", admin(http.HandlerFunc(s.listAuditEventsHandler)))
+		handle(http.MethodGet, "/v1/admin/backup", admin(http.HandlerFunc(s.backupHandler)))
+		handle(http.MethodPost, "/v1/admin/restore", admin(http.HandlerFunc(s.restoreHandler)))
+	}
 }
 
 func (s *Server) start() {
-	s.logger.Infof("Server is running on %s", s.listenAddr)
-	err := s.server.ListenAndServe()
+	var err error
+	if s.server.TLSConfig != nil {
+		s.logger.Infof("Server is running on %s with TLS", s.listenAddr)
+		err = s.server.ListenAndServeTLS("", "")
+	} else {
+		s.logger.Infof("Server is running on %s", s.listenAddr)
+		err = s.server.ListenAndServe()
+	}
 	if err != http.ErrServerClosed && !errors.Is(err, http.ErrServerClosed) {
 		s.logger.Fatal(err)
 	}
 }
 
+func (s *Server) startRedirect() {
+	s.logger.Infof("HTTPS redirect server is running on %s", s.redirectServer.Addr)
+	err := s.redirectServer.ListenAndServe()
+	if err != http.ErrServerClosed && !errors.Is(err, http.ErrServerClosed) {
+		s.logger.Fatal(err)
+	}
+}
+
+// redirectToHTTPS returns a handler that permanently redirects requests to
+// the same host and path on the given HTTPS port.
+func redirectToHTTPS(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := strings.TrimSuffix(strings.TrimPrefix(r.Host, "["), "]")
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		switch {
+		case port != "443":
+			host = net.JoinHostPort(host, port)
+		case strings.Contains(host, ":"):
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
 func (s *Server) shutdown() {
 	s.logger.Info("shutting down server")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	if s.redirectServer != nil {
+		if err := s.redirectServer.Shutdown(ctx); err != nil {
+			s.logger.Error("Error while shutting down redirect server: ", err)
+		}
+	}
+
 	err := s.server.Shutdown(ctx)
 	if err != nil {
 		if err == context.DeadlineExceeded {
@@ -123,4 +314,13 @@ func (s *Server) shutdown() {
 	} else {
 		s.logger.Info("server shutdown successfully")
 	}
+
+	if s.taskListener != nil {
+		s.taskListener.Close()
+	}
+	if c, ok := s.taskManager.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			s.logger.Error("Error while closing task manager: ", err)
+		}
+	}
 }
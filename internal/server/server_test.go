@@ -0,0 +1,34 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirectToHTTPS(t *testing.T) {
+	for _, test := range []struct {
+		name, port, target, want string
+	}{
+		{"default port", "443", "http://example.com/v1/tasks", "https://example.com/v1/tasks"},
+		{"other port", "8443", "http://example.com/v1/tasks", "https://example.com:8443/v1/tasks"},
+		{"request port replaced", "8443", "http://example.com:8080/v1/tasks", "https://example.com:8443/v1/tasks"},
+		{"request port dropped", "443", "http://example.com:8080/v1/tasks", "https://example.com/v1/tasks"},
+		{"query kept", "8443", "http://example.com/v1/tasks?after=a%2Fb&limit=10", "https://example.com:8443/v1/tasks?after=a%2Fb&limit=10"},
+		{"escaped path kept", "443", "http://example.com/v1/task/a%2Fb", "https://example.com/v1/task/a%2Fb"},
+		{"IPv6 host", "8443", "http://[::1]:8080/health", "https://[::1]:8443/health"},
+		{"IPv6 host on default port", "443", "http://[::1]:8080/health", "https://[::1]/health"},
+		{"IPv6 host without port", "8443", "http://[::1]/health", "https://[::1]:8443/health"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			redirectToHTTPS(test.port).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, test.target, nil))
+			if rec.Code != http.StatusPermanentRedirect {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusPermanentRedirect)
+			}
+			if got := rec.Header().Get("Location"); got != test.want {
+				t.Errorf("Location = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
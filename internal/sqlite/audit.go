@@ -0,0 +1,83 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/urvil38/todo-app/internal/database"
+	"github.com/urvil38/todo-app/internal/task"
+	"go.opencensus.io/trace"
+)
+
+// insertAuditEvent records a task mutation. It must be called with a DB that
+// is in the same transaction as the mutation itself.
+func insertAuditEvent(ctx context.Context, tx *database.DB, action task.Action, taskID string, before, after *task.Task) error {
+	e := task.NewAuditEvent(ctx, action, taskID, before, after)
+	b, a, err := e.MarshalSnapshots()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+	INSERT INTO audit_events(
+		task_id, action, request_id, remote_addr, user_agent, before, after, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, e.TaskId, string(e.Action), e.Actor.RequestID, e.Actor.RemoteAddr, e.Actor.UserAgent, b, a, timestamp(e.CreatedAt))
+	return err
+}
+
+func (tm *TaskManager) TaskHistory(ctx context.Context, id string) ([]task.AuditEvent, error) {
+	ctx, span := trace.StartSpan(ctx, "sqlite.TaskHistory")
+	defer span.End()
+
+	return tm.ListAuditEvents(ctx, task.AuditFilter{TaskId: id})
+}
+
+func (tm *TaskManager) ListAuditEvents(ctx context.Context, f task.AuditFilter) ([]task.AuditEvent, error) {
+	ctx, span := trace.StartSpan(ctx, "sqlite.ListAuditEvents")
+	defer span.End()
+
+	var (
+		conds []string
+		args  []interface{}
+	)
+	if f.TaskId != "" {
+		// Events are filed under the task ID, which may be given as the
+		// legacy ID.
+		conds = append(conds, `(task_id = ?
+			OR task_id IN (SELECT id FROM tasks WHERE legacy_id = ? AND legacy_id <> ''))`)
+		args = append(args, f.TaskId, f.TaskId)
+	}
+	if !f.Since.IsZero() {
+		conds = append(conds, "created_at >= ?")
+		args = append(args, timestamp(f.Since))
+	}
+	if !f.Until.IsZero() {
+		conds = append(conds, "created_at < ?")
+		args = append(args, timestamp(f.Until))
+	}
+
+	query := "SELECT " + task.AuditEventColumns + " FROM audit_events"
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " ORDER BY created_at, id"
+	if f.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, f.Limit)
+	}
+
+	var events []task.AuditEvent
+	err := tm.db.RunQuery(ctx, query, func(rows *sql.Rows) error {
+		e, err := task.ScanAuditEvent(rows.Scan)
+		if err != nil {
+			return err
+		}
+		events = append(events, e)
+		return nil
+	}, args...)
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,182 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/urvil38/todo-app/internal/config"
+	"github.com/urvil38/todo-app/internal/database"
+	"github.com/urvil38/todo-app/internal/log"
+	"github.com/urvil38/todo-app/internal/task"
+	"go.opencensus.io/trace"
+)
+
+// taskColumns are the columns of the tasks table, in the order of the fields
+// of task.Task.
+const taskColumns = "id, name, created_at, updated_at, deleted_at, legacy_id"
+
+// timestampLayout is used for every stored time. SQLite compares timestamps
+// as strings, so they must be in UTC with a fixed width.
+const timestampLayout = "2006-01-02 15:04:05.000000000"
+
+func timestamp(t time.Time) string {
+	return t.UTC().Format(timestampLayout)
+}
+
+// matchID matches a task by ID or by legacy ID. Tasks without a legacy ID
+// have an empty legacy_id, which must not match an empty argument.
+const matchID = "(id = ?1 OR (legacy_id = ?1 AND legacy_id <> ''))"
+
+type TaskManager struct {
+	db  *database.DB
+	ids task.IDGenerator
+}
+
+func NewTaskManager(ctx context.Context, cfg config.Config) *TaskManager {
+	db, err := OpenDB(ctx, &cfg)
+	if err != nil {
+		log.Logger.Fatal(err)
+	}
+	return &TaskManager{
+		db:  db,
+		ids: task.NewIDGenerator(task.IDScheme(cfg.IDScheme)),
+	}
+}
+
+// getTask reads a task by ID or legacy ID inside tx. Trashed tasks are only
+// returned if trashed is true, and live tasks only if it is false.
+func getTask(ctx context.Context, tx *database.DB, id string, trashed bool) (t task.Task, err error) {
+	query := "SELECT " + taskColumns + " FROM tasks WHERE " + matchID + " AND deleted_at IS NULL"
+	if trashed {
+		query = "SELECT " + taskColumns + " FROM tasks WHERE " + matchID + " AND deleted_at IS NOT NULL"
+	}
+	taskArgs := database.StructScanner(task.Task{})
+	err = tx.QueryRow(ctx, query, id).Scan(taskArgs(&t)...)
+	return t, err
+}
+
+func (tm *TaskManager) CreateTask(ctx context.Context, name string) (_ task.Task, err error) {
+	ctx, span := trace.StartSpan(ctx, "sqlite.CreateTask")
+	defer span.End()
+
+	if err := task.ValidateName(name); err != nil {
+		return task.Task{}, err
+	}
+
+	var t task.Task
+
+	err = tm.db.Transact(ctx, sql.LevelDefault, func(tx *database.DB) error {
+		now := time.Now()
+		id := tm.ids.NewID(now)
+		_, err := tx.Exec(ctx, `
+		INSERT INTO tasks(
+			id, name, created_at, updated_at)
+		VALUES (?, ?, ?, ?)`, id, name, timestamp(now), timestamp(now))
+		if err != nil {
+			return err
+		}
+		if t, err = getTask(ctx, tx, id, false); err != nil {
+			return err
+		}
+		return insertAuditEvent(ctx, tx, task.ActionCreate, t.Id, nil, &t)
+	})
+	if err != nil {
+		return t, err
+	}
+	task.RecordTaskCreate(ctx)
+	return t, nil
+}
+
+func (tm *TaskManager) UpdateTask(ctx context.Context, id, name string) (task.Task, error) {
+	ctx, span := trace.StartSpan(ctx, "sqlite.UpdateTask")
+	defer span.End()
+
+	if err := task.ValidateName(name); err != nil {
+		return task.Task{}, err
+	}
+
+	var t task.Task
+
+	err := tm.db.Transact(ctx, sql.LevelDefault, func(tx *database.DB) error {
+		before, err := getTask(ctx, tx, id, false)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, "UPDATE tasks SET name = ?, updated_at = ? WHERE id = ?", name, timestamp(time.Now()), before.Id)
+		if err != nil {
+			return err
+		}
+		if t, err = getTask(ctx, tx, before.Id, false); err != nil {
+			return err
+		}
+		return insertAuditEvent(ctx, tx, task.ActionUpdate, t.Id, &before, &t)
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return t, task.ErrTaskNotFound
+		}
+		return t, err
+	}
+	task.RecordTaskUpdate(ctx)
+	return t, nil
+}
+
+func (tm *TaskManager) DeleteTask(ctx context.Context, id string) error {
+	ctx, span := trace.StartSpan(ctx, "sqlite.DeleteTask")
+	defer span.End()
+
+	err := tm.db.Transact(ctx, sql.LevelDefault, func(tx *database.DB) error {
+		before, err := getTask(ctx, tx, id, false)
+		if err != nil {
+			return err
+		}
+		now := timestamp(time.Now())
+		_, err = tx.Exec(ctx, "UPDATE tasks SET deleted_at = ?, updated_at = ? WHERE id = ?", now, now, before.Id)
+		if err != nil {
+			return err
+		}
+		t, err := getTask(ctx, tx, before.Id, true)
+		if err != nil {
+			return err
+		}
+		return insertAuditEvent(ctx, tx, task.ActionDelete, t.Id, &before, &t)
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return task.ErrTaskNotFound
+		}
+		return err
+	}
+
+	task.RecordTaskDelete(ctx)
+	return nil
+}
+
+func (tm *TaskManager) ListTasks(ctx context.Context) ([]task.Task, error) {
+	ctx, span := trace.StartSpan(ctx, "sqlite.ListTasks")
+	defer span.End()
+
+	return listTasks(ctx, tm.db, "SELECT "+taskColumns+" FROM tasks WHERE deleted_at IS NULL ORDER BY created_at, id")
+}
+
+func listTasks(ctx context.Context, db *database.DB, query string, args ...interface{}) ([]task.Task, error) {
+	// SQLite has no cursors, so QueryIter cannot be used.
+	return database.QueryAll[task.Task](ctx, db, query, args...)
+}
+
+func (tm *TaskManager) GetTask(ctx context.Context, id string) (task.Task, error) {
+	ctx, span := trace.StartSpan(ctx, "sqlite.GetTask")
+	defer span.End()
+
+	t, err := getTask(ctx, tm.db, id, false)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return t, task.ErrTaskNotFound
+		}
+		return t, err
+	}
+
+	return t, nil
+}
@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS tasks;
+CREATE TABLE IF NOT EXISTS tasks(
+  id TEXT PRIMARY KEY,
+  name VARCHAR (100) NOT NULL CHECK (length(name) <= 100),
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  deleted_at TIMESTAMP,
+  legacy_id TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX tasks_deleted_at_idx ON tasks (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX tasks_created_at_idx ON tasks (created_at, id);
+CREATE UNIQUE INDEX tasks_legacy_id_idx ON tasks (legacy_id) WHERE legacy_id <> '';
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS audit_events(
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  task_id TEXT NOT NULL,
+  action TEXT NOT NULL,
+  request_id TEXT NOT NULL DEFAULT '',
+  remote_addr TEXT NOT NULL DEFAULT '',
+  user_agent TEXT NOT NULL DEFAULT '',
+  before TEXT,
+  after TEXT,
+  created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX audit_events_task_id_idx ON audit_events (task_id, created_at);
+CREATE INDEX audit_events_created_at_idx ON audit_events (created_at);
+
+CREATE TRIGGER prevent_audit_update BEFORE UPDATE ON audit_events
+BEGIN
+  SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
+
+CREATE TRIGGER prevent_audit_delete BEFORE DELETE ON audit_events
+BEGIN
+  SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
@@ -0,0 +1,79 @@
+// Package sqlite stores tasks in an SQLite database file, for installs that
+// do not want to run Postgres.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+
+	"github.com/golang-migrate/migrate/v4"
+	migratesqlite "github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/urvil38/todo-app/internal/config"
+	"github.com/urvil38/todo-app/internal/database"
+	"github.com/urvil38/todo-app/internal/log"
+
+	// imported to register the sqlite database driver
+	_ "modernc.org/sqlite"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// OpenDB opens the SQLite database at cfg.SQLitePath, creating it if needed,
+// and migrates it to the latest schema.
+func OpenDB(ctx context.Context, cfg *config.Config) (_ *database.DB, err error) {
+	log.Logger.Infof("opening sqlite database %s", cfg.SQLitePath)
+	if err := migrateDB(cfg.SQLitePath); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite", cfg.SQLitePath)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer at a time. Using one connection avoids
+	// SQLITE_BUSY errors between concurrent transactions.
+	db.SetMaxOpenConns(1)
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	log.Logger.Infof("database open finished")
+	ddb := database.New(db)
+	database.RegisterPool("sqlite", ddb)
+	return ddb, nil
+}
+
+// migrateDB applies the embedded migrations to the database at path.
+func migrateDB(path string) (outerErr error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	// Closing the migrate instance also closes db.
+	driver, err := migratesqlite.WithInstance(db, &migratesqlite.Config{})
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("sqlite.WithInstance(): %v", err)
+	}
+	source, err := iofs.New(migrations, "migrations")
+	if err != nil {
+		return fmt.Errorf("iofs.New(): %v", err)
+	}
+	m, err := migrate.NewWithInstance("iofs", source, "sqlite", driver)
+	if err != nil {
+		return fmt.Errorf("migrate.NewWithInstance(): %v", err)
+	}
+	defer func() {
+		if srcErr, dbErr := m.Close(); srcErr != nil || dbErr != nil {
+			outerErr = database.MultiErr{outerErr, srcErr, dbErr}
+		}
+	}()
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		return fmt.Errorf("m.Up(): %v", err)
+	}
+	return nil
+}
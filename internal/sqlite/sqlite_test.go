@@ -0,0 +1,57 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/urvil38/todo-app/internal/config"
+	"github.com/urvil38/todo-app/internal/task"
+	"github.com/urvil38/todo-app/internal/task/tasktest"
+)
+
+func TestTaskManager(t *testing.T) {
+	tasktest.RunManagerTests(t, func(t *testing.T) task.Manager {
+		cfg := config.Config{SQLitePath: filepath.Join(t.TempDir(), "todo.db")}
+		db, err := OpenDB(context.Background(), &cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return &TaskManager{db: db, ids: task.NewIDGenerator(task.IDSchemeULID)}
+	})
+}
+
+func TestTaskHistory(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.Config{SQLitePath: filepath.Join(t.TempDir(), "todo.db")}
+	db, err := OpenDB(ctx, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	tm := &TaskManager{db: db, ids: task.NewIDGenerator(task.IDSchemeULID)}
+
+	ctx = task.WithActor(ctx, task.Actor{RequestID: "req"})
+	created, err := tm.CreateTask(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated, err := tm.UpdateTask(ctx, created.Id, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := tm.TaskHistory(ctx, created.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h) != 2 {
+		t.Fatalf("TaskHistory() = %+v, want 2 events", h)
+	}
+	if e := h[0]; e.Action != task.ActionCreate || e.Before != nil || e.After == nil || e.After.Name != "a" || e.Actor.RequestID != "req" {
+		t.Errorf("create event = %+v", e)
+	}
+	if e := h[1]; e.Action != task.ActionUpdate || e.Before == nil || e.Before.Name != "a" || e.After == nil || e.After.Name != updated.Name {
+		t.Errorf("update event = %+v", e)
+	}
+}
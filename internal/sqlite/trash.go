@@ -0,0 +1,102 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/urvil38/todo-app/internal/database"
+	"github.com/urvil38/todo-app/internal/task"
+	"go.opencensus.io/trace"
+)
+
+func (tm *TaskManager) ListTrash(ctx context.Context) ([]task.Task, error) {
+	ctx, span := trace.StartSpan(ctx, "sqlite.ListTrash")
+	defer span.End()
+
+	return listTasks(ctx, tm.db, "SELECT "+taskColumns+" FROM tasks WHERE deleted_at IS NOT NULL ORDER BY deleted_at")
+}
+
+func (tm *TaskManager) RestoreTask(ctx context.Context, id string) (task.Task, error) {
+	ctx, span := trace.StartSpan(ctx, "sqlite.RestoreTask")
+	defer span.End()
+
+	var t task.Task
+
+	err := tm.db.Transact(ctx, sql.LevelDefault, func(tx *database.DB) error {
+		before, err := getTask(ctx, tx, id, true)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, "UPDATE tasks SET deleted_at = NULL, updated_at = ? WHERE id = ?", timestamp(time.Now()), before.Id)
+		if err != nil {
+			return err
+		}
+		if t, err = getTask(ctx, tx, before.Id, false); err != nil {
+			return err
+		}
+		return insertAuditEvent(ctx, tx, task.ActionRestore, t.Id, &before, &t)
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return t, task.ErrTaskNotFound
+		}
+		return t, err
+	}
+	return t, nil
+}
+
+func (tm *TaskManager) PurgeTask(ctx context.Context, id string) error {
+	ctx, span := trace.StartSpan(ctx, "sqlite.PurgeTask")
+	defer span.End()
+
+	taskArgs := database.StructScanner(task.Task{})
+
+	err := tm.db.Transact(ctx, sql.LevelDefault, func(tx *database.DB) error {
+		var t task.Task
+		err := tx.QueryRow(ctx, "SELECT "+taskColumns+" FROM tasks WHERE "+matchID, id).Scan(taskArgs(&t)...)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, "DELETE FROM tasks WHERE id = ?", t.Id); err != nil {
+			return err
+		}
+		return insertAuditEvent(ctx, tx, task.ActionPurge, t.Id, &t, nil)
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return task.ErrTaskNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (tm *TaskManager) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	ctx, span := trace.StartSpan(ctx, "sqlite.PurgeTrash")
+	defer span.End()
+
+	var n int
+
+	err := tm.db.Transact(ctx, sql.LevelDefault, func(tx *database.DB) error {
+		purged, err := database.QueryAll[task.Task](ctx, tx, "SELECT "+taskColumns+" FROM tasks WHERE deleted_at < ? ORDER BY deleted_at, id", timestamp(before))
+		if err != nil {
+			return err
+		}
+		for k := range purged {
+			if _, err := tx.Exec(ctx, "DELETE FROM tasks WHERE id = ?", purged[k].Id); err != nil {
+				return err
+			}
+			if err := insertAuditEvent(ctx, tx, task.ActionPurge, purged[k].Id, &purged[k], nil); err != nil {
+				return err
+			}
+		}
+		n = len(purged)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,155 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Action describes the kind of mutation recorded by an AuditEvent.
+type Action string
+
+const (
+	ActionCreate  Action = "create"
+	ActionUpdate  Action = "update"
+	ActionDelete  Action = "delete"
+	ActionRestore Action = "restore"
+	ActionPurge   Action = "purge"
+)
+
+// Actor identifies who performed a mutation.
+type Actor struct {
+	RequestID  string `json:"request_id,omitempty"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	UserAgent  string `json:"user_agent,omitempty"`
+}
+
+// AuditEvent is a single entry of the append-only audit trail. Before is nil
+// for created tasks and After is nil for purged tasks.
+type AuditEvent struct {
+	Id        string    `json:"id,omitempty"`
+	TaskId    string    `json:"task_id,omitempty"`
+	Action    Action    `json:"action,omitempty"`
+	Actor     Actor     `json:"actor"`
+	Before    *Task     `json:"before,omitempty"`
+	After     *Task     `json:"after,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+}
+
+// NewAuditEvent returns the event recording a mutation made with ctx, now.
+// Its Id is left for the storage to assign.
+func NewAuditEvent(ctx context.Context, action Action, taskID string, before, after *Task) AuditEvent {
+	return AuditEvent{
+		TaskId:    taskID,
+		Action:    action,
+		Actor:     ActorFromContext(ctx),
+		Before:    before,
+		After:     after,
+		CreatedAt: time.Now(),
+	}
+}
+
+// AuditEventColumns are the columns of the audit_events table of the SQL
+// storages, in the order ScanAuditEvent reads them.
+const AuditEventColumns = "id, task_id, action, request_id, remote_addr, user_agent, before, after, created_at"
+
+// MarshalSnapshots returns Before and After as the SQL storages store them:
+// as JSON text, or nil for a missing task.
+func (e AuditEvent) MarshalSnapshots() (before, after interface{}, err error) {
+	if before, err = marshalSnapshot(e.Before); err != nil {
+		return nil, nil, err
+	}
+	if after, err = marshalSnapshot(e.After); err != nil {
+		return nil, nil, err
+	}
+	return before, after, nil
+}
+
+func marshalSnapshot(t *Task) (interface{}, error) {
+	if t == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(t)
+	if err != nil {
+		return nil, fmt.Errorf("marshalSnapshot: %v", err)
+	}
+	return string(b), nil
+}
+
+func unmarshalSnapshot(b []byte) (*Task, error) {
+	if b == nil {
+		return nil, nil
+	}
+	var t Task
+	if err := json.Unmarshal(b, &t); err != nil {
+		return nil, fmt.Errorf("unmarshalSnapshot: %v", err)
+	}
+	return &t, nil
+}
+
+// ScanAuditEvent reads an event from a row of AuditEventColumns with scan,
+// which is usually the Scan method of a sql.Rows.
+func ScanAuditEvent(scan func(dest ...interface{}) error) (AuditEvent, error) {
+	var (
+		e             AuditEvent
+		action        string
+		before, after []byte
+	)
+	err := scan(&e.Id, &e.TaskId, &action, &e.Actor.RequestID, &e.Actor.RemoteAddr, &e.Actor.UserAgent, &before, &after, &e.CreatedAt)
+	if err != nil {
+		return e, err
+	}
+	e.Action = Action(action)
+	if e.Before, err = unmarshalSnapshot(before); err != nil {
+		return e, err
+	}
+	if e.After, err = unmarshalSnapshot(after); err != nil {
+		return e, err
+	}
+	return e, nil
+}
+
+// AuditFilter restricts the events returned by AuditLog.ListAuditEvents.
+// Zero values mean no restriction.
+type AuditFilter struct {
+	TaskId string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+// Match reports whether e satisfies the filter, ignoring Limit.
+func (f AuditFilter) Match(e AuditEvent) bool {
+	if f.TaskId != "" && e.TaskId != f.TaskId {
+		return false
+	}
+	if !f.Since.IsZero() && e.CreatedAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.CreatedAt.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+// AuditLog gives read access to the audit trail of task mutations.
+// Events are returned oldest first.
+type AuditLog interface {
+	TaskHistory(ctx context.Context, id string) ([]AuditEvent, error)
+	ListAuditEvents(ctx context.Context, f AuditFilter) ([]AuditEvent, error)
+}
+
+type actorKey struct{}
+
+// WithActor returns a copy of ctx carrying the given actor.
+func WithActor(ctx context.Context, a Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, a)
+}
+
+// ActorFromContext returns the actor stored in ctx by WithActor, or the zero
+// Actor if there is none.
+func ActorFromContext(ctx context.Context) Actor {
+	a, _ := ctx.Value(actorKey{}).(Actor)
+	return a
+}
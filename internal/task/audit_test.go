@@ -0,0 +1,60 @@
+package task
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestScanAuditEvent(t *testing.T) {
+	ctx := WithActor(context.Background(), Actor{RequestID: "req", RemoteAddr: "10.0.0.1", UserAgent: "curl"})
+	now := time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)
+	before := &Task{Id: "a", Name: "old", CreatedAt: now, UpdatedAt: now}
+	for _, test := range []struct {
+		action        Action
+		before, after *Task
+	}{
+		{ActionCreate, nil, before},
+		{ActionUpdate, before, &Task{Id: "a", Name: "new", CreatedAt: now, UpdatedAt: now.Add(time.Second)}},
+		{ActionPurge, before, nil},
+	} {
+		e := NewAuditEvent(ctx, test.action, "a", test.before, test.after)
+		e.Id, e.CreatedAt = "7", now
+		b, a, err := e.MarshalSnapshots()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Scan the columns as a SQL driver returns them.
+		row := []driver.Value{e.Id, e.TaskId, string(e.Action), e.Actor.RequestID, e.Actor.RemoteAddr, e.Actor.UserAgent, bytes(b), bytes(a), e.CreatedAt}
+		got, err := ScanAuditEvent(func(dest ...interface{}) error {
+			if len(dest) != len(row) {
+				return fmt.Errorf("scanned %d columns, want %d", len(dest), len(row))
+			}
+			for k, v := range row {
+				if v == nil {
+					continue
+				}
+				reflect.ValueOf(dest[k]).Elem().Set(reflect.ValueOf(v))
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, e) {
+			t.Errorf("%s: ScanAuditEvent() = %+v, want %+v", test.action, got, e)
+		}
+	}
+}
+
+// bytes returns a snapshot as a driver returns it, nil for NULL.
+func bytes(v interface{}) driver.Value {
+	if v == nil {
+		return nil
+	}
+	return []byte(v.(string))
+}
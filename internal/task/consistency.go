@@ -0,0 +1,19 @@
+package task
+
+import "context"
+
+type freshReadsKey struct{}
+
+// WithFreshReads returns a copy of ctx that asks for reads reflecting every
+// write made so far, for callers that just wrote and must see their own
+// changes. Managers that read from replicas serve such reads from the
+// primary instead.
+func WithFreshReads(ctx context.Context) context.Context {
+	return context.WithValue(ctx, freshReadsKey{}, true)
+}
+
+// FreshReadsRequested reports whether ctx was returned by WithFreshReads.
+func FreshReadsRequested(ctx context.Context) bool {
+	fresh, _ := ctx.Value(freshReadsKey{}).(bool)
+	return fresh
+}
@@ -0,0 +1,165 @@
+package task
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// IDScheme selects the format of new task IDs.
+type IDScheme string
+
+const (
+	// IDSchemeULID issues ULIDs: 26 Crockford base32 characters that sort
+	// by creation time.
+	IDSchemeULID IDScheme = "ulid"
+	// IDSchemeUUIDv7 issues version 7 UUIDs in the canonical hyphenated
+	// form, which also sort by creation time.
+	IDSchemeUUIDv7 IDScheme = "uuidv7"
+)
+
+// ParseIDScheme validates s as an IDScheme.
+func ParseIDScheme(s string) (IDScheme, error) {
+	switch scheme := IDScheme(s); scheme {
+	case IDSchemeULID, IDSchemeUUIDv7:
+		return scheme, nil
+	default:
+		return "", fmt.Errorf("unsupported id scheme: %q", s)
+	}
+}
+
+// IDGenerator issues globally unique task IDs.
+type IDGenerator interface {
+	// NewID returns a new ID for a task created at t. IDs issued for
+	// non-decreasing times sort in the order they were issued.
+	NewID(t time.Time) string
+}
+
+// NewIDGenerator returns a generator for scheme. Any scheme other than
+// IDSchemeUUIDv7 issues ULIDs.
+func NewIDGenerator(scheme IDScheme) IDGenerator {
+	return NewIDGeneratorFrom(scheme, rand.Reader)
+}
+
+// NewIDGeneratorFrom is like NewIDGenerator, but draws the random part of
+// IDs from r, so that a seeded r issues the same IDs for the same times.
+func NewIDGeneratorFrom(scheme IDScheme, r io.Reader) IDGenerator {
+	if scheme == IDSchemeUUIDv7 {
+		return &uuidv7Generator{monotonic{rand: r}}
+	}
+	return &ulidGenerator{monotonic{rand: r}}
+}
+
+// IsLegacyID reports whether id was issued by a counter, before task IDs
+// became globally unique. Legacy IDs remain valid aliases of the tasks they
+// were issued for.
+func IsLegacyID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, r := range id {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// monotonic holds the random part of the last ID issued, so that IDs issued
+// within the same millisecond can be ordered by incrementing it.
+type monotonic struct {
+	rand    io.Reader
+	mu      sync.Mutex
+	ms      uint64
+	entropy [10]byte
+}
+
+// next returns the timestamp and random bits of a new ID. increment adds one
+// to the random bits and reports false on overflow, in which case fresh
+// random bits are drawn.
+func (m *monotonic) next(t time.Time, increment func(*[10]byte) bool) (uint64, [10]byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ms := uint64(t.UnixNano() / int64(time.Millisecond))
+	if ms != m.ms || !increment(&m.entropy) {
+		if _, err := io.ReadFull(m.rand, m.entropy[:]); err != nil {
+			panic(fmt.Sprintf("unable to read random bytes: %v", err))
+		}
+		m.ms = ms
+	}
+	return ms, m.entropy
+}
+
+// crockford is the Crockford base32 alphabet used by ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+type ulidGenerator struct {
+	monotonic
+}
+
+func (g *ulidGenerator) NewID(t time.Time) string {
+	ms, entropy := g.next(t, func(e *[10]byte) bool {
+		for k := len(e) - 1; k >= 0; k-- {
+			e[k]++
+			if e[k] != 0 {
+				return true
+			}
+		}
+		return false
+	})
+
+	var b [16]byte
+	b[0], b[1], b[2], b[3], b[4], b[5] = byte(ms>>40), byte(ms>>32), byte(ms>>24), byte(ms>>16), byte(ms>>8), byte(ms)
+	copy(b[6:], entropy[:])
+
+	// Encode the 128 bits, padded to 130, as 26 groups of 5 bits.
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	var s [26]byte
+	for k := 25; k >= 0; k-- {
+		s[k] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(s[:])
+}
+
+type uuidv7Generator struct {
+	monotonic
+}
+
+func (g *uuidv7Generator) NewID(t time.Time) string {
+	// Only the 62 bits of rand_b are incremented, so that a carry never
+	// reaches the variant bits.
+	ms, entropy := g.next(t, func(e *[10]byte) bool {
+		n := binary.BigEndian.Uint64(e[2:]) & (1<<62 - 1)
+		if n == 1<<62-1 {
+			return false
+		}
+		binary.BigEndian.PutUint64(e[2:], n+1)
+		return true
+	})
+
+	var b [16]byte
+	b[0], b[1], b[2], b[3], b[4], b[5] = byte(ms>>40), byte(ms>>32), byte(ms>>24), byte(ms>>16), byte(ms>>8), byte(ms)
+	copy(b[6:], entropy[:])
+	b[6] = b[6]&0x0f | 0x70 // version 7
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+
+	var s [36]byte
+	hex.Encode(s[0:8], b[0:4])
+	s[8] = '-'
+	hex.Encode(s[9:13], b[4:6])
+	s[13] = '-'
+	hex.Encode(s[14:18], b[6:8])
+	s[18] = '-'
+	hex.Encode(s[19:23], b[8:10])
+	s[23] = '-'
+	hex.Encode(s[24:], b[10:])
+	return string(s[:])
+}
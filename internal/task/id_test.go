@@ -0,0 +1,71 @@
+package task
+
+import (
+	"math/rand"
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestNewID(t *testing.T) {
+	formats := map[IDScheme]*regexp.Regexp{
+		IDSchemeULID:   regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`),
+		IDSchemeUUIDv7: regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+	}
+	for scheme, format := range formats {
+		g := NewIDGenerator(scheme)
+		now := time.Now()
+		var ids []string
+		// Many IDs in the same millisecond exercise the monotonic increment.
+		for k := 0; k < 1000; k++ {
+			id := g.NewID(now.Add(time.Duration(k/100) * time.Millisecond))
+			if !format.MatchString(id) {
+				t.Fatalf("%s: malformed id %q", scheme, id)
+			}
+			if IsLegacyID(id) {
+				t.Errorf("%s: IsLegacyID(%q) = true", scheme, id)
+			}
+			ids = append(ids, id)
+		}
+		if !sort.StringsAreSorted(ids) {
+			t.Errorf("%s: ids issued for non-decreasing times are not sorted", scheme)
+		}
+		seen := make(map[string]bool)
+		for _, id := range ids {
+			if seen[id] {
+				t.Errorf("%s: duplicate id %q", scheme, id)
+			}
+			seen[id] = true
+		}
+	}
+}
+
+func TestULIDTimestamp(t *testing.T) {
+	// The first 10 characters encode the millisecond timestamp.
+	got := NewIDGenerator(IDSchemeULID).NewID(time.UnixMilli(1469918176385))
+	if want := "01ARYZ6S41"; got[:10] != want {
+		t.Errorf("timestamp part = %q, want %q", got[:10], want)
+	}
+}
+
+func TestNewIDGeneratorFrom(t *testing.T) {
+	now := time.Now()
+	for _, scheme := range []IDScheme{IDSchemeULID, IDSchemeUUIDv7} {
+		a := NewIDGeneratorFrom(scheme, rand.New(rand.NewSource(1)))
+		b := NewIDGeneratorFrom(scheme, rand.New(rand.NewSource(1)))
+		for k := 0; k < 10; k++ {
+			if x, y := a.NewID(now), b.NewID(now); x != y {
+				t.Fatalf("%s: same seed issued %q and %q", scheme, x, y)
+			}
+		}
+	}
+}
+
+func TestIsLegacyID(t *testing.T) {
+	for id, want := range map[string]bool{"1": true, "42": true, "": false, "4a": false, "-1": false} {
+		if got := IsLegacyID(id); got != want {
+			t.Errorf("IsLegacyID(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
@@ -26,6 +26,24 @@ var (
 		stats.UnitDimensionless,
 	)
 
+	taskCacheHitCount = stats.Int64(
+		"todo_app/task/cache/hit/count",
+		"Number of task lookups served by the cache",
+		stats.UnitDimensionless,
+	)
+
+	taskCacheMissCount = stats.Int64(
+		"todo_app/task/cache/miss/count",
+		"Number of task lookups that missed the cache",
+		stats.UnitDimensionless,
+	)
+
+	taskCacheEvictionCount = stats.Int64(
+		"todo_app/task/cache/eviction/count",
+		"Number of task lookups evicted from the full cache",
+		stats.UnitDimensionless,
+	)
+
 	TaskCreatedCountView = &view.View{
 		Name:        "todo_app/task/create/count",
 		Measure:     taskCreateCount,
@@ -44,6 +62,24 @@ var (
 		Aggregation: view.Count(),
 		Description: "Number of tasks deleted",
 	}
+	TaskCacheHitCountView = &view.View{
+		Name:        "todo_app/task/cache/hit/count",
+		Measure:     taskCacheHitCount,
+		Aggregation: view.Count(),
+		Description: "Number of task lookups served by the cache",
+	}
+	TaskCacheMissCountView = &view.View{
+		Name:        "todo_app/task/cache/miss/count",
+		Measure:     taskCacheMissCount,
+		Aggregation: view.Count(),
+		Description: "Number of task lookups that missed the cache",
+	}
+	TaskCacheEvictionCountView = &view.View{
+		Name:        "todo_app/task/cache/eviction/count",
+		Measure:     taskCacheEvictionCount,
+		Aggregation: view.Count(),
+		Description: "Number of task lookups evicted from the full cache",
+	}
 )
 
 func RecordTaskCreate(ctx context.Context) {
@@ -57,3 +93,15 @@ func RecordTaskUpdate(ctx context.Context) {
 func RecordTaskDelete(ctx context.Context) {
 	stats.Record(ctx, taskDeleteCount.M(1))
 }
+
+func RecordTaskCacheHit(ctx context.Context) {
+	stats.Record(ctx, taskCacheHitCount.M(1))
+}
+
+func RecordTaskCacheMiss(ctx context.Context) {
+	stats.Record(ctx, taskCacheMissCount.M(1))
+}
+
+func RecordTaskCacheEviction(ctx context.Context) {
+	stats.Record(ctx, taskCacheEvictionCount.M(1))
+}
@@ -3,18 +3,37 @@ package task
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
+	"unicode/utf8"
 )
 
+// MaxNameLength is the maximum number of characters in a task name.
+const MaxNameLength = 100
+
 var (
 	ErrTaskNotFound = errors.New("task not found")
+	ErrNameTooLong  = fmt.Errorf("task name longer than %d characters", MaxNameLength)
 )
 
+// ValidateName returns ErrNameTooLong if name cannot be stored.
+func ValidateName(name string) error {
+	if utf8.RuneCountInString(name) > MaxNameLength {
+		return ErrNameTooLong
+	}
+	return nil
+}
+
 type Task struct {
-	Id        string    `json:"id,omitempty"`
-	Name      string    `json:"name,omitempty"`
-	CreatedAt time.Time `json:"created_at,omitempty"`
-	UpdatedAt time.Time `json:"updated_at,omitempty"`
+	Id        string    `json:"id,omitempty" db:"id"`
+	Name      string    `json:"name,omitempty" db:"name"`
+	CreatedAt time.Time `json:"created_at,omitempty" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at,omitempty" db:"updated_at"`
+	// DeletedAt is set when the task has been moved to the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	// LegacyId is the counter ID the task had before IDs became globally
+	// unique, if any. Lookups accept it as an alias of Id.
+	LegacyId string `json:"legacy_id,omitempty" db:"legacy_id"`
 }
 
 type Manager interface {
@@ -22,6 +41,7 @@ type Manager interface {
 	TaskUpdater
 	TaskDeleter
 	TaskGetter
+	TaskTrash
 }
 
 type TaskCreator interface {
@@ -32,10 +52,26 @@ type TaskUpdater interface {
 	UpdateTask(ctx context.Context, id, name string) (Task, error)
 }
 
+// TaskDeleter moves tasks to the trash. Trashed tasks are not returned by
+// TaskGetter and cannot be updated until they are restored.
 type TaskDeleter interface {
 	DeleteTask(ctx context.Context, id string) error
 }
 
+// TaskTrash manages deleted tasks.
+type TaskTrash interface {
+	ListTrash(ctx context.Context) ([]Task, error)
+	// RestoreTask moves a task out of the trash. It returns ErrTaskNotFound
+	// if the task is not in the trash.
+	RestoreTask(ctx context.Context, id string) (Task, error)
+	// PurgeTask permanently removes a task, whether it is in the trash or not.
+	PurgeTask(ctx context.Context, id string) error
+	// PurgeTrash permanently removes tasks that were moved to the trash
+	// before the given time, in the order they were, and returns the number
+	// of removed tasks.
+	PurgeTrash(ctx context.Context, before time.Time) (int, error)
+}
+
 type TaskGetter interface {
 	GetTask(ctx context.Context, id string) (Task, error)
 	ListTasks(ctx context.Context) ([]Task, error)
@@ -0,0 +1,579 @@
+// Package tasktest provides a conformance suite for task.Manager
+// implementations, so that every storage backend behaves the same way.
+package tasktest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/urvil38/todo-app/internal/task"
+)
+
+// RunManagerTests runs the conformance suite. newManager must return an
+// empty Manager for every call; it is called once per subtest.
+func RunManagerTests(t *testing.T, newManager func(t *testing.T) task.Manager) {
+	tests := []struct {
+		name string
+		f    func(t *testing.T, m task.Manager)
+	}{
+		{"CreateAndGet", testCreateAndGet},
+		{"Update", testUpdate},
+		{"Delete", testDelete},
+		{"NotFound", testNotFound},
+		{"NameLength", testNameLength},
+		{"ListOrder", testListOrder},
+		{"Trash", testTrash},
+		{"Restore", testRestore},
+		{"PurgeTrash", testPurgeTrash},
+		{"PurgeTrashOrder", testPurgeTrashOrder},
+		{"ConcurrentCreate", testConcurrentCreate},
+		{"ConcurrentUpdate", testConcurrentUpdate},
+		{"Transact", testTransact},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.f(t, newManager(t))
+		})
+	}
+}
+
+// clockSlack allows for backends that take timestamps from a database
+// server whose clock differs slightly from ours.
+const clockSlack = time.Minute
+
+func mustCreate(t *testing.T, m task.Manager, name string) task.Task {
+	t.Helper()
+	tk, err := m.CreateTask(context.Background(), name)
+	if err != nil {
+		t.Fatalf("CreateTask(%q): %v", name, err)
+	}
+	return tk
+}
+
+func mustList(t *testing.T, m task.Manager) []task.Task {
+	t.Helper()
+	tasks, err := m.ListTasks(context.Background())
+	if err != nil {
+		t.Fatalf("ListTasks: %v", err)
+	}
+	return tasks
+}
+
+func ids(tasks []task.Task) []string {
+	var s []string
+	for _, tk := range tasks {
+		s = append(s, tk.Id)
+	}
+	return s
+}
+
+func equalTasks(a, b task.Task) bool {
+	return a.Id == b.Id && a.Name == b.Name &&
+		a.CreatedAt.Equal(b.CreatedAt) && a.UpdatedAt.Equal(b.UpdatedAt) &&
+		(a.DeletedAt == nil) == (b.DeletedAt == nil) &&
+		(a.DeletedAt == nil || a.DeletedAt.Equal(*b.DeletedAt))
+}
+
+func testCreateAndGet(t *testing.T, m task.Manager) {
+	ctx := context.Background()
+	start := time.Now()
+	created := mustCreate(t, m, "write tests")
+	if created.Id == "" {
+		t.Fatal("CreateTask returned an empty ID")
+	}
+	if created.Name != "write tests" {
+		t.Errorf("Name = %q, want %q", created.Name, "write tests")
+	}
+	if created.CreatedAt.Before(start.Add(-clockSlack)) || created.CreatedAt.After(time.Now().Add(clockSlack)) {
+		t.Errorf("CreatedAt = %v, want about %v", created.CreatedAt, start)
+	}
+	if !created.UpdatedAt.Equal(created.CreatedAt) {
+		t.Errorf("UpdatedAt = %v, want CreatedAt %v", created.UpdatedAt, created.CreatedAt)
+	}
+	if created.DeletedAt != nil {
+		t.Errorf("DeletedAt = %v, want nil", created.DeletedAt)
+	}
+
+	got, err := m.GetTask(ctx, created.Id)
+	if err != nil {
+		t.Fatalf("GetTask(%q): %v", created.Id, err)
+	}
+	if !equalTasks(got, created) {
+		t.Errorf("GetTask(%q) = %+v, want %+v", created.Id, got, created)
+	}
+
+	other := mustCreate(t, m, "write more tests")
+	if other.Id == created.Id {
+		t.Errorf("two tasks were given ID %q", other.Id)
+	}
+}
+
+func testUpdate(t *testing.T, m task.Manager) {
+	ctx := context.Background()
+	created := mustCreate(t, m, "old")
+	time.Sleep(10 * time.Millisecond)
+
+	updated, err := m.UpdateTask(ctx, created.Id, "new")
+	if err != nil {
+		t.Fatalf("UpdateTask(%q): %v", created.Id, err)
+	}
+	if updated.Id != created.Id || updated.Name != "new" {
+		t.Errorf("UpdateTask = %+v, want ID %q and name %q", updated, created.Id, "new")
+	}
+	if !updated.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("CreatedAt changed from %v to %v", created.CreatedAt, updated.CreatedAt)
+	}
+	if !updated.UpdatedAt.After(created.UpdatedAt) {
+		t.Errorf("UpdatedAt = %v, want after %v", updated.UpdatedAt, created.UpdatedAt)
+	}
+
+	got, err := m.GetTask(ctx, created.Id)
+	if err != nil {
+		t.Fatalf("GetTask(%q): %v", created.Id, err)
+	}
+	if !equalTasks(got, updated) {
+		t.Errorf("GetTask(%q) = %+v, want %+v", created.Id, got, updated)
+	}
+}
+
+func testDelete(t *testing.T, m task.Manager) {
+	ctx := context.Background()
+	a := mustCreate(t, m, "a")
+	b := mustCreate(t, m, "b")
+
+	if err := m.DeleteTask(ctx, a.Id); err != nil {
+		t.Fatalf("DeleteTask(%q): %v", a.Id, err)
+	}
+	if _, err := m.GetTask(ctx, a.Id); !errors.Is(err, task.ErrTaskNotFound) {
+		t.Errorf("GetTask of deleted task: got %v, want ErrTaskNotFound", err)
+	}
+	if _, err := m.UpdateTask(ctx, a.Id, "a2"); !errors.Is(err, task.ErrTaskNotFound) {
+		t.Errorf("UpdateTask of deleted task: got %v, want ErrTaskNotFound", err)
+	}
+	if err := m.DeleteTask(ctx, a.Id); !errors.Is(err, task.ErrTaskNotFound) {
+		t.Errorf("second DeleteTask: got %v, want ErrTaskNotFound", err)
+	}
+	if got, want := ids(mustList(t, m)), []string{b.Id}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("ListTasks = %v, want %v", got, want)
+	}
+}
+
+func testNotFound(t *testing.T, m task.Manager) {
+	ctx := context.Background()
+	mustCreate(t, m, "a")
+	// Both an ID in the backend's format that was never issued and one that
+	// can never be valid must be reported as missing, not as an error.
+	for _, id := range []string{"999999", "no-such-task", ""} {
+		if _, err := m.GetTask(ctx, id); !errors.Is(err, task.ErrTaskNotFound) {
+			t.Errorf("GetTask(%q): got %v, want ErrTaskNotFound", id, err)
+		}
+		if _, err := m.UpdateTask(ctx, id, "x"); !errors.Is(err, task.ErrTaskNotFound) {
+			t.Errorf("UpdateTask(%q): got %v, want ErrTaskNotFound", id, err)
+		}
+		if err := m.DeleteTask(ctx, id); !errors.Is(err, task.ErrTaskNotFound) {
+			t.Errorf("DeleteTask(%q): got %v, want ErrTaskNotFound", id, err)
+		}
+		if _, err := m.RestoreTask(ctx, id); !errors.Is(err, task.ErrTaskNotFound) {
+			t.Errorf("RestoreTask(%q): got %v, want ErrTaskNotFound", id, err)
+		}
+		if err := m.PurgeTask(ctx, id); !errors.Is(err, task.ErrTaskNotFound) {
+			t.Errorf("PurgeTask(%q): got %v, want ErrTaskNotFound", id, err)
+		}
+	}
+}
+
+func testNameLength(t *testing.T, m task.Manager) {
+	ctx := context.Background()
+	// Multi-byte characters check that the limit counts characters.
+	longest := strings.Repeat("é", task.MaxNameLength)
+	tk := mustCreate(t, m, longest)
+	if tk.Name != longest {
+		t.Errorf("Name = %q, want %q", tk.Name, longest)
+	}
+
+	tooLong := longest + "x"
+	if _, err := m.CreateTask(ctx, tooLong); !errors.Is(err, task.ErrNameTooLong) {
+		t.Errorf("CreateTask with %d characters: got %v, want ErrNameTooLong", task.MaxNameLength+1, err)
+	}
+	if _, err := m.UpdateTask(ctx, tk.Id, tooLong); !errors.Is(err, task.ErrNameTooLong) {
+		t.Errorf("UpdateTask with %d characters: got %v, want ErrNameTooLong", task.MaxNameLength+1, err)
+	}
+	if got := mustList(t, m); len(got) != 1 || got[0].Name != longest {
+		t.Errorf("ListTasks = %+v, want only the first task", got)
+	}
+}
+
+func testListOrder(t *testing.T, m task.Manager) {
+	ctx := context.Background()
+	if got := mustList(t, m); len(got) != 0 {
+		t.Fatalf("ListTasks on empty manager = %+v", got)
+	}
+
+	var want []string
+	for _, name := range []string{"a", "b", "c", "d"} {
+		want = append(want, mustCreate(t, m, name).Id)
+	}
+	// Updating a task must not move it.
+	if _, err := m.UpdateTask(ctx, want[0], "a2"); err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(mustList(t, m)); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("ListTasks = %v, want oldest first %v", got, want)
+	}
+}
+
+func testTrash(t *testing.T, m task.Manager) {
+	ctx := context.Background()
+	a := mustCreate(t, m, "a")
+	b := mustCreate(t, m, "b")
+
+	if _, err := m.RestoreTask(ctx, a.Id); !errors.Is(err, task.ErrTaskNotFound) {
+		t.Errorf("RestoreTask of live task: got %v, want ErrTaskNotFound", err)
+	}
+	for _, id := range []string{b.Id, a.Id} {
+		if err := m.DeleteTask(ctx, id); err != nil {
+			t.Fatalf("DeleteTask(%q): %v", id, err)
+		}
+	}
+	trash, err := m.ListTrash(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ids(trash), []string{b.Id, a.Id}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("ListTrash = %v, want in deletion order %v", got, want)
+	}
+	for _, tk := range trash {
+		if tk.DeletedAt == nil {
+			t.Errorf("trashed task %q has no DeletedAt", tk.Id)
+		} else if !tk.UpdatedAt.Equal(*tk.DeletedAt) {
+			t.Errorf("trashed task %q has UpdatedAt %v, want its DeletedAt %v", tk.Id, tk.UpdatedAt, *tk.DeletedAt)
+		}
+	}
+
+	restored, err := m.RestoreTask(ctx, a.Id)
+	if err != nil {
+		t.Fatalf("RestoreTask(%q): %v", a.Id, err)
+	}
+	if restored.DeletedAt != nil || restored.Name != "a" {
+		t.Errorf("RestoreTask = %+v, want live task %q", restored, "a")
+	}
+	if _, err := m.GetTask(ctx, a.Id); err != nil {
+		t.Errorf("GetTask of restored task: %v", err)
+	}
+
+	// PurgeTask removes tasks whether or not they are in the trash.
+	for _, id := range []string{a.Id, b.Id} {
+		if err := m.PurgeTask(ctx, id); err != nil {
+			t.Fatalf("PurgeTask(%q): %v", id, err)
+		}
+		if err := m.PurgeTask(ctx, id); !errors.Is(err, task.ErrTaskNotFound) {
+			t.Errorf("second PurgeTask(%q): got %v, want ErrTaskNotFound", id, err)
+		}
+	}
+	if got := mustList(t, m); len(got) != 0 {
+		t.Errorf("ListTasks after purge = %+v", got)
+	}
+	if trash, _ := m.ListTrash(ctx); len(trash) != 0 {
+		t.Errorf("ListTrash after purge = %+v", trash)
+	}
+}
+
+func testPurgeTrash(t *testing.T, m task.Manager) {
+	ctx := context.Background()
+	old := mustCreate(t, m, "old")
+	recent := mustCreate(t, m, "recent")
+	live := mustCreate(t, m, "live")
+
+	if err := m.DeleteTask(ctx, old.Id); err != nil {
+		t.Fatal(err)
+	}
+	trash, err := m.ListTrash(ctx)
+	if err != nil || len(trash) != 1 {
+		t.Fatalf("ListTrash = %+v, %v", trash, err)
+	}
+	// Use the backend's own timestamp as the cutoff to avoid depending on
+	// clock agreement with a database server.
+	cutoff := trash[0].DeletedAt.Add(time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	if err := m.DeleteTask(ctx, recent.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := m.PurgeTrash(ctx, cutoff)
+	if err != nil {
+		t.Fatalf("PurgeTrash: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("PurgeTrash = %d, want 1", n)
+	}
+	trash, err = m.ListTrash(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ids(trash), []string{recent.Id}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("ListTrash after PurgeTrash = %v, want %v", got, want)
+	}
+	if _, err := m.GetTask(ctx, live.Id); err != nil {
+		t.Errorf("GetTask of live task after PurgeTrash: %v", err)
+	}
+}
+
+func testRestore(t *testing.T, m task.Manager) {
+	ctx := context.Background()
+	a := mustCreate(t, m, "a")
+	b := mustCreate(t, m, "b")
+	if err := m.DeleteTask(ctx, a.Id); err != nil {
+		t.Fatal(err)
+	}
+	trash, err := m.ListTrash(ctx)
+	if err != nil || len(trash) != 1 {
+		t.Fatalf("ListTrash = %+v, %v", trash, err)
+	}
+	deletedAt := *trash[0].DeletedAt
+
+	restored, err := m.RestoreTask(ctx, a.Id)
+	if err != nil {
+		t.Fatalf("RestoreTask(%q): %v", a.Id, err)
+	}
+	if restored.Id != a.Id || restored.Name != a.Name || !restored.CreatedAt.Equal(a.CreatedAt) || restored.DeletedAt != nil {
+		t.Errorf("RestoreTask = %+v, want %+v out of the trash", restored, a)
+	}
+	if restored.UpdatedAt.Before(deletedAt) {
+		t.Errorf("restored task has UpdatedAt %v, before its deletion at %v", restored.UpdatedAt, deletedAt)
+	}
+	if _, err := m.RestoreTask(ctx, a.Id); !errors.Is(err, task.ErrTaskNotFound) {
+		t.Errorf("second RestoreTask: got %v, want ErrTaskNotFound", err)
+	}
+	if trash, _ := m.ListTrash(ctx); len(trash) != 0 {
+		t.Errorf("ListTrash after restore = %+v", trash)
+	}
+	// A restored task is back in its place, and can be changed again.
+	if got, want := ids(mustList(t, m)), []string{a.Id, b.Id}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("ListTasks after restore = %v, want %v", got, want)
+	}
+	if _, err := m.UpdateTask(ctx, a.Id, "a2"); err != nil {
+		t.Errorf("UpdateTask of restored task: %v", err)
+	}
+	if err := m.DeleteTask(ctx, a.Id); err != nil {
+		t.Errorf("DeleteTask of restored task: %v", err)
+	}
+}
+
+// testPurgeTrashOrder checks that the trash is purged in the order tasks
+// were deleted, as the audit log of the manager shows, if it has one.
+func testPurgeTrashOrder(t *testing.T, m task.Manager) {
+	ctx := context.Background()
+	var tasks []task.Task
+	for _, name := range []string{"a", "b", "c", "d"} {
+		tasks = append(tasks, mustCreate(t, m, name))
+	}
+	var want []string
+	for _, k := range []int{2, 0, 3, 1} {
+		if err := m.DeleteTask(ctx, tasks[k].Id); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, tasks[k].Id)
+		// Distinct deletion times, even with a coarse clock.
+		time.Sleep(2 * time.Millisecond)
+	}
+	trash, err := m.ListTrash(ctx)
+	if err != nil || len(trash) != len(want) {
+		t.Fatalf("ListTrash = %+v, %v", trash, err)
+	}
+	cutoff := trash[len(trash)-1].DeletedAt.Add(time.Millisecond)
+
+	n, err := m.PurgeTrash(ctx, cutoff)
+	if err != nil || n != len(want) {
+		t.Fatalf("PurgeTrash = %d, %v; want %d", n, err, len(want))
+	}
+	audit, ok := m.(task.AuditLog)
+	if !ok {
+		return
+	}
+	events, err := audit.ListAuditEvents(ctx, task.AuditFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range events {
+		if e.Action == task.ActionPurge {
+			got = append(got, e.TaskId)
+		}
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("purged %v, want in deletion order %v", got, want)
+	}
+}
+
+func testConcurrentCreate(t *testing.T, m task.Manager) {
+	const workers, perWorker = 8, 10
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		seen = make(map[string]bool)
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := 0; k < perWorker; k++ {
+				tk, err := m.CreateTask(context.Background(), "concurrent")
+				if err != nil {
+					t.Errorf("CreateTask: %v", err)
+					return
+				}
+				mu.Lock()
+				if seen[tk.Id] {
+					t.Errorf("ID %q issued twice", tk.Id)
+				}
+				seen[tk.Id] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := mustList(t, m); len(got) != workers*perWorker {
+		t.Errorf("ListTasks returned %d tasks, want %d", len(got), workers*perWorker)
+	}
+}
+
+func testConcurrentUpdate(t *testing.T, m task.Manager) {
+	ctx := context.Background()
+	tk := mustCreate(t, m, "contended")
+	const workers = 8
+	names := make(map[string]bool)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		name := "name-" + string(rune('a'+w))
+		names[name] = true
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := m.UpdateTask(context.Background(), tk.Id, name); err != nil {
+				t.Errorf("UpdateTask: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	got, err := m.GetTask(ctx, tk.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !names[got.Name] {
+		t.Errorf("Name = %q, want one of the concurrent updates", got.Name)
+	}
+	if got := mustList(t, m); len(got) != 1 {
+		t.Errorf("ListTasks returned %d tasks, want 1", len(got))
+	}
+}
+
+// testTransact checks units of work, for Managers that are Transactors.
+func testTransact(t *testing.T, m task.Manager) {
+	tr, ok := m.(task.Transactor)
+	if !ok {
+		t.Skip("not a task.Transactor")
+	}
+	ctx := context.Background()
+	a := mustCreate(t, m, "a")
+	errAbort := errors.New("abort")
+
+	// Changes are seen inside the work, and outside once it is committed.
+	var b task.Task
+	err := tr.Transact(ctx, func(ctx context.Context) error {
+		var err error
+		if b, err = m.CreateTask(ctx, "b"); err != nil {
+			return err
+		}
+		if _, err := m.UpdateTask(ctx, a.Id, "a2"); err != nil {
+			return err
+		}
+		if got, err := m.GetTask(ctx, a.Id); err != nil || got.Name != "a2" {
+			t.Errorf("GetTask inside the work = %+v, %v, want a2", got, err)
+		}
+		if _, err := m.GetTask(context.Background(), b.Id); !errors.Is(err, task.ErrTaskNotFound) {
+			t.Errorf("GetTask outside the work before commit: got %v, want ErrTaskNotFound", err)
+		}
+		// A failing call changes nothing, and the work can go on.
+		if _, err := m.UpdateTask(ctx, "missing", "x"); !errors.Is(err, task.ErrTaskNotFound) {
+			t.Errorf("UpdateTask of missing task: got %v, want ErrTaskNotFound", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transact: %v", err)
+	}
+	if got, err := m.GetTask(ctx, a.Id); err != nil || got.Name != "a2" {
+		t.Errorf("GetTask after commit = %+v, %v, want a2", got, err)
+	}
+	if got := ids(mustList(t, m)); strings.Join(got, ",") != a.Id+","+b.Id {
+		t.Errorf("ListTasks after commit = %v, want [%s %s]", got, a.Id, b.Id)
+	}
+
+	// Errors roll back every change, including those of nested work that
+	// was committed into the enclosing one.
+	err = tr.Transact(ctx, func(ctx context.Context) error {
+		if err := m.DeleteTask(ctx, a.Id); err != nil {
+			return err
+		}
+		err := tr.Transact(ctx, func(ctx context.Context) error {
+			_, err := m.CreateTask(ctx, "c")
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("Transact: got %v, want %v", err, errAbort)
+	}
+	if got := ids(mustList(t, m)); strings.Join(got, ",") != a.Id+","+b.Id {
+		t.Errorf("ListTasks after rollback = %v, want [%s %s]", got, a.Id, b.Id)
+	}
+
+	// Failed nested work is rolled back alone.
+	err = tr.Transact(ctx, func(ctx context.Context) error {
+		if _, err := m.UpdateTask(ctx, b.Id, "b2"); err != nil {
+			return err
+		}
+		tr.Transact(ctx, func(ctx context.Context) error {
+			if err := m.DeleteTask(ctx, a.Id); err != nil {
+				return err
+			}
+			return errAbort
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transact: %v", err)
+	}
+	if got, err := m.GetTask(ctx, a.Id); err != nil || got.Name != "a2" {
+		t.Errorf("GetTask(a) after nested rollback = %+v, %v", got, err)
+	}
+	if got, err := m.GetTask(ctx, b.Id); err != nil || got.Name != "b2" {
+		t.Errorf("GetTask(b) after nested rollback = %+v, %v, want b2", got, err)
+	}
+
+	// Panics roll back too.
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Transact did not propagate the panic")
+			}
+		}()
+		tr.Transact(ctx, func(ctx context.Context) error {
+			m.DeleteTask(ctx, b.Id)
+			panic("abort")
+		})
+	}()
+	if _, err := m.GetTask(ctx, b.Id); err != nil {
+		t.Errorf("GetTask after panic: %v", err)
+	}
+}
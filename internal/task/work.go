@@ -0,0 +1,35 @@
+package task
+
+import (
+	"context"
+	"errors"
+)
+
+// Transactor is implemented by Managers that can group several calls into a
+// unit of work, such as moving a task and recording why in one go.
+type Transactor interface {
+	// Transact calls f with a copy of ctx that carries a new unit of work.
+	// The Manager calls made with that context see each other's changes,
+	// which other callers only see once f returns nil and the unit of work
+	// is committed. If f returns an error or panics, they are all rolled
+	// back. A call that fails within the unit of work changes nothing, so f
+	// may handle the error and go on.
+	//
+	// Transact may be called with a context that already carries a unit of
+	// work, in which case the new one is committed into the enclosing one.
+	Transact(ctx context.Context, f func(ctx context.Context) error) error
+}
+
+// ErrTransactUnsupported is returned by Transact for Managers that are not
+// Transactors.
+var ErrTransactUnsupported = errors.New("task manager does not support units of work")
+
+// Transact calls m.Transact if m is a Transactor, and otherwise returns
+// ErrTransactUnsupported without calling f.
+func Transact(ctx context.Context, m Manager, f func(ctx context.Context) error) error {
+	t, ok := m.(Transactor)
+	if !ok {
+		return ErrTransactUnsupported
+	}
+	return t.Transact(ctx, f)
+}
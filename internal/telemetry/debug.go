@@ -6,12 +6,14 @@ import (
 	"net/http"
 	"net/http/pprof"
 	"strings"
+	"text/tabwriter"
 
 	"contrib.go.opencensus.io/exporter/ocagent"
 	"contrib.go.opencensus.io/exporter/prometheus"
 	"github.com/go-chi/chi/v5"
 	prom_client "github.com/prometheus/client_golang/prometheus"
 	"github.com/urvil38/todo-app/internal/config"
+	"github.com/urvil38/todo-app/internal/database"
 	"github.com/urvil38/todo-app/internal/version"
 	"go.opencensus.io/plugin/ochttp"
 	"go.opencensus.io/plugin/runmetrics"
@@ -61,6 +63,8 @@ const debugPage = `
 <html>
 <p><a href="/tracez">/tracez</a> - trace spans</p>
 <p><a href="/statsz">/statz</a> - prometheus metrics page</p>
+<p><a href="/dbpoolz">/dbpoolz</a> - database connection pools</p>
+<p><a href="/queryz">/queryz</a> - database query statistics</p>
 `
 
 // Init configures tracing and aggregation according to the given Views.
@@ -108,6 +112,8 @@ func NewServer(cfg config.Config) (http.Handler, error) {
 	mux.Handle("/version", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprint(w, fmt.Sprintf("version: %v\ncommit: %v", version.Version, version.Commit))
 	}))
+	mux.HandleFunc("/dbpoolz", dbPoolHandler)
+	mux.HandleFunc("/queryz", queryHandler)
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprint(w, debugPage)
 	})
@@ -118,3 +124,30 @@ func NewServer(cfg config.Config) (http.Handler, error) {
 	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
 	return mux, nil
 }
+
+// dbPoolHandler writes the live state of the registered database connection
+// pools as a table.
+func dbPoolHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "POOL\tMAX OPEN\tOPEN\tIN USE\tIDLE\tWAIT COUNT\tWAIT DURATION\tIDLE CLOSED\tLIFETIME CLOSED")
+	for _, p := range database.Pools() {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%v\t%d\t%d\n",
+			p.Name, p.MaxOpenConnections, p.OpenConnections, p.InUse, p.Idle,
+			p.WaitCount, p.WaitDuration, p.MaxIdleClosed+p.MaxIdleTimeClosed, p.MaxLifetimeClosed)
+	}
+	tw.Flush()
+}
+
+// queryHandler writes the statistics of the database queries run by the
+// process as a table, the queries taking the most time first.
+func queryHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "TOTAL\tCOUNT\tERRORS\tP50\tP95\tP99\tMAX\tQUERY")
+	for _, q := range database.QueryStats() {
+		fmt.Fprintf(tw, "%v\t%d\t%d\t%v\t%v\t%v\t%v\t%s\n",
+			q.Total, q.Count, q.Errors, q.P50, q.P95, q.P99, q.Max, q.Query)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,167 @@
+// Package tlsconfig builds TLS configurations for the todo server whose
+// certificates are reloaded when the files change on disk.
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/urvil38/todo-app/internal/config"
+	"github.com/urvil38/todo-app/internal/log"
+)
+
+// reloadInterval is how often certificate files are checked for changes.
+const reloadInterval = 30 * time.Second
+
+// CertReloader serves a certificate and key pair read from disk, reloading
+// them when either file is modified.
+type CertReloader struct {
+	certFile, keyFile string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time // latest modification time of the two files
+}
+
+// NewCertReloader loads the certificate and key pair from the given files.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate can be used as tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Watch checks the files for changes every interval until ctx is done. If a
+// changed pair fails to load, the previous certificate stays in use.
+func (r *CertReloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			modTime, err := r.latestModTime()
+			if err != nil {
+				log.Logger.Error("CertReloader: ", err)
+				continue
+			}
+			r.mu.RLock()
+			changed := modTime.After(r.modTime)
+			r.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := r.reload(); err != nil {
+				log.Logger.Error("CertReloader: keeping previous certificate: ", err)
+				continue
+			}
+			log.Logger.Infof("reloaded TLS certificate from %s", r.certFile)
+		}
+	}
+}
+
+func (r *CertReloader) reload() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("unable to load key pair: %w", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+func (r *CertReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, f := range []string{r.certFile, r.keyFile} {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return latest, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// ParseVersion converts a TLS version such as "1.2" to its tls constant.
+func ParseVersion(v string) (uint16, error) {
+	switch v {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS version: %q", v)
+	}
+}
+
+// Server returns the TLS configuration for the API server, or nil if TLS is
+// not enabled. The certificate is watched for changes until ctx is done.
+func Server(ctx context.Context, cfg config.Config) (*tls.Config, error) {
+	if !cfg.TLSEnabled() {
+		return nil, nil
+	}
+	minVersion, err := ParseVersion(cfg.TLSMinVersion)
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	go r.Watch(ctx, reloadInterval)
+	return &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: r.GetCertificate,
+	}, nil
+}
+
+// Debug returns the TLS configuration for the debug server, or nil if TLS is
+// not enabled. If a client CA is configured, clients must present a
+// certificate signed by it.
+func Debug(ctx context.Context, cfg config.Config) (*tls.Config, error) {
+	tc, err := Server(ctx, cfg)
+	if err != nil || tc == nil {
+		return tc, err
+	}
+	if cfg.DebugTLSClientCAFile == "" {
+		return tc, nil
+	}
+	pem, err := os.ReadFile(cfg.DebugTLSClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", cfg.DebugTLSClientCAFile)
+	}
+	tc.ClientCAs = pool
+	tc.ClientAuth = tls.RequireAndVerifyClientCert
+	return tc, nil
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/urvil38/todo-app/internal/log"
 	"github.com/urvil38/todo-app/internal/server"
 	"github.com/urvil38/todo-app/internal/telemetry"
+	"github.com/urvil38/todo-app/internal/tlsconfig"
 )
 
 func main() {
@@ -26,8 +27,21 @@ func main() {
 		if err != nil {
 			log.Logger.Fatal(ctx, err)
 		}
+		tlsConfig, err := tlsconfig.Debug(ctx, *cfg)
+		if err != nil {
+			log.Logger.Fatal(ctx, err)
+		}
 		dAddr := cfg.Addr + ":" + cfg.DebugPort
-		go http.ListenAndServe(dAddr, debugServer)
+		ds := &http.Server{
+			Addr:      dAddr,
+			Handler:   debugServer,
+			TLSConfig: tlsConfig,
+		}
+		if tlsConfig != nil {
+			go ds.ListenAndServeTLS("", "")
+		} else {
+			go ds.ListenAndServe()
+		}
 		log.Logger.Info("debug server is running on: ", dAddr)
 	}
 
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS audit_events;
+
+DROP FUNCTION trigger_prevent_audit_change;
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS audit_events(
+  id bigserial PRIMARY KEY,
+  task_id text NOT NULL,
+  action text NOT NULL,
+  request_id text NOT NULL DEFAULT '',
+  remote_addr text NOT NULL DEFAULT '',
+  user_agent text NOT NULL DEFAULT '',
+  before jsonb,
+  after jsonb,
+  created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX audit_events_task_id_idx ON audit_events (task_id, created_at);
+CREATE INDEX audit_events_created_at_idx ON audit_events (created_at);
+
+CREATE FUNCTION trigger_prevent_audit_change() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+BEGIN
+  RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$;
+COMMENT ON FUNCTION trigger_prevent_audit_change IS
+'FUNCTION trigger_prevent_audit_change rejects any modification of an existing audit event.';
+
+CREATE TRIGGER prevent_audit_change BEFORE UPDATE OR DELETE ON audit_events
+     FOR EACH ROW EXECUTE PROCEDURE trigger_prevent_audit_change();
+COMMENT ON TRIGGER prevent_audit_change ON audit_events IS
+'TRIGGER prevent_audit_change keeps the audit trail append-only.';
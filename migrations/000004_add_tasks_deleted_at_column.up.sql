@@ -0,0 +1,4 @@
+ALTER TABLE tasks
+  ADD COLUMN deleted_at timestamp with time zone;
+
+CREATE INDEX tasks_deleted_at_idx ON tasks (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,7 @@
+CREATE UNLOGGED TABLE IF NOT EXISTS rate_limits(
+  key text PRIMARY KEY,
+  tokens double precision NOT NULL,
+  updated_at timestamp with time zone NOT NULL
+);
+
+CREATE INDEX rate_limits_updated_at_idx ON rate_limits (updated_at);
@@ -0,0 +1,19 @@
+-- Tasks that never had a counter ID are given a new one.
+DROP INDEX IF EXISTS tasks_created_at_idx;
+DROP INDEX IF EXISTS tasks_legacy_id_idx;
+
+CREATE SEQUENCE tasks_id_seq;
+SELECT setval('tasks_id_seq', COALESCE(max(legacy_id::integer), 0) + 1, false)
+  FROM tasks WHERE legacy_id <> '';
+ALTER TABLE tasks DISABLE TRIGGER set_updated_at;
+UPDATE tasks SET legacy_id = nextval('tasks_id_seq')::text
+  WHERE legacy_id = '';
+ALTER TABLE tasks ENABLE TRIGGER set_updated_at;
+
+ALTER TABLE tasks
+  ALTER COLUMN id TYPE integer USING legacy_id::integer,
+  ALTER COLUMN id SET DEFAULT nextval('tasks_id_seq');
+ALTER SEQUENCE tasks_id_seq OWNED BY tasks.id;
+
+ALTER TABLE tasks
+  DROP COLUMN legacy_id;
@@ -0,0 +1,38 @@
+-- Task IDs become ULIDs issued by the application. Existing tasks are given
+-- ULIDs derived from their creation time and keep their counter ID as a
+-- legacy alias.
+CREATE FUNCTION migration_ulid(ts timestamp with time zone) RETURNS text
+    LANGUAGE plpgsql
+    AS $$
+DECLARE
+  alphabet CONSTANT text := '0123456789ABCDEFGHJKMNPQRSTVWXYZ';
+  -- 2 bits of padding, 48 bits of milliseconds and 80 random bits.
+  bits bit varying := B'00' || (floor(extract(epoch FROM ts) * 1000)::bigint)::bit(48);
+  id text := '';
+BEGIN
+  FOR i IN 1..10 LOOP
+    bits := bits || (floor(random() * 256)::int)::bit(8);
+  END LOOP;
+  FOR i IN 0..25 LOOP
+    id := id || substr(alphabet, substring(bits FROM i * 5 + 1 FOR 5)::bit(5)::int + 1, 1);
+  END LOOP;
+  RETURN id;
+END;
+$$;
+
+ALTER TABLE tasks
+  ADD COLUMN legacy_id text NOT NULL DEFAULT '';
+-- Copying the ID is not a modification of the task.
+ALTER TABLE tasks DISABLE TRIGGER set_updated_at;
+UPDATE tasks SET legacy_id = id::text;
+ALTER TABLE tasks ENABLE TRIGGER set_updated_at;
+
+ALTER TABLE tasks
+  ALTER COLUMN id DROP DEFAULT,
+  ALTER COLUMN id TYPE text USING migration_ulid(created_at);
+DROP SEQUENCE IF EXISTS tasks_id_seq;
+
+CREATE UNIQUE INDEX tasks_legacy_id_idx ON tasks (legacy_id) WHERE legacy_id <> '';
+CREATE INDEX tasks_created_at_idx ON tasks (created_at, id);
+
+DROP FUNCTION migration_ulid;
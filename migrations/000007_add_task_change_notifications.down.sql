@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS notify_task_change ON tasks;
+
+DROP FUNCTION trigger_notify_task_change;
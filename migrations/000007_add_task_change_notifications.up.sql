@@ -0,0 +1,23 @@
+-- Changes to tasks are published on the task_changes channel when their
+-- transaction commits, so that servers sharing the database can react to
+-- each other's writes. The payload must stay under the 8000 bytes allowed by
+-- NOTIFY, which the row of a task is far from.
+CREATE FUNCTION trigger_notify_task_change() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+BEGIN
+  IF TG_OP = 'DELETE' THEN
+    PERFORM pg_notify('task_changes', json_build_object('op', 'delete', 'task', row_to_json(OLD))::text);
+  ELSE
+    PERFORM pg_notify('task_changes', json_build_object('op', lower(TG_OP), 'task', row_to_json(NEW))::text);
+  END IF;
+  RETURN NULL;
+END;
+$$;
+COMMENT ON FUNCTION trigger_notify_task_change IS
+'FUNCTION trigger_notify_task_change publishes the inserted, updated or deleted row of a task on the task_changes channel.';
+
+CREATE TRIGGER notify_task_change AFTER INSERT OR UPDATE OR DELETE ON tasks
+     FOR EACH ROW EXECUTE PROCEDURE trigger_notify_task_change();
+COMMENT ON TRIGGER notify_task_change ON tasks IS
+'TRIGGER notify_task_change notifies listeners of the task_changes channel of every change to the tasks table.';
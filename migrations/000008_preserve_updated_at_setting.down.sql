@@ -0,0 +1,10 @@
+CREATE OR REPLACE FUNCTION trigger_modify_updated_at() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+BEGIN
+  NEW.updated_at = NOW();
+  RETURN NEW;
+END;
+$$;
+COMMENT ON FUNCTION trigger_modify_updated_at IS
+'FUNCTION trigger_modify_updated_at sets the value of a column named updated_at to the current timestamp.';
@@ -0,0 +1,17 @@
+-- Restores and seeds write rows with the updated_at they had, which
+-- set_updated_at used to overwrite unless the trigger was disabled. Disabling
+-- it takes an ACCESS EXCLUSIVE lock on tasks, so such transactions now set
+-- todo.preserve_updated_at instead, which only they see.
+CREATE OR REPLACE FUNCTION trigger_modify_updated_at() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+BEGIN
+  IF current_setting('todo.preserve_updated_at', true) = 'on' THEN
+    RETURN NEW;
+  END IF;
+  NEW.updated_at = NOW();
+  RETURN NEW;
+END;
+$$;
+COMMENT ON FUNCTION trigger_modify_updated_at IS
+'FUNCTION trigger_modify_updated_at sets the value of a column named updated_at to the current timestamp, unless the setting todo.preserve_updated_at is on.';
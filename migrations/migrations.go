@@ -0,0 +1,10 @@
+// Package migrations embeds the postgres schema migrations, so that the
+// binaries that apply them do not depend on the working directory.
+package migrations
+
+import "embed"
+
+// FS holds the migrations, named in the format expected by golang-migrate.
+//
+//go:embed *.sql
+var FS embed.FS